@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksRefresh is how long fetched keys are used before they are reloaded.
+	jwksRefresh = time.Hour
+	// jwksMinReload limits reloads triggered by tokens signed with unknown keys.
+	jwksMinReload = time.Minute
+	// maxJWKSSize bounds the JWKS document read from a file or URL.
+	maxJWKSSize = 1 << 20
+)
+
+var ErrUnknownKey = errors.New("no key for token")
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKS holds the RSA signing keys of a JSON Web Key Set loaded from a file or
+// a URL. Keys are reloaded once they are older than an hour, or earlier when
+// a token names a key that is not in the set.
+type JWKS struct {
+	load func(ctx context.Context) ([]byte, error)
+
+	mu       sync.RWMutex
+	keys     map[string]*rsa.PublicKey
+	loadedAt time.Time
+}
+
+func NewFileJWKS(ctx context.Context, path string) (*JWKS, error) {
+	return newJWKS(ctx, func(context.Context) ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(io.LimitReader(f, maxJWKSSize))
+	})
+}
+
+func NewURLJWKS(ctx context.Context, url string, client *http.Client) (*JWKS, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return newJWKS(ctx, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	})
+}
+
+func newJWKS(ctx context.Context, load func(ctx context.Context) ([]byte, error)) (*JWKS, error) {
+	k := &JWKS{load: load}
+	if err := k.reload(ctx); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Key returns the key with the given ID. Tokens without a key ID are only
+// accepted while the set holds a single key.
+func (k *JWKS) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.RLock()
+	key, ok := k.lookup(kid)
+	stale := time.Since(k.loadedAt) > jwksRefresh
+	canReload := time.Since(k.loadedAt) > jwksMinReload
+	k.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && !canReload {
+		return nil, ErrUnknownKey
+	}
+
+	if err := k.reload(ctx); err != nil {
+		// keep serving the keys we have when the source is unavailable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (k *JWKS) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *JWKS) reload(ctx context.Context) error {
+	data, err := k.load(ctx)
+	if err != nil {
+		return fmt.Errorf("load jwks: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// parseJWKS keeps the RSA signature keys of a JWKS document and skips keys
+// of other types.
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") || (key.Alg != "" && key.Alg != "RS256") {
+			continue
+		}
+		pub, err := rsaKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parse jwks key %q: %w", key.Kid, err)
+		}
+		keys[key.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("parse jwks: no RS256 signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKey(key jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid key parameters")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware rejects requests without a valid bearer token and stores the
+// caller in the request context. S3 clients, which sign requests with their
+// own Authorization header, pass the token as the session token instead.
+// OPTIONS requests are let through for CORS preflight and tus discovery.
+func Middleware(v *Verifier, l logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		token := bearerToken(c.Request)
+		if token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="uploads"`)
+			problem.Abort(c, http.StatusUnauthorized, problem.CodeUnauthorized, "missing bearer token")
+			return
+		}
+
+		principal, err := v.Verify(c.Request.Context(), token)
+		if err != nil {
+			l.Warn("request authentication failed",
+				"method", c.Request.Method,
+				"path", c.FullPath(),
+				"error", err,
+			)
+			c.Header("WWW-Authenticate", `Bearer realm="uploads", error="invalid_token"`)
+			problem.Abort(c, http.StatusUnauthorized, problem.CodeInvalidToken, "invalid token")
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-Amz-Security-Token")
+}
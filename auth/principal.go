@@ -0,0 +1,60 @@
+// Package auth authenticates API callers with JWTs and checks that they own
+// the upload sessions they act on.
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrForbidden = errors.New("upload belongs to another user")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Claims  map[string]any
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Owner returns the owner recorded on sessions created by the caller, empty
+// when the request is not authenticated.
+func Owner(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// Tenant returns the tenant named by a string claim of the caller token,
+// empty when the caller has no such claim.
+func Tenant(ctx context.Context, claim string) string {
+	if p, ok := FromContext(ctx); ok {
+		tenant, _ := p.Claims[claim].(string)
+		return tenant
+	}
+	return ""
+}
+
+// Authorize checks that the caller owns a session. Requests only carry no
+// principal when auth is disabled, and then every session is accessible.
+// Sessions without an owner are refused to authenticated callers.
+func Authorize(ctx context.Context, owner string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if owner == "" || owner != p.Subject {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Yulian302/lfusys-services-uploads/settings"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// leeway absorbs clock skew between the token issuer and this service.
+const leeway = 30 * time.Second
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Verifier validates HS256 tokens against a shared secret and RS256 tokens
+// against the keys of a JWKS. Tokens must carry a subject and an expiry.
+type Verifier struct {
+	secret []byte
+	jwks   *JWKS
+	parser *jwt.Parser
+}
+
+func NewVerifier(ctx context.Context, cfg *settings.AuthConfig) (*Verifier, error) {
+	v := &Verifier{}
+	methods := make([]string, 0, 2)
+
+	if cfg.HMACSecret != "" {
+		v.secret = []byte(cfg.HMACSecret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	var err error
+	switch {
+	case cfg.JWKSFile != "":
+		v.jwks, err = NewFileJWKS(ctx, cfg.JWKSFile)
+	case cfg.JWKSURL != "":
+		v.jwks, err = NewURLJWKS(ctx, cfg.JWKSURL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.jwks != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no token verification keys configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify checks the token signature and claims and returns the caller.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		switch t.Method.Alg() {
+		case jwt.SigningMethodHS256.Alg():
+			return v.secret, nil
+		case jwt.SigningMethodRS256.Alg():
+			kid, _ := t.Header["kid"].(string)
+			return v.jwks.Key(ctx, kid)
+		}
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	return &Principal{Subject: subject, Claims: claims}, nil
+}
@@ -0,0 +1,199 @@
+// Package compression decodes chunk bodies sent with a Content-Encoding and
+// encodes the chunks of sessions that store them compressed.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+
+	// Accepted is the Accept-Encoding value listing the supported encodings.
+	Accepted = "gzip, zstd"
+
+	// ratioFloor is the decoded size below which the compression ratio is not
+	// checked, small bodies of repeated bytes compress far better than data.
+	ratioFloor = 1 << 20
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrTooLarge            = errors.New("decoded body exceeds the size limit")
+	ErrRatio               = errors.New("decoded body exceeds the compression ratio limit")
+	ErrCorrupt             = errors.New("invalid compressed body")
+)
+
+// Parse returns the encoding named by a Content-Encoding header. A missing
+// header is identity, and only a single coding is accepted.
+func Parse(header string) (string, error) {
+	switch name := strings.ToLower(strings.TrimSpace(header)); name {
+	case "", Identity:
+		return Identity, nil
+	case Gzip, "x-gzip":
+		return Gzip, nil
+	case Zstd:
+		return Zstd, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedEncoding, header)
+	}
+}
+
+// Bound returns the largest body an encoding of size bytes takes, so that
+// data that does not compress still fits.
+func Bound(size int64) int64 {
+	return size + size/1000 + 1024
+}
+
+// Limits guard decoding against decompression bombs. MaxSize bounds the
+// decoded bytes and MaxRatio the decoded bytes per encoded byte. Zero
+// disables a limit.
+type Limits struct {
+	MaxSize  int64
+	MaxRatio int64
+}
+
+// NewReader returns a reader of the body decoded from encoding. Reads fail
+// with ErrTooLarge or ErrRatio once the decoded bytes exceed the limits, and
+// with ErrCorrupt when the body is not valid for its encoding.
+func NewReader(body io.Reader, encoding string, limits Limits) (io.ReadCloser, error) {
+	src := &countingReader{r: body}
+
+	var (
+		decoder io.Reader
+		closer  func()
+	)
+	switch encoding {
+	case Identity:
+		decoder, closer = src, func() {}
+	case Gzip:
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, src.wrap(err)
+		}
+		decoder, closer = zr, func() { zr.Close() }
+	case Zstd:
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if limits.MaxSize > 0 {
+			opts = append(opts, zstd.WithDecoderMaxMemory(uint64(limits.MaxSize)+1))
+		}
+		zr, err := zstd.NewReader(src, opts...)
+		if err != nil {
+			return nil, err
+		}
+		decoder, closer = zr, zr.Close
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+
+	return &limitedReader{src: src, r: decoder, close: closer, limits: limits}, nil
+}
+
+// Decode reads the whole body decoded from encoding within limits.
+func Decode(body io.Reader, encoding string, limits Limits) ([]byte, error) {
+	r, err := NewReader(body, encoding, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+})
+
+// Encode compresses data with encoding. Identity returns data unchanged.
+func Encode(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case Identity:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// countingReader counts the encoded bytes read and keeps the last read
+// error, so that failures of the body are told apart from corrupt data.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// wrap returns the body error behind a decoder error, or ErrCorrupt when the
+// body was read fine.
+func (c *countingReader) wrap(err error) error {
+	if c.err != nil {
+		return c.err
+	}
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return fmt.Errorf("%w: %w", ErrTooLarge, err)
+	}
+	return fmt.Errorf("%w: %w", ErrCorrupt, err)
+}
+
+type limitedReader struct {
+	src     *countingReader
+	r       io.Reader
+	close   func()
+	limits  Limits
+	decoded int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.decoded += int64(n)
+
+	if l.limits.MaxSize > 0 && l.decoded > l.limits.MaxSize {
+		return n, fmt.Errorf("%w of %d bytes", ErrTooLarge, l.limits.MaxSize)
+	}
+	if l.limits.MaxRatio > 0 && l.decoded > ratioFloor && l.decoded > l.limits.MaxRatio*l.src.n {
+		return n, fmt.Errorf("%w of %d", ErrRatio, l.limits.MaxRatio)
+	}
+	if err != nil && err != io.EOF && l.src != l.r {
+		return n, l.src.wrap(err)
+	}
+	return n, err
+}
+
+func (l *limitedReader) Close() error {
+	l.close()
+	return nil
+}
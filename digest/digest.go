@@ -0,0 +1,172 @@
+package digest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Default is the chunk hash of sessions that do not choose one.
+const Default = "sha-256"
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported digest algorithm")
+	ErrInvalidDigest        = errors.New("invalid digest")
+)
+
+// Algorithm is a registered chunk hash. Name is the RFC 9530 algorithm key.
+type Algorithm struct {
+	Name string
+	Size int
+	New  func() hash.Hash
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	SHA256 = &Algorithm{Name: "sha-256", Size: sha256.Size, New: sha256.New}
+	SHA1   = &Algorithm{Name: "sha-1", Size: sha1.Size, New: sha1.New}
+	MD5    = &Algorithm{Name: "md5", Size: md5.Size, New: md5.New}
+	CRC32C = &Algorithm{Name: "crc32c", Size: crc32.Size, New: func() hash.Hash { return crc32.New(crc32cTable) }}
+	BLAKE3 = &Algorithm{Name: "blake3", Size: 32, New: func() hash.Hash { return blake3.New(32, nil) }}
+)
+
+var algorithms = map[string]*Algorithm{
+	SHA256.Name: SHA256,
+	SHA1.Name:   SHA1,
+	MD5.Name:    MD5,
+	CRC32C.Name: CRC32C,
+	BLAKE3.Name: BLAKE3,
+}
+
+var aliases = map[string]string{
+	"sha256": "sha-256",
+	"sha1":   "sha-1",
+	"sha":    "sha-1",
+}
+
+func Lookup(name string) (*Algorithm, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if canonical, ok := aliases[name]; ok {
+		name = canonical
+	}
+
+	alg, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, name)
+	}
+	return alg, nil
+}
+
+// Names returns the registered algorithm names in a stable order.
+func Names() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Digest is an expected or computed hash of a body.
+type Digest struct {
+	Algorithm *Algorithm
+	Sum       []byte
+}
+
+func (d *Digest) Hex() string {
+	return hex.EncodeToString(d.Sum)
+}
+
+func (d *Digest) Base64() string {
+	return base64.StdEncoding.EncodeToString(d.Sum)
+}
+
+func (d *Digest) Matches(sum []byte) bool {
+	return bytes.Equal(d.Sum, sum)
+}
+
+// Decode reads a hex or base64 encoded digest of alg, telling the encodings
+// apart by the length the algorithm produces.
+func Decode(alg *Algorithm, value string) (*Digest, error) {
+	value = strings.TrimSpace(value)
+
+	if len(value) == hex.EncodedLen(alg.Size) {
+		if sum, err := hex.DecodeString(value); err == nil {
+			return &Digest{Algorithm: alg, Sum: sum}, nil
+		}
+	}
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if sum, err := enc.DecodeString(value); err == nil && len(sum) == alg.Size {
+			return &Digest{Algorithm: alg, Sum: sum}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: expected %d byte %s digest", ErrInvalidDigest, alg.Size, alg.Name)
+}
+
+// ParseHeader parses an RFC 9530 Content-Digest or Repr-Digest field, a
+// dictionary of algorithm keys and ":base64:" byte sequences. Unknown
+// algorithms are skipped, the supported digests are returned in field order.
+func ParseHeader(header string) ([]*Digest, error) {
+	var digests []*Digest
+
+	for _, member := range strings.Split(header, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(member, "=")
+		if !ok {
+			return nil, ErrInvalidDigest
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, ErrInvalidDigest
+		}
+
+		alg, err := Lookup(key)
+		if err != nil {
+			continue
+		}
+
+		sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil || len(sum) != alg.Size {
+			return nil, ErrInvalidDigest
+		}
+		digests = append(digests, &Digest{Algorithm: alg, Sum: sum})
+	}
+
+	return digests, nil
+}
+
+// FormatHeader renders digest as an RFC 9530 dictionary member.
+func FormatHeader(d *Digest) string {
+	return fmt.Sprintf("%s=:%s:", d.Algorithm.Name, d.Base64())
+}
+
+// WantHeader renders a Want-Content-Digest preference listing every
+// supported algorithm, preferred first.
+func WantHeader(preferred string) string {
+	members := []string{preferred + "=10"}
+	for _, name := range Names() {
+		if name != preferred {
+			members = append(members, name+"=1")
+		}
+	}
+	return strings.Join(members, ", ")
+}
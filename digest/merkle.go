@@ -0,0 +1,30 @@
+package digest
+
+import "crypto/sha256"
+
+// MerkleRoot combines chunk hashes, in chunk order, into a binary Merkle
+// tree. Each parent is the SHA256 of its two children concatenated, a node
+// without a sibling moves up a level unchanged, and a single leaf is its own
+// root.
+func MerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return level[0]
+}
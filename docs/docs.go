@@ -19,11 +19,1510 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/files": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create an upload session for a file of Upload-Length bytes",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "tus creation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Protocol version",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "File size in bytes",
+                        "name": "Upload-Length",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated key and base64 value pairs",
+                        "name": "Upload-Metadata",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Upload URL"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or encryption key",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Unsupported protocol version"
+                    },
+                    "413": {
+                        "description": "Upload-Length larger than the open session byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Open session or byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            },
+            "options": {
+                "description": "Report the supported tus version, extensions and checksum algorithms",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "tus capabilities",
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "headers": {
+                            "Tus-Checksum-Algorithm": {
+                                "type": "string",
+                                "description": "Supported checksum algorithms"
+                            },
+                            "Tus-Extension": {
+                                "type": "string",
+                                "description": "Supported extensions"
+                            },
+                            "Tus-Version": {
+                                "type": "string",
+                                "description": "Supported protocol versions"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{uploadId}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Abort the upload and delete its stored data",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "tus termination",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Upload not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload already completed or failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Report how many bytes of the upload are committed",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "tus offset",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "Upload-Length": {
+                                "type": "integer",
+                                "description": "File size in bytes"
+                            },
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "Committed bytes"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token"
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user"
+                    },
+                    "404": {
+                        "description": "Upload not found"
+                    },
+                    "410": {
+                        "description": "Upload terminated or expired"
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Append bytes to the upload at Upload-Offset",
+                "consumes": [
+                    "application/offset+octet-stream"
+                ],
+                "tags": [
+                    "tus"
+                ],
+                "summary": "tus append",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset the body starts at",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Checksum algorithm and base64 digest of the body",
+                        "name": "Upload-Checksum",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "headers": {
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "Committed bytes"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or missing encryption key",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Upload not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Offset mismatch, upload already completed or failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload terminated or expired",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Body exceeds Upload-Length or daily byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Assembled file failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Daily byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "460": {
+                        "description": "Checksum mismatch",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/s3/{bucket}/{key}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "List the parts stored for a multipart upload",
+                "produces": [
+                    "text/xml"
+                ],
+                "tags": [
+                    "s3"
+                ],
+                "summary": "ListParts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bucket name",
+                        "name": "bucket",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Object key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Multipart upload ID",
+                        "name": "uploadId",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum parts to return",
+                        "name": "max-parts",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "List parts after this number",
+                        "name": "part-number-marker",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "AES256 for SSE-C uploads",
+                        "name": "x-amz-server-side-encryption-customer-algorithm",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 SSE-C key of the upload",
+                        "name": "x-amz-server-side-encryption-customer-key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "x-amz-server-side-encryption-customer-key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stored parts",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.ListPartsResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid SSE-C key",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied or SSE-C key does not match the upload",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Upload not found",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "With ?partNumber and ?uploadId uploads one part, without them stores the body as a single part upload",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "text/xml"
+                ],
+                "tags": [
+                    "s3"
+                ],
+                "summary": "UploadPart and PutObject",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bucket name",
+                        "name": "bucket",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Object key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Part number between 1 and 10000",
+                        "name": "partNumber",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Multipart upload ID",
+                        "name": "uploadId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the body",
+                        "name": "Content-MD5",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hex SHA256 of the body",
+                        "name": "x-amz-content-sha256",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "AES256 for SSE-C uploads",
+                        "name": "x-amz-server-side-encryption-customer-algorithm",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 SSE-C key of the upload",
+                        "name": "x-amz-server-side-encryption-customer-key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "x-amz-server-side-encryption-customer-key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "MD5 of the part, or the S3 ETag of SSE-KMS and SSE-C parts"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request, digest mismatch or invalid SSE-C key",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied or SSE-C key does not match the upload",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Upload not found",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "411": {
+                        "description": "Content length required",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "413": {
+                        "description": "Part or object larger than the maximum chunk size or the byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "429": {
+                        "description": "Open session or byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "With ?uploads starts a multipart upload, with ?uploadId completes it from the listed parts",
+                "consumes": [
+                    "text/xml"
+                ],
+                "produces": [
+                    "text/xml"
+                ],
+                "tags": [
+                    "s3"
+                ],
+                "summary": "CreateMultipartUpload and CompleteMultipartUpload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bucket name",
+                        "name": "bucket",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Object key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start a multipart upload",
+                        "name": "uploads",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Upload to complete",
+                        "name": "uploadId",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Parts to complete",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.CompleteMultipartUpload"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "AES256 for SSE-C uploads",
+                        "name": "x-amz-server-side-encryption-customer-algorithm",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 SSE-C key of the upload",
+                        "name": "x-amz-server-side-encryption-customer-key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "x-amz-server-side-encryption-customer-key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload initiated or completed",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.CompleteMultipartUploadResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request, part or SSE-C key",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied or SSE-C key does not match the upload",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Upload not found",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "429": {
+                        "description": "Open session quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Abort a multipart upload and delete its parts",
+                "produces": [
+                    "text/xml"
+                ],
+                "tags": [
+                    "s3"
+                ],
+                "summary": "AbortMultipartUpload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bucket name",
+                        "name": "bucket",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Object key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Multipart upload ID",
+                        "name": "uploadId",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Upload not found",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/s3api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Start a new chunked upload for a file of the given size. An optional file hash or Merkle root over the chunk hashes is verified before the upload completes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Create upload session",
+                "parameters": [
+                    {
+                        "description": "File description",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/uploads.CreateUploadRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Upload session created",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.CreateUploadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or encryption key",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Chunk size above the maximum or file larger than the open session byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Open session or byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload/{uploadId}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Report which chunks of an upload are stored and which are still missing",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Get upload status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload status",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.UploadStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Upload a byte range of the file with Content-Range \"bytes first-last/total\", or query the committed range with \"bytes */total\" and an empty body. Incomplete uploads answer 308 with the committed bytes in the Range header, completed uploads answer with their status.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Resumable byte range upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range of the body",
+                        "name": "Content-Range",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload complete",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.UploadStatusResponse"
+                        }
+                    },
+                    "308": {
+                        "description": "Upload incomplete",
+                        "headers": {
+                            "Range": {
+                                "type": "string",
+                                "description": "Committed bytes, e.g. bytes=0-1048575"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload completed or failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload aborted or session expired",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Range exceeds file size or daily byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Assembled file failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Daily byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Abort an upload session and delete all of its stored chunks",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Abort upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload aborted",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.AbortResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload already completed or failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            }
+        },
         "/upload/{uploadId}/chunk/{chunkId}": {
             "put": {
-                "description": "Upload a file chunk with integrity verification",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Upload a file chunk with integrity verification. Every chunk but the last must be exactly the session chunk size, the last one holds the remainder. The digest is read from Content-Digest, Repr-Digest, Content-MD5 or X-Chunk-Hash, in that order, and one of them is required. Chunks may be sent gzip or zstd encoded, sizes then apply to the decoded data, as do all digests but Content-Digest, which covers the encoded body.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Upload file chunk",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Chunk number",
+                        "name": "chunkId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9530 digest of the body as sent, e.g. crc32c=:base64:",
+                        "name": "Content-Digest",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9530 digest of chunk data",
+                        "name": "Repr-Digest",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of chunk data",
+                        "name": "Content-MD5",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hex or base64 hash of chunk data in the session algorithm",
+                        "name": "X-Chunk-Hash",
+                        "in": "header"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Replace a chunk already uploaded with different content",
+                        "name": "X-Chunk-Overwrite",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "gzip or zstd when the chunk is sent compressed",
+                        "name": "Content-Encoding",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Chunk uploaded, or already uploaded with the same content",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.UploadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request, chunk index out of range, wrong chunk size, integrity error or missing encryption key",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload completed, failed verification or chunk already uploaded with different content",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload aborted or session expired",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "411": {
+                        "description": "Content length required",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Chunk larger than its expected or maximum size, decoded chunk past the compression ratio limit, or chunk larger than the daily byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported content encoding",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Assembled file failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Daily byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "S3 upload failed",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Check whether a chunk is already persisted, returning its hash and size in headers",
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Probe uploaded chunk",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Chunk number",
+                        "name": "chunkId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Chunk is stored",
+                        "headers": {
+                            "Repr-Digest": {
+                                "type": "string",
+                                "description": "RFC 9530 digest of chunk data"
+                            },
+                            "X-Chunk-Hash": {
+                                "type": "string",
+                                "description": "Hex hash of chunk data"
+                            },
+                            "X-Chunk-Hash-Algorithm": {
+                                "type": "string",
+                                "description": "Algorithm of X-Chunk-Hash"
+                            },
+                            "X-Chunk-Size": {
+                                "type": "integer",
+                                "description": "Chunk size in bytes"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request"
+                    },
+                    "401": {
+                        "description": "Missing or invalid token"
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it"
+                    },
+                    "404": {
+                        "description": "Chunk or session not found"
+                    },
+                    "500": {
+                        "description": "Internal server error"
+                    }
+                }
+            }
+        },
+        "/upload/{uploadId}/chunk/{chunkId}/confirm": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Check a chunk uploaded through a presigned URL and record it on the session. Objects without the signed checksum or with the wrong size are deleted. Confirming a chunk again is answered as a duplicate and not charged twice.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Confirm presigned chunk upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Chunk number",
+                        "name": "chunkId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Chunk recorded",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.UploadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or integrity error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session or chunk not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload completed or failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload aborted or session expired",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Chunk larger than the daily byte quota",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Assembled file failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Daily byte quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload/{uploadId}/chunk/{chunkId}/presign": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Issue a presigned S3 PUT URL so the client uploads a chunk straight to the bucket. The SHA256 checksum is signed into the URL, the PUT has to carry every returned header and the chunk is recorded once it is confirmed. Uploads whose chunks the service encrypts itself cannot be presigned.",
                 "consumes": [
-                    "application/octet-stream"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
@@ -31,7 +1530,7 @@ const docTemplate = `{
                 "tags": [
                     "uploads"
                 ],
-                "summary": "Upload file chunk",
+                "summary": "Presign chunk upload",
                 "parameters": [
                     {
                         "type": "string",
@@ -47,31 +1546,264 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "description": "Chunk checksum and size",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/uploads.PresignChunkRequest"
+                        }
+                    },
                     {
                         "type": "string",
-                        "description": "SHA256 hash of chunk data",
-                        "name": "X-Chunk-Hash",
-                        "in": "header",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Replace a chunk already uploaded with different content",
+                        "name": "X-Chunk-Overwrite",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Presigned request",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.PresignChunkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload completed, failed verification or is encrypted by the service, or chunk already uploaded with different content",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload aborted or session expired",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload/{uploadId}/chunks": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Upload many chunks in one request, either as multipart/form-data parts named chunk_\u003cindex\u003e with Content-Digest, Repr-Digest, Content-MD5 or X-Chunk-Hash part headers or a preceding hash_\u003cindex\u003e field, or as application/x-lfusys-chunks frames of uint32 index, 32 byte SHA256, uint32 length and data. Chunks are verified and stored independently. Chunks already uploaded with the same content are reported unchanged, ones with different content fail unless X-Chunk-Overwrite is set.",
+                "consumes": [
+                    "multipart/form-data",
+                    "application/x-lfusys-chunks"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Upload several chunks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Replace chunks already uploaded with different content",
+                        "name": "X-Chunk-Overwrite",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 AES-256 key of an SSE-C upload",
+                        "name": "X-SSE-Customer-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base64 MD5 of the SSE-C key",
+                        "name": "X-SSE-Customer-Key-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Per chunk results",
+                        "schema": {
+                            "$ref": "#/definitions/uploads.BatchUploadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Malformed batch body",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user, or encryption key does not match it",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload completed or failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload aborted or session expired",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Too many chunks",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Assembled file failed verification",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload/{uploadId}/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Stream the progress of an upload as Server-Sent Events, or as WebSocket text messages when the request asks for a WebSocket upgrade. The first event is the current state of the upload, chunk_received and progress events follow as chunks arrive and the stream ends after a finalized, failed or aborted event. Idle streams get a keep alive comment, or a ping, at every heartbeat.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Watch upload progress",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload session ID",
+                        "name": "uploadId",
+                        "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
+                    "101": {
+                        "description": "Switched to a WebSocket"
+                    },
                     "200": {
-                        "description": "Chunk uploaded successfully",
+                        "description": "Stream of upload events",
                         "schema": {
-                            "$ref": "#/definitions/uploads.UploadResponse"
+                            "$ref": "#/definitions/events.Event"
                         }
                     },
                     "400": {
-                        "description": "Invalid request or integrity error",
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Upload belongs to another user",
+                        "schema": {
+                            "$ref": "#/definitions/problem.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
                         "schema": {
-                            "$ref": "#/definitions/uploads.HTTPError"
+                            "$ref": "#/definitions/problem.Problem"
                         }
                     },
                     "500": {
-                        "description": "S3 upload failed",
+                        "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/uploads.HTTPError"
+                            "$ref": "#/definitions/problem.Problem"
                         }
                     }
                 }
@@ -79,12 +1811,426 @@ const docTemplate = `{
         }
     },
     "definitions": {
-        "uploads.HTTPError": {
+        "events.Event": {
+            "type": "object",
+            "properties": {
+                "chunk_id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "progress": {
+                    "type": "number",
+                    "example": 40
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "file hash mismatch"
+                },
+                "received_bytes": {
+                    "type": "integer",
+                    "example": 4194304
+                },
+                "received_chunks": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "time": {
+                    "type": "integer",
+                    "example": 1735689600000
+                },
+                "total_bytes": {
+                    "type": "integer",
+                    "example": 10485760
+                },
+                "total_chunks": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "type": {
+                    "type": "string",
+                    "example": "progress"
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "abc123"
+                }
+            }
+        },
+        "problem.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "session_not_found"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "session not found"
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "/api/v1/upload/abc123"
+                },
+                "request_id": {
+                    "type": "string",
+                    "example": "5f0c6a43-2b1e-4f5e-9a55-0c6f5c1b7e21"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 404
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Not Found"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "urn:lfusys:problem:session_not_found"
+                }
+            }
+        },
+        "s3api.CompleteMultipartUpload": {
+            "type": "object",
+            "properties": {
+                "parts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/s3api.CompletedPart"
+                    }
+                }
+            }
+        },
+        "s3api.CompleteMultipartUploadResult": {
             "type": "object",
             "properties": {
+                "bucket": {
+                    "type": "string"
+                },
+                "etag": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                }
+            }
+        },
+        "s3api.CompletedPart": {
+            "type": "object",
+            "properties": {
+                "etag": {
+                    "type": "string"
+                },
+                "partNumber": {
+                    "type": "integer"
+                }
+            }
+        },
+        "s3api.Error": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "resource": {
+                    "type": "string"
+                }
+            }
+        },
+        "s3api.ListPartsResult": {
+            "type": "object",
+            "properties": {
+                "bucket": {
+                    "type": "string"
+                },
+                "isTruncated": {
+                    "type": "boolean"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "maxParts": {
+                    "type": "integer"
+                },
+                "nextPartNumberMarker": {
+                    "type": "integer"
+                },
+                "partNumberMarker": {
+                    "type": "integer"
+                },
+                "parts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/s3api.Part"
+                    }
+                },
+                "uploadId": {
+                    "type": "string"
+                }
+            }
+        },
+        "s3api.Part": {
+            "type": "object",
+            "properties": {
+                "etag": {
+                    "type": "string"
+                },
+                "partNumber": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "uploads.AbortResponse": {
+            "type": "object",
+            "properties": {
+                "deleted_chunks": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "status": {
+                    "type": "string",
+                    "example": "aborted"
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "abc123"
+                }
+            }
+        },
+        "uploads.BatchChunkResult": {
+            "type": "object",
+            "properties": {
+                "chunk_id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "code": {
+                    "type": "string",
+                    "example": "integrity_mismatch"
+                },
                 "error": {
                     "type": "string",
-                    "example": "error message"
+                    "example": "chunk does not match its digest"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "stored"
+                }
+            }
+        },
+        "uploads.BatchUploadResponse": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/uploads.BatchChunkResult"
+                    }
+                },
+                "stored": {
+                    "type": "integer",
+                    "example": 7
+                },
+                "unchanged": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "abc123"
+                }
+            }
+        },
+        "uploads.ChunkRange": {
+            "type": "object",
+            "properties": {
+                "end": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "start": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "uploads.CreateUploadRequest": {
+            "type": "object",
+            "required": [
+                "file_name",
+                "total_size"
+            ],
+            "properties": {
+                "chunk_size": {
+                    "type": "integer",
+                    "example": 5242880
+                },
+                "file_hash": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "file_hash_algorithm": {
+                    "type": "string",
+                    "enum": [
+                        "sha-256",
+                        "sha-1",
+                        "md5",
+                        "crc32c",
+                        "blake3"
+                    ],
+                    "example": "sha-256"
+                },
+                "file_name": {
+                    "type": "string",
+                    "example": "video.mp4"
+                },
+                "hash_algorithm": {
+                    "type": "string",
+                    "enum": [
+                        "sha-256",
+                        "sha-1",
+                        "md5",
+                        "crc32c",
+                        "blake3"
+                    ],
+                    "example": "crc32c"
+                },
+                "max_chunk_size": {
+                    "type": "integer",
+                    "example": 8388608
+                },
+                "merkle_root": {
+                    "type": "string",
+                    "example": "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+                },
+                "storage_encoding": {
+                    "type": "string",
+                    "enum": [
+                        "identity",
+                        "gzip",
+                        "zstd"
+                    ],
+                    "example": "zstd"
+                },
+                "total_size": {
+                    "type": "integer",
+                    "example": 26214400
+                }
+            }
+        },
+        "uploads.CreateUploadResponse": {
+            "type": "object",
+            "properties": {
+                "chunk_size": {
+                    "type": "integer",
+                    "example": 5242880
+                },
+                "encryption": {
+                    "type": "string",
+                    "enum": [
+                        "AES256",
+                        "aws:kms",
+                        "SSE-C"
+                    ],
+                    "example": "aws:kms"
+                },
+                "expires_at": {
+                    "type": "integer",
+                    "example": 1735689600
+                },
+                "hash_algorithm": {
+                    "type": "string",
+                    "example": "sha-256"
+                },
+                "kms_key_id": {
+                    "type": "string",
+                    "example": "arn:aws:kms:eu-central-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+                },
+                "max_chunk_size": {
+                    "type": "integer",
+                    "example": 67108864
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "storage_encoding": {
+                    "type": "string",
+                    "example": "zstd"
+                },
+                "total_chunks": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "abc123"
+                }
+            }
+        },
+        "uploads.PresignChunkRequest": {
+            "type": "object",
+            "required": [
+                "checksum_sha256"
+            ],
+            "properties": {
+                "checksum_sha256": {
+                    "type": "string",
+                    "example": "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 5242880
+                }
+            }
+        },
+        "uploads.PresignChunkResponse": {
+            "type": "object",
+            "properties": {
+                "chunk_id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "expires_at": {
+                    "type": "integer",
+                    "example": 1735689600
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "method": {
+                    "type": "string",
+                    "example": "PUT"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 5242880
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "abc123"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://bucket.s3.amazonaws.com/uploads/abc123/chunk_1?X-Amz-Signature=..."
                 }
             }
         },
@@ -95,6 +2241,10 @@ const docTemplate = `{
                     "type": "integer",
                     "example": 1
                 },
+                "duplicate": {
+                    "type": "boolean",
+                    "example": false
+                },
                 "s3_key": {
                     "type": "string",
                     "example": "uploads/abc123/chunk_1"
@@ -104,6 +2254,75 @@ const docTemplate = `{
                     "example": "abc123"
                 }
             }
+        },
+        "uploads.UploadStatusResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "integer",
+                    "example": 1735689600
+                },
+                "failure_reason": {
+                    "type": "string",
+                    "example": "assembled file does not match file hash"
+                },
+                "missing_ranges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/uploads.ChunkRange"
+                    }
+                },
+                "progress": {
+                    "type": "number",
+                    "example": 0.4
+                },
+                "received_bytes": {
+                    "type": "integer",
+                    "example": 10485760
+                },
+                "received_chunks": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        0,
+                        1
+                    ]
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "in_progress",
+                        "completed",
+                        "aborted",
+                        "failed",
+                        "expired"
+                    ],
+                    "example": "in_progress"
+                },
+                "total_bytes": {
+                    "type": "integer",
+                    "example": 26214400
+                },
+                "total_chunks": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "abc123"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "JWT as \"Bearer \u003ctoken\u003e\". S3 clients pass it as X-Amz-Security-Token.",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     },
     "externalDocs": {
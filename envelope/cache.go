@@ -0,0 +1,67 @@
+package envelope
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CachingProvider keeps unwrapped data keys in memory for a while, so that
+// the chunks of an upload do not each cost a call to the master key.
+type CachingProvider struct {
+	KeyProvider
+
+	ttl       time.Duration
+	mu        sync.Mutex
+	keys      map[string]cachedKey
+	lastSweep time.Time
+}
+
+type cachedKey struct {
+	plaintext []byte
+	expiresAt time.Time
+}
+
+func NewCachingProvider(provider KeyProvider, ttl time.Duration) *CachingProvider {
+	return &CachingProvider{
+		KeyProvider: provider,
+		ttl:         ttl,
+		keys:        make(map[string]cachedKey),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (p *CachingProvider) Decrypt(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	id := keyID + "/" + string(wrapped)
+	now := time.Now()
+
+	p.mu.Lock()
+	if now.Sub(p.lastSweep) > p.ttl {
+		p.sweep(now)
+	}
+	cached, ok := p.keys[id]
+	p.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.plaintext, nil
+	}
+
+	plaintext, err := p.KeyProvider.Decrypt(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys[id] = cachedKey{plaintext: plaintext, expiresAt: now.Add(p.ttl)}
+	p.mu.Unlock()
+	return plaintext, nil
+}
+
+// sweep drops expired keys.
+func (p *CachingProvider) sweep(now time.Time) {
+	for id, cached := range p.keys {
+		if !now.Before(cached.expiresAt) {
+			delete(p.keys, id)
+		}
+	}
+	p.lastSweep = now
+}
@@ -0,0 +1,90 @@
+// Package envelope encrypts chunk data with a data key per upload. Data keys
+// are only stored wrapped by a master key of a KeyProvider, a local keyring
+// for development or KMS in production.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/Yulian302/lfusys-services-commons/health"
+)
+
+const (
+	// KeySize is the length of data and keyring keys, AES-256 is used throughout.
+	KeySize = 32
+	// NonceSize is the length of the AES-GCM nonce stored with each sealed chunk.
+	NonceSize = 12
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown master key")
+	ErrInvalidKey   = errors.New("invalid encryption key")
+	ErrDecrypt      = errors.New("encrypted data could not be authenticated")
+	ErrInvalidNonce = errors.New("invalid nonce")
+)
+
+// DataKey is a fresh data key along with its wrapped form. Only Wrapped and
+// KeyID are stored, Plaintext never leaves memory.
+type DataKey struct {
+	Plaintext []byte
+	Wrapped   []byte
+	KeyID     string // Master key that wrapped the data key
+}
+
+// KeyProvider issues data keys wrapped by a master key and unwraps them
+// again.
+type KeyProvider interface {
+	GenerateDataKey(ctx context.Context) (*DataKey, error)
+	// Decrypt unwraps a data key wrapped by the master key keyID.
+	Decrypt(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+
+	health.ReadinessCheck
+}
+
+// Seal encrypts plaintext with AES-256-GCM under a random nonce. The
+// additional data is authenticated but not encrypted, it has to be passed
+// unchanged to Open.
+func Seal(key []byte, plaintext []byte, additionalData []byte) (nonce []byte, ciphertext []byte, err error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce = make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts and authenticates ciphertext sealed by Seal.
+func Open(key []byte, nonce []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != NonceSize {
+		return nil, ErrInvalidNonce
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
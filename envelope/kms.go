@@ -0,0 +1,71 @@
+package envelope
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMSProvider has KMS generate and unwrap data keys under a KMS key, so the
+// master key never leaves KMS.
+type KMSProvider struct {
+	client *kms.Client
+	keyID  string
+}
+
+func NewKMSProvider(client *kms.Client, keyID string) *KMSProvider {
+	return &KMSProvider{
+		client: client,
+		keyID:  keyID,
+	}
+}
+
+func (p *KMSProvider) IsReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	_, err := p.client.DescribeKey(ctx, &kms.DescribeKeyInput{
+		KeyId: aws.String(p.keyID),
+	})
+	return err
+}
+
+func (p *KMSProvider) Name() string {
+	return "KeyProvider[kms]"
+}
+
+// GenerateDataKey returns a data key wrapped by the KMS key. The key ID
+// recorded is the ARN KMS reports, so aliases can be moved to other keys.
+func (p *KMSProvider) GenerateDataKey(ctx context.Context) (*DataKey, error) {
+	out, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	return &DataKey{
+		Plaintext: out.Plaintext,
+		Wrapped:   out.CiphertextBlob,
+		KeyID:     aws.ToString(out.KeyId),
+	}, nil
+}
+
+func (p *KMSProvider) Decrypt(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	out, err := p.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	if len(out.Plaintext) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,94 @@
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// keyringFile is the JSON layout of a local keyring: base64 AES-256 master
+// keys by ID, and the ID of the key new data keys are wrapped with. Retired
+// keys stay listed so the data keys they wrapped can still be unwrapped.
+type keyringFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// LocalKeyring wraps data keys with master keys read from a file. It is
+// meant for development, the master keys sit next to the service.
+type LocalKeyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+func NewLocalKeyring(path string) (*LocalKeyring, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keyring: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, value := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("keyring key %q must be %d base64 encoded bytes", id, KeySize)
+		}
+		keys[id] = key
+	}
+	if _, ok := keys[file.Active]; !ok {
+		return nil, fmt.Errorf("keyring has no active key %q", file.Active)
+	}
+
+	return &LocalKeyring{
+		active: file.Active,
+		keys:   keys,
+	}, nil
+}
+
+func (k *LocalKeyring) IsReady(ctx context.Context) error {
+	return nil
+}
+
+func (k *LocalKeyring) Name() string {
+	return "KeyProvider[local]"
+}
+
+// GenerateDataKey wraps a random data key with the active master key. The
+// wrapped key is the nonce followed by the sealed key, bound to the master
+// key ID.
+func (k *LocalKeyring) GenerateDataKey(ctx context.Context) (*DataKey, error) {
+	plaintext := make([]byte, KeySize)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, err
+	}
+
+	nonce, sealed, err := Seal(k.keys[k.active], plaintext, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{
+		Plaintext: plaintext,
+		Wrapped:   append(nonce, sealed...),
+		KeyID:     k.active,
+	}, nil
+}
+
+func (k *LocalKeyring) Decrypt(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < NonceSize {
+		return nil, ErrInvalidKey
+	}
+	return Open(master, wrapped[:NonceSize], wrapped[NonceSize:], []byte(keyID))
+}
@@ -0,0 +1,237 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// SegmentSize is the plaintext length of the segments of a sealed stream,
+	// only the last one may be shorter. It bounds the memory sealing and
+	// opening take, whatever the length of the stream.
+	SegmentSize = 64 * 1024
+	// StreamNonceSize is the length of the random nonce prefix stored with
+	// each sealed stream.
+	StreamNonceSize = 7
+	// Overhead is the length AES-GCM adds to each sealed message or segment.
+	Overhead = 16
+)
+
+var ErrStreamLength = errors.New("stream length does not match")
+
+// SealedSize returns the length of n bytes once sealed in segments.
+func SealedSize(n int64) int64 {
+	segments := (n + SegmentSize - 1) / SegmentSize
+	if segments == 0 {
+		// an empty stream is a single empty segment
+		segments = 1
+	}
+	return n + segments*Overhead
+}
+
+// OpenedSize returns the plaintext length of a stream of n sealed bytes.
+func OpenedSize(n int64) int64 {
+	full, rest := n/(SegmentSize+Overhead), n%(SegmentSize+Overhead)
+	size := full * SegmentSize
+	if rest > 0 {
+		size += max(0, rest-Overhead)
+	}
+	return size
+}
+
+// NewSealReader returns a reader of the length bytes of src sealed with
+// AES-256-GCM in segments of SegmentSize, along with the random nonce prefix
+// of the stream. Each segment is sealed under the prefix, its index and a
+// flag set on the last one, so segments cannot be reordered or dropped and
+// the stream cannot be truncated without Open failing. The additional data
+// is authenticated with every segment. The reader seeks back to its start
+// when src is an io.Seeker.
+func NewSealReader(key []byte, src io.Reader, length int64, additionalData []byte) ([]byte, io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefix := make([]byte, StreamNonceSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, nil, err
+	}
+
+	s := &sealReader{
+		aead:      aead,
+		prefix:    prefix,
+		src:       src,
+		ad:        additionalData,
+		length:    length,
+		remaining: length,
+		plain:     make([]byte, min(length, SegmentSize)),
+	}
+	if seeker, ok := src.(io.Seeker); ok {
+		return prefix, &seekableSealReader{sealReader: s, seeker: seeker}, nil
+	}
+	return prefix, s, nil
+}
+
+type sealReader struct {
+	aead      cipher.AEAD
+	prefix    []byte
+	src       io.Reader
+	ad        []byte
+	length    int64
+	remaining int64
+	index     uint32
+	plain     []byte
+	sealed    []byte
+	out       []byte // sealed bytes not read yet
+	done      bool
+}
+
+func (s *sealReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+func (s *sealReader) next() error {
+	plain := s.plain[:min(s.remaining, SegmentSize)]
+	if _, err := io.ReadFull(s.src, plain); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: stream is shorter than %d bytes", ErrStreamLength, s.length)
+		}
+		return err
+	}
+	s.remaining -= int64(len(plain))
+
+	last := s.remaining == 0
+	if last {
+		var extra [1]byte
+		if n, _ := s.src.Read(extra[:]); n > 0 {
+			return fmt.Errorf("%w: stream is longer than %d bytes", ErrStreamLength, s.length)
+		}
+	}
+
+	s.sealed = s.aead.Seal(s.sealed[:0], segmentNonce(s.prefix, s.index, last), plain, s.ad)
+	s.out = s.sealed
+	s.index++
+	s.done = last
+	return nil
+}
+
+// seekableSealReader seals a source that can be read again, so a failed
+// write of the sealed stream can be retried.
+type seekableSealReader struct {
+	*sealReader
+	seeker io.Seeker
+}
+
+func (s *seekableSealReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errors.New("sealed stream only seeks to its start")
+	}
+	if _, err := s.seeker.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	s.remaining, s.index, s.out, s.done = s.length, 0, nil, false
+	return 0, nil
+}
+
+// NewOpenReader returns a reader of the plaintext of a stream sealed by
+// NewSealReader. Every segment is authenticated before it is returned, a
+// stream that was altered or truncated fails with ErrDecrypt.
+func NewOpenReader(key []byte, prefix []byte, src io.Reader, additionalData []byte) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) != StreamNonceSize {
+		return nil, ErrInvalidNonce
+	}
+
+	return &openReader{
+		aead:   aead,
+		prefix: prefix,
+		src:    bufio.NewReader(src),
+		ad:     additionalData,
+		sealed: make([]byte, SegmentSize+Overhead),
+	}, nil
+}
+
+type openReader struct {
+	aead   cipher.AEAD
+	prefix []byte
+	src    *bufio.Reader
+	ad     []byte
+	index  uint32
+	sealed []byte
+	plain  []byte
+	out    []byte // plaintext not read yet
+	done   bool
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.out) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		if err := o.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.out)
+	o.out = o.out[n:]
+	return n, nil
+}
+
+func (o *openReader) next() error {
+	n, err := io.ReadFull(o.src, o.sealed)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF):
+		// the stream ended without its last segment
+		return ErrDecrypt
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := o.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := o.aead.Open(o.plain[:0], segmentNonce(o.prefix, o.index, last), o.sealed[:n], o.ad)
+	if err != nil {
+		return ErrDecrypt
+	}
+	o.plain, o.out = plain, plain
+	o.index++
+	o.done = last
+	return nil
+}
+
+// segmentNonce is the nonce of the segment at index: the stream prefix, the
+// big endian index and the last segment flag.
+func segmentNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, NonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[StreamNonceSize:], index)
+	if last {
+		nonce[NonceSize-1] = 1
+	}
+	return nonce
+}
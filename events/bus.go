@@ -0,0 +1,190 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/google/uuid"
+)
+
+// subscriberBuffer is how many events a subscriber may lag behind. A
+// subscriber that falls further behind is dropped, its client reconnects and
+// starts again from the current state of the upload.
+const subscriberBuffer = 64
+
+// Fanout shares events between the instances of the service. Messages
+// published on one instance are received by all of them, the publisher
+// included.
+type Fanout interface {
+	Publish(ctx context.Context, msg []byte) error
+	// Receive passes every message to deliver until ctx is done.
+	Receive(ctx context.Context, deliver func(msg []byte)) error
+}
+
+// message is an event travelling through the fanout, tagged with the
+// instance that published it.
+type message struct {
+	Origin string `json:"origin"`
+	Event  Event  `json:"event"`
+}
+
+// Bus hands the events of an upload to the clients watching it. Without a
+// fanout only the subscribers on this instance see the events published
+// here.
+type Bus struct {
+	fanout Fanout
+	origin string
+
+	mu     sync.Mutex
+	subs   map[string]map[chan Event]struct{}
+	closed bool
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	logger logger.Logger
+}
+
+func NewBus(fanout Fanout, l logger.Logger) *Bus {
+	return &Bus{
+		fanout: fanout,
+		origin: uuid.NewString(),
+		subs:   make(map[string]map[chan Event]struct{}),
+		logger: l,
+	}
+}
+
+// Start receives the events other instances publish, until the bus is shut
+// down.
+func (b *Bus) Start() {
+	if b.fanout == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+		err := b.fanout.Receive(ctx, func(raw []byte) {
+			var msg message
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				b.logger.Warn("invalid upload event received", "error", err)
+				return
+			}
+			if msg.Origin != b.origin {
+				b.deliver(msg.Event)
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			b.logger.Error("upload event fanout stopped", "error", err)
+		}
+	}()
+}
+
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	b.deliver(event)
+
+	if b.fanout == nil {
+		return
+	}
+	raw, err := json.Marshal(message{Origin: b.origin, Event: event})
+	if err == nil {
+		err = b.fanout.Publish(ctx, raw)
+	}
+	if err != nil {
+		b.logger.Warn("failed to fan out upload event",
+			"upload_id", event.UploadID,
+			"type", event.Type,
+			"error", err,
+		)
+	}
+}
+
+// Subscribe returns the events of an upload until unsubscribe is called. The
+// channel is closed when the subscriber falls behind or the bus closes.
+func (b *Bus) Subscribe(uploadID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs[uploadID] == nil {
+		b.subs[uploadID] = make(map[chan Event]struct{})
+	}
+	b.subs[uploadID][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(uploadID, ch)
+	}
+}
+
+func (b *Bus) deliver(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[event.UploadID] {
+		select {
+		case ch <- event:
+		default:
+			b.logger.Warn("upload event subscriber too slow, dropping it",
+				"upload_id", event.UploadID,
+			)
+			b.remove(event.UploadID, ch)
+		}
+	}
+}
+
+// remove closes a subscription, b.mu must be held.
+func (b *Bus) remove(uploadID string, ch chan Event) {
+	subs := b.subs[uploadID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(b.subs, uploadID)
+	}
+}
+
+// Close ends every subscription, so that streams to watching clients finish
+// and do not hold up a server shutdown.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for uploadID, subs := range b.subs {
+		for ch := range subs {
+			b.remove(uploadID, ch)
+		}
+	}
+}
+
+func (b *Bus) Shutdown(ctx context.Context) error {
+	b.Close()
+
+	if b.cancel == nil {
+		return nil
+	}
+	b.cancel()
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if sh, ok := b.fanout.(interface{ Shutdown(context.Context) error }); ok {
+		return sh.Shutdown(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package events carries the progress of uploads to the clients watching
+// them. Sessions publish to a Bus, which hands events to the subscribers of
+// an upload on this instance and, through a Fanout, on every other instance.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+// Event types. They are part of the API and must not be renamed.
+const (
+	TypeChunkReceived = "chunk_received"
+	TypeProgress      = "progress"
+	TypeFinalized     = "finalized"
+	TypeFailed        = "failed"
+	TypeAborted       = "aborted"
+)
+
+// Event is a change of an upload. Every event carries the progress of the
+// upload after the change, Progress is a percentage of the received bytes
+// and stays zero while the size of the upload is unknown.
+type Event struct {
+	Type           string  `json:"type" example:"progress"`
+	UploadID       string  `json:"upload_id" example:"abc123"`
+	ChunkID        *uint32 `json:"chunk_id,omitempty" example:"3"`
+	ReceivedChunks uint32  `json:"received_chunks" example:"4"`
+	TotalChunks    uint32  `json:"total_chunks" example:"10"`
+	ReceivedBytes  int64   `json:"received_bytes" example:"4194304"`
+	TotalBytes     int64   `json:"total_bytes" example:"10485760"`
+	Progress       float64 `json:"progress" example:"40"`
+	Reason         string  `json:"reason,omitempty" example:"file hash mismatch"`
+	Time           int64   `json:"time" example:"1735689600000"`
+}
+
+// Terminal reports whether the upload ends with the event, no events follow
+// a terminal one.
+func (e Event) Terminal() bool {
+	return e.Type == TypeFinalized || e.Type == TypeFailed || e.Type == TypeAborted
+}
+
+// Publisher accepts the events of uploads. Publishing is best effort, an
+// event that cannot be delivered is dropped rather than failing the upload.
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Subscriber streams the events of an upload to the clients watching it.
+type Subscriber interface {
+	Subscribe(uploadID string) (<-chan Event, func())
+}
+
+// New describes the state of session as an event of type typ.
+func New(typ string, session *store.UploadSession) Event {
+	event := Event{
+		Type:           typ,
+		UploadID:       session.UploadID,
+		ReceivedChunks: uint32(len(session.ReceivedChunks())),
+		TotalChunks:    session.TotalChunks,
+		Reason:         session.FailureReason,
+		Time:           time.Now().UnixMilli(),
+	}
+
+	if session.TotalChunks > 0 {
+		event.ReceivedBytes = session.ReceivedBytes()
+		event.TotalBytes = session.TotalBytes()
+	}
+	switch {
+	case typ == TypeFinalized:
+		event.Progress = 100
+	case event.TotalBytes > 0:
+		event.Progress = float64(event.ReceivedBytes) * 100 / float64(event.TotalBytes)
+	}
+	return event
+}
+
+// ChunkReceived describes the arrival of a chunk of session.
+func ChunkReceived(session *store.UploadSession, chunkID uint32) Event {
+	event := New(TypeChunkReceived, session)
+	event.ChunkID = &chunkID
+	return event
+}
+
+// Current describes a session as a client that starts watching it sees it,
+// with the terminal event for sessions that already ended.
+func Current(session *store.UploadSession, now time.Time) Event {
+	switch session.CurrentStatus(now) {
+	case store.SessionStatusCompleted:
+		return New(TypeFinalized, session)
+	case store.SessionStatusFailed:
+		return New(TypeFailed, session)
+	case store.SessionStatusExpired:
+		event := New(TypeFailed, session)
+		event.Reason = "session expired"
+		return event
+	case store.SessionStatusAborted:
+		return New(TypeAborted, session)
+	default:
+		return New(TypeProgress, session)
+	}
+}
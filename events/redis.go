@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisFanout shares events between instances over a Redis pub/sub channel.
+// Messages are not stored, instances that are down miss them.
+type RedisFanout struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisFanout(client *redis.Client, channel string) *RedisFanout {
+	return &RedisFanout{
+		client:  client,
+		channel: channel,
+	}
+}
+
+func (f *RedisFanout) Publish(ctx context.Context, msg []byte) error {
+	return f.client.Publish(ctx, f.channel, msg).Err()
+}
+
+func (f *RedisFanout) Receive(ctx context.Context, deliver func(msg []byte)) error {
+	sub := f.client.Subscribe(ctx, f.channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			deliver([]byte(msg.Payload))
+		}
+	}
+}
+
+func (f *RedisFanout) IsReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return f.client.Ping(ctx).Err()
+}
+
+func (f *RedisFanout) Name() string {
+	return "EventFanout[redis]"
+}
+
+func (f *RedisFanout) Shutdown(ctx context.Context) error {
+	return f.client.Close()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/Yulian302/lfusys-services-uploads/grpcapi"
+	"github.com/Yulian302/lfusys-services-uploads/grpcapi/uploadspb"
+	"google.golang.org/grpc"
+)
+
+// grpcMessageOverhead leaves room for the fields sent next to the chunk data
+// of a message.
+const grpcMessageOverhead = 64 * 1024
+
+func BuildGRPCServer(app *App) *grpc.Server {
+	var (
+		unary  []grpc.UnaryServerInterceptor
+		stream []grpc.StreamServerInterceptor
+	)
+	// callers are authenticated first so they are limited as users
+	if app.Verifier != nil {
+		unary = append(unary, grpcapi.UnaryAuth(app.Verifier, app.Logger))
+		stream = append(stream, grpcapi.StreamAuth(app.Verifier, app.Logger))
+	}
+	if app.Limiter != nil {
+		unary = append(unary, grpcapi.UnaryRateLimit(app.Limiter, app.Settings.RateLimit, app.Logger))
+		stream = append(stream, grpcapi.StreamRateLimit(app.Limiter, app.Settings.RateLimit, app.Logger))
+	}
+
+	s := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(app.Settings.Limits.MaxChunkSize)+grpcMessageOverhead),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	uploadspb.RegisterUploadsServer(s,
+		grpcapi.NewUploadsServer(app.Services.Uploads, app.Services.Sessions, app.Settings.Limits.MaxChunkSize, app.Logger),
+	)
+	return s
+}
@@ -0,0 +1,73 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryAuth rejects calls without a valid bearer token in the authorization
+// metadata and stores the caller in the call context, like the HTTP auth
+// middleware.
+func UnaryAuth(v *auth.Verifier, l logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, v, l, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuth is UnaryAuth for streaming calls.
+func StreamAuth(v *auth.Verifier, l logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), v, l, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticatedStream is a server stream whose context carries the caller.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticate(ctx context.Context, v *auth.Verifier, l logger.Logger, method string) (context.Context, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, newStatus(codes.Unauthenticated, problem.CodeUnauthorized, "missing bearer token")
+	}
+
+	principal, err := v.Verify(ctx, token)
+	if err != nil {
+		l.Warn("call authentication failed",
+			"method", method,
+			"error", err,
+		)
+		return nil, newStatus(codes.Unauthenticated, problem.CodeInvalidToken, "invalid token")
+	}
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+func bearerToken(ctx context.Context) string {
+	for _, value := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		if scheme, token, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"errors"
+
+	apperror "github.com/Yulian302/lfusys-services-commons/errors"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain scopes the reasons of the ErrorInfo details.
+const errorDomain = "uploads.lfusys"
+
+// newStatus returns a call error carrying the problem code of the HTTP API
+// as the reason of an ErrorInfo.
+func newStatus(code codes.Code, reason string, message string) error {
+	st := status.New(code, message)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// sessionStatus translates the errors of the session and upload services
+// that are caused by the caller. It reports false for failures of the
+// service itself.
+func sessionStatus(err error) (error, bool) {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return newStatus(codes.PermissionDenied, problem.CodeForbidden, "upload belongs to another user"), true
+	case errors.Is(err, apperror.ErrSessionNotFound):
+		return newStatus(codes.NotFound, problem.CodeSessionNotFound, "session not found"), true
+	case errors.Is(err, store.ErrSessionCompleted):
+		return newStatus(codes.FailedPrecondition, problem.CodeSessionClosed, "upload already completed"), true
+	case errors.Is(err, store.ErrSessionFailed):
+		return newStatus(codes.FailedPrecondition, problem.CodeSessionClosed, "upload failed verification"), true
+	case errors.Is(err, store.ErrSessionAborted):
+		return newStatus(codes.FailedPrecondition, problem.CodeSessionClosed, "upload aborted"), true
+	case errors.Is(err, store.ErrSessionExpired):
+		return newStatus(codes.FailedPrecondition, problem.CodeSessionClosed, "upload session expired"), true
+	case errors.Is(err, store.ErrChunkOutOfRange):
+		return newStatus(codes.OutOfRange, problem.CodeChunkIndexOutOfRange, err.Error()), true
+	case errors.Is(err, services.ErrFileIntegrity):
+		return newStatus(codes.InvalidArgument, problem.CodeFileIntegrityMismatch, err.Error()), true
+	case errors.Is(err, store.ErrCustomerKeyMismatch):
+		return newStatus(codes.PermissionDenied, problem.CodeEncryptionKeyMismatch, err.Error()), true
+	case errors.Is(err, store.ErrInvalidCustomerKey):
+		return newStatus(codes.InvalidArgument, problem.CodeEncryptionKeyInvalid, err.Error()), true
+	case errors.Is(err, store.ErrCustomerKeyRequired):
+		return newStatus(codes.InvalidArgument, problem.CodeEncryptionKeyRequired, err.Error()), true
+	case errors.Is(err, services.ErrCustomerKeysDisabled):
+		return newStatus(codes.InvalidArgument, problem.CodeCustomerKeysDisabled, err.Error()), true
+	}
+
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return newStatus(codes.ResourceExhausted, problem.CodeQuotaExceeded, quotaErr.Error()), true
+	}
+	return nil, false
+}
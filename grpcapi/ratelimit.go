@@ -0,0 +1,152 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/ratelimit"
+	"github.com/Yulian302/lfusys-services-uploads/settings"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryRateLimit takes a token from the request bucket of the caller for
+// every call. Callers are keyed like the HTTP rate limit middleware, so both
+// APIs draw from the same buckets. Calls are refused with ResourceExhausted
+// and a retry-after header when the bucket is empty, and let through when
+// the limiter fails.
+func UnaryRateLimit(l ratelimit.Limiter, cfg *settings.RateLimitConfig, log logger.Logger) grpc.UnaryServerInterceptor {
+	limits := ratelimit.NewLimits(cfg)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		client := rateLimitClient(ctx, cfg.APIKeyHeader)
+		if res, ok := takeRequest(ctx, l, limits, client, log); !ok {
+			grpc.SetHeader(ctx, retryAfter(res))
+			return nil, rejectCall(log, client, info.FullMethod, res)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimit is UnaryRateLimit for streaming calls. The chunk data of
+// every message received is also charged to the byte buckets of the caller
+// and of its upload session, waiting for them to refill while they are
+// short like HTTP bodies of unknown length.
+func StreamRateLimit(l ratelimit.Limiter, cfg *settings.RateLimitConfig, log logger.Logger) grpc.StreamServerInterceptor {
+	limits := ratelimit.NewLimits(cfg)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		client := rateLimitClient(ctx, cfg.APIKeyHeader)
+		if res, ok := takeRequest(ctx, l, limits, client, log); !ok {
+			ss.SetHeader(retryAfter(res))
+			return rejectCall(log, client, info.FullMethod, res)
+		}
+
+		if !limits.Bytes.Enabled() && !limits.UploadBytes.Enabled() {
+			return handler(srv, ss)
+		}
+		return handler(srv, &pacedStream{ServerStream: ss, limiter: l, limits: limits, client: client, logger: log})
+	}
+}
+
+// chunkMessage is a received message that carries chunk data.
+type chunkMessage interface {
+	GetUploadId() string
+	GetData() []byte
+}
+
+// pacedStream charges the chunk data of received messages to the byte
+// buckets. Later messages of a stream may leave the upload ID empty, they
+// count against the session named last.
+type pacedStream struct {
+	grpc.ServerStream
+	limiter  ratelimit.Limiter
+	limits   ratelimit.Limits
+	client   string
+	uploadID string
+	logger   logger.Logger
+}
+
+func (s *pacedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	msg, ok := m.(chunkMessage)
+	if !ok || len(msg.GetData()) == 0 {
+		return nil
+	}
+	if id := msg.GetUploadId(); id != "" {
+		s.uploadID = id
+	}
+
+	ctx := s.Context()
+	n := int64(len(msg.GetData()))
+	if s.limits.Bytes.Enabled() {
+		if err := ratelimit.Wait(ctx, s.limiter, ratelimit.BytesKey(s.client), n, s.limits.Bytes, s.logger); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+	if s.uploadID != "" && s.limits.UploadBytes.Enabled() {
+		if err := ratelimit.Wait(ctx, s.limiter, ratelimit.UploadKey(s.uploadID), n, s.limits.UploadBytes, s.logger); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+	return nil
+}
+
+// takeRequest takes a token from the request bucket of client and reports
+// whether the call may go on.
+func takeRequest(ctx context.Context, l ratelimit.Limiter, limits ratelimit.Limits, client string, log logger.Logger) (ratelimit.Result, bool) {
+	if !limits.Requests.Enabled() {
+		return ratelimit.Result{}, true
+	}
+	res, err := l.Take(ctx, ratelimit.RequestsKey(client), 1, limits.Requests)
+	if err != nil {
+		log.Warn("rate limiter unavailable", "error", err)
+		return res, true
+	}
+	return res, res.Allowed
+}
+
+// rateLimitClient names the caller like the HTTP middleware, reading the
+// gateway API key from the metadata of the same name and the client IP from
+// the peer address.
+func rateLimitClient(ctx context.Context, apiKeyHeader string) string {
+	apiKey := ""
+	if apiKeyHeader != "" {
+		if values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(apiKeyHeader)); len(values) > 0 {
+			apiKey = values[0]
+		}
+	}
+
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	return ratelimit.ClientKey(ctx, apiKey, ip)
+}
+
+func retryAfter(res ratelimit.Result) metadata.MD {
+	return metadata.Pairs("retry-after", strconv.FormatInt(res.RetryAfterSeconds(), 10))
+}
+
+func rejectCall(log logger.Logger, client string, method string, res ratelimit.Result) error {
+	log.Warn("rate limit exceeded",
+		"client", client,
+		"bucket", "requests",
+		"method", method,
+		"retry_after", res.RetryAfter,
+	)
+	return newStatus(codes.ResourceExhausted, problem.CodeRateLimited, "rate limit exceeded")
+}
@@ -0,0 +1,362 @@
+// Package grpcapi serves the upload API over gRPC, for backends that
+// transfer files without going through HTTP. Sessions are still created over
+// HTTP, their chunks are then streamed here with the same checks.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/grpcapi/uploadspb"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata carrying the SSE-C key of a session, base64 encoded like the
+// X-SSE-Customer-Key headers of the HTTP API.
+const (
+	customerKeyMetadata    = "x-sse-customer-key"
+	customerKeyMD5Metadata = "x-sse-customer-key-md5"
+)
+
+const (
+	chunkStatusStored    = "stored"
+	chunkStatusUnchanged = "unchanged"
+	chunkStatusFailed    = "failed"
+)
+
+type UploadsServer struct {
+	uploadspb.UnimplementedUploadsServer
+
+	uploadService  services.UploadService
+	sessionService services.SessionService
+	maxChunkSize   int64
+
+	logger logger.Logger
+}
+
+func NewUploadsServer(uploadService services.UploadService, sessionService services.SessionService, maxChunkSize int64, l logger.Logger) *UploadsServer {
+	return &UploadsServer{
+		uploadService:  uploadService,
+		sessionService: sessionService,
+		maxChunkSize:   maxChunkSize,
+		logger:         l,
+	}
+}
+
+// UploadChunks stores the chunks of a stream one at a time as they arrive,
+// so at most one chunk per call is held in memory. Chunks that fail are
+// reported in the response, the call itself only fails when the session
+// cannot take chunks at all.
+func (s *UploadsServer) UploadChunks(stream grpc.ClientStreamingServer[uploadspb.UploadChunksRequest, uploadspb.UploadChunksResponse]) error {
+	ctx := stream.Context()
+
+	req, err := stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return newStatus(codes.InvalidArgument, problem.CodeInvalidRequest, "no chunks sent")
+		}
+		return err
+	}
+	uploadId := req.GetUploadId()
+	if uploadId == "" {
+		return newStatus(codes.InvalidArgument, problem.CodeInvalidRequest, "upload_id is required")
+	}
+
+	session, err := s.sessionService.GetSession(ctx, uploadId)
+	if err != nil {
+		return s.sessionError(uploadId, "chunk stream failed", err)
+	}
+	// completed sessions still answer identical chunks as unchanged
+	if err := session.CheckWritable(time.Now()); err != nil && !errors.Is(err, store.ErrSessionCompleted) {
+		return s.sessionError(uploadId, "chunk stream failed", err)
+	}
+	ctx, err = s.withEncryption(ctx, session)
+	if err != nil {
+		return s.sessionError(uploadId, "chunk stream failed", err)
+	}
+
+	resp := &uploadspb.UploadChunksResponse{UploadId: uploadId}
+	var stored, unchanged []store.ChunkHash
+	seen := make(map[uint32]struct{})
+
+	for {
+		if req.GetUploadId() != "" && req.GetUploadId() != uploadId {
+			s.recordStored(ctx, uploadId, stored)
+			return newStatus(codes.InvalidArgument, problem.CodeInvalidRequest, "all chunks of a stream must belong to one upload")
+		}
+
+		result, hash := s.storeChunk(ctx, session, req, seen)
+		resp.Results = append(resp.Results, result)
+		switch result.Status {
+		case chunkStatusStored:
+			stored = append(stored, store.NewChunkHash(req.GetChunkId(), hash))
+		case chunkStatusUnchanged:
+			unchanged = append(unchanged, store.NewChunkHash(req.GetChunkId(), hash))
+		}
+
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.recordStored(ctx, uploadId, stored)
+			return err
+		}
+	}
+
+	// a stream that only repeats chunks completes an upload whose
+	// finalization was lost
+	record := stored
+	if len(record) == 0 && len(unchanged) > 0 &&
+		session.Status != store.SessionStatusCompleted && uint32(len(session.ReceivedChunks())) == session.TotalChunks {
+		record = unchanged
+	}
+	if len(record) > 0 {
+		if err := s.sessionService.MarkChunksComplete(ctx, uploadId, record); err != nil {
+			return s.sessionError(uploadId, "chunk stream failed", err)
+		}
+	}
+
+	session, err = s.sessionService.GetSession(ctx, uploadId)
+	if err != nil {
+		return s.sessionError(uploadId, "chunk stream failed", err)
+	}
+
+	resp.Stored = uint32(len(stored))
+	resp.Unchanged = uint32(len(unchanged))
+	resp.Failed = uint32(len(resp.Results)) - resp.Stored - resp.Unchanged
+	resp.Status = newUploadStatus(session)
+
+	s.logger.Info("chunk stream uploaded",
+		"upload_id", uploadId,
+		"stored", resp.Stored,
+		"unchanged", resp.Unchanged,
+		"failed", resp.Failed,
+	)
+	return stream.SendAndClose(resp)
+}
+
+// recordStored marks the chunks a stream stored complete when it ends early.
+// They were charged and stored, so a resend finds them unchanged instead of
+// storing them again. The client may be gone, the chunks are recorded
+// anyway.
+func (s *UploadsServer) recordStored(ctx context.Context, uploadId string, stored []store.ChunkHash) {
+	if len(stored) == 0 {
+		return
+	}
+	if err := s.sessionService.MarkChunksComplete(context.WithoutCancel(ctx), uploadId, stored); err != nil {
+		s.logger.Warn("failed to record chunks of a broken stream",
+			"upload_id", uploadId,
+			"chunks", len(stored),
+			"error", err,
+		)
+	}
+}
+
+// storeChunk verifies a chunk of a stream and stores it unless the session
+// already holds it. The digest returned is the one to record for the chunk.
+func (s *UploadsServer) storeChunk(ctx context.Context, session *store.UploadSession, req *uploadspb.UploadChunksRequest, seen map[uint32]struct{}) (*uploadspb.ChunkResult, *digest.Digest) {
+	idx := req.GetChunkId()
+	fail := func(code string, reason string) (*uploadspb.ChunkResult, *digest.Digest) {
+		return &uploadspb.ChunkResult{ChunkId: idx, Status: chunkStatusFailed, Code: code, Error: reason}, nil
+	}
+
+	if _, ok := seen[idx]; ok {
+		return fail(problem.CodeDuplicateChunk, "duplicate chunk")
+	}
+
+	expected, code, reason := chunkDigest(session, req)
+	if expected == nil {
+		return fail(code, reason)
+	}
+	data := req.GetData()
+	if len(data) == 0 {
+		return fail(problem.CodeEmptyChunk, "no chunk binary data")
+	}
+	if limit := min(session.EffectiveChunkSize(), session.ChunkLimit(idx, s.maxChunkSize)); int64(len(data)) > limit {
+		return fail(problem.CodeChunkTooLarge, fmt.Sprintf("chunk exceeds the maximum size of %d bytes", limit))
+	}
+	if err := session.ValidateChunk(idx, int64(len(data))); err != nil {
+		if errors.Is(err, store.ErrChunkOutOfRange) {
+			return fail(problem.CodeChunkIndexOutOfRange, err.Error())
+		}
+		return fail(problem.CodeChunkSizeMismatch, err.Error())
+	}
+	seen[idx] = struct{}{}
+
+	match, err := s.matchChunk(ctx, session, idx, expected)
+	if err != nil {
+		s.logger.Error("chunk compare failed",
+			"upload_id", session.UploadID,
+			"chunk_id", idx,
+			"error", err,
+		)
+		return fail(problem.CodeInternal, "failed to compare with stored chunk")
+	}
+	if match == chunkSame {
+		return &uploadspb.ChunkResult{ChunkId: idx, Status: chunkStatusUnchanged}, expected
+	}
+	if match == chunkDifferent && !req.GetOverwrite() {
+		return fail(problem.CodeChunkConflict, "chunk already uploaded with different content")
+	}
+	if session.Status == store.SessionStatusCompleted {
+		return fail(problem.CodeSessionClosed, "upload already completed")
+	}
+
+	computed, err := s.uploadService.UploadData(ctx, session.UploadID, idx, data, session.StorageEncoding, expected)
+	if err != nil {
+		var quotaErr *services.QuotaError
+		switch {
+		case errors.Is(err, services.ErrIntegrity):
+			return fail(problem.CodeIntegrityMismatch, "chunk does not match its digest")
+		case errors.As(err, &quotaErr):
+			return fail(problem.CodeQuotaExceeded, quotaErr.Error())
+		}
+		s.logger.Error("chunk upload failed",
+			"upload_id", session.UploadID,
+			"chunk_id", idx,
+			"error", err,
+		)
+		return fail(problem.CodeInternal, "failed to store chunk")
+	}
+	return &uploadspb.ChunkResult{ChunkId: idx, Status: chunkStatusStored}, computed
+}
+
+// chunkDigest returns the digest a chunk is sent with, or the problem code
+// and reason it is rejected with.
+func chunkDigest(session *store.UploadSession, req *uploadspb.UploadChunksRequest) (*digest.Digest, string, string) {
+	if len(req.GetHash()) == 0 {
+		return nil, problem.CodeMissingDigest, "hash is required"
+	}
+
+	name := req.GetHashAlgorithm()
+	if name == "" {
+		name = session.ChunkHashAlgorithm()
+	}
+	alg, err := digest.Lookup(name)
+	if err != nil {
+		return nil, problem.CodeUnsupportedAlgorithm, err.Error()
+	}
+	if len(req.GetHash()) != alg.Size {
+		return nil, problem.CodeInvalidDigest, fmt.Sprintf("%s hash must be %d bytes", alg.Name, alg.Size)
+	}
+	return &digest.Digest{Algorithm: alg, Sum: req.GetHash()}, "", ""
+}
+
+func (s *UploadsServer) GetStatus(ctx context.Context, req *uploadspb.GetStatusRequest) (*uploadspb.UploadStatus, error) {
+	uploadId := req.GetUploadId()
+	if uploadId == "" {
+		return nil, newStatus(codes.InvalidArgument, problem.CodeInvalidRequest, "upload_id is required")
+	}
+
+	session, err := s.sessionService.GetSession(ctx, uploadId)
+	if err != nil {
+		return nil, s.sessionError(uploadId, "get upload status failed", err)
+	}
+	return newUploadStatus(session), nil
+}
+
+func (s *UploadsServer) Abort(ctx context.Context, req *uploadspb.AbortRequest) (*uploadspb.AbortResponse, error) {
+	uploadId := req.GetUploadId()
+	if uploadId == "" {
+		return nil, newStatus(codes.InvalidArgument, problem.CodeInvalidRequest, "upload_id is required")
+	}
+
+	if err := s.sessionService.AbortUpload(ctx, uploadId); err != nil {
+		return nil, s.sessionError(uploadId, "abort upload failed", err)
+	}
+
+	deleted, err := s.uploadService.DeleteUpload(ctx, uploadId)
+	if err != nil {
+		s.logger.Error("abort upload failed",
+			"upload_id", uploadId,
+			"reason", "chunk_purge_failed",
+			"error", err,
+		)
+		return nil, newStatus(codes.Internal, problem.CodeInternal, "could not delete upload chunks")
+	}
+
+	s.logger.Info("upload aborted",
+		"upload_id", uploadId,
+		"deleted_chunks", deleted,
+	)
+	return &uploadspb.AbortResponse{
+		UploadId:      uploadId,
+		Status:        store.SessionStatusAborted,
+		DeletedChunks: uint32(deleted),
+	}, nil
+}
+
+// withEncryption makes the chunk reads and writes of a call use the
+// encryption of the session, with the customer key sent in the metadata.
+func (s *UploadsServer) withEncryption(ctx context.Context, session *store.UploadSession) (context.Context, error) {
+	var key []byte
+	if values := metadata.ValueFromIncomingContext(ctx, customerKeyMetadata); len(values) > 0 && values[0] != "" {
+		var keyMD5 string
+		if md5s := metadata.ValueFromIncomingContext(ctx, customerKeyMD5Metadata); len(md5s) > 0 {
+			keyMD5 = md5s[0]
+		}
+		parsed, err := store.ParseCustomerKey(values[0], keyMD5)
+		if err != nil {
+			return nil, err
+		}
+		key = parsed
+	}
+
+	encryption, err := s.sessionService.ChunkEncryption(ctx, session, key)
+	if err != nil {
+		return nil, err
+	}
+	return store.WithEncryption(ctx, encryption), nil
+}
+
+// sessionError logs a failed call and returns the error the caller gets.
+func (s *UploadsServer) sessionError(uploadId string, msg string, err error) error {
+	if st, ok := sessionStatus(err); ok {
+		s.logger.Warn(msg,
+			"upload_id", uploadId,
+			"error", err,
+		)
+		return st
+	}
+
+	s.logger.Error(msg,
+		"upload_id", uploadId,
+		"error", err,
+	)
+	return newStatus(codes.Internal, problem.CodeInternal, "internal server error")
+}
+
+func newUploadStatus(session *store.UploadSession) *uploadspb.UploadStatus {
+	missing := session.MissingRanges()
+	ranges := make([]*uploadspb.ChunkRange, 0, len(missing))
+	for _, r := range missing {
+		ranges = append(ranges, &uploadspb.ChunkRange{Start: r.Start, End: r.End})
+	}
+
+	st := &uploadspb.UploadStatus{
+		UploadId:       session.UploadID,
+		Status:         session.CurrentStatus(time.Now()),
+		TotalChunks:    session.TotalChunks,
+		ReceivedChunks: session.ReceivedChunks(),
+		MissingRanges:  ranges,
+		ReceivedBytes:  session.ReceivedBytes(),
+		TotalBytes:     session.TotalBytes(),
+		FailureReason:  session.FailureReason,
+		ExpiresAt:      session.ExpiresAt,
+	}
+	if st.TotalBytes > 0 {
+		st.Progress = float64(st.ReceivedBytes) / float64(st.TotalBytes)
+	}
+	return st
+}
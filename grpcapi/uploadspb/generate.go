@@ -0,0 +1,5 @@
+// Package uploadspb holds the messages and service stubs of the gRPC upload
+// API, generated from uploads.proto.
+package uploadspb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative grpcapi/uploadspb/uploads.proto
@@ -0,0 +1,702 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: grpcapi/uploadspb/uploads.proto
+
+package uploadspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UploadChunksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Upload session of the chunk. Required on the first message, later
+	// messages may leave it empty.
+	UploadId string `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	ChunkId  uint32 `protobuf:"varint,2,opt,name=chunk_id,json=chunkId,proto3" json:"chunk_id,omitempty"`
+	Data     []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	// Algorithm of hash, the default chunk hash of the session when empty.
+	HashAlgorithm string `protobuf:"bytes,4,opt,name=hash_algorithm,json=hashAlgorithm,proto3" json:"hash_algorithm,omitempty"`
+	// Digest of data, required.
+	Hash []byte `protobuf:"bytes,5,opt,name=hash,proto3" json:"hash,omitempty"`
+	// Replace a chunk already uploaded with different content.
+	Overwrite     bool `protobuf:"varint,6,opt,name=overwrite,proto3" json:"overwrite,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadChunksRequest) Reset() {
+	*x = UploadChunksRequest{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadChunksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadChunksRequest) ProtoMessage() {}
+
+func (x *UploadChunksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadChunksRequest.ProtoReflect.Descriptor instead.
+func (*UploadChunksRequest) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UploadChunksRequest) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *UploadChunksRequest) GetChunkId() uint32 {
+	if x != nil {
+		return x.ChunkId
+	}
+	return 0
+}
+
+func (x *UploadChunksRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *UploadChunksRequest) GetHashAlgorithm() string {
+	if x != nil {
+		return x.HashAlgorithm
+	}
+	return ""
+}
+
+func (x *UploadChunksRequest) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *UploadChunksRequest) GetOverwrite() bool {
+	if x != nil {
+		return x.Overwrite
+	}
+	return false
+}
+
+type ChunkResult struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	ChunkId uint32                 `protobuf:"varint,1,opt,name=chunk_id,json=chunkId,proto3" json:"chunk_id,omitempty"`
+	// stored, unchanged or failed
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// Problem code of a failed chunk.
+	Code          string `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	Error         string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkResult) Reset() {
+	*x = ChunkResult{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkResult) ProtoMessage() {}
+
+func (x *ChunkResult) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkResult.ProtoReflect.Descriptor instead.
+func (*ChunkResult) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChunkResult) GetChunkId() uint32 {
+	if x != nil {
+		return x.ChunkId
+	}
+	return 0
+}
+
+func (x *ChunkResult) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ChunkResult) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *ChunkResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type UploadChunksResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	UploadId  string                 `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	Stored    uint32                 `protobuf:"varint,2,opt,name=stored,proto3" json:"stored,omitempty"`
+	Unchanged uint32                 `protobuf:"varint,3,opt,name=unchanged,proto3" json:"unchanged,omitempty"`
+	Failed    uint32                 `protobuf:"varint,4,opt,name=failed,proto3" json:"failed,omitempty"`
+	Results   []*ChunkResult         `protobuf:"bytes,5,rep,name=results,proto3" json:"results,omitempty"`
+	// Status of the upload after the chunks were recorded.
+	Status        *UploadStatus `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadChunksResponse) Reset() {
+	*x = UploadChunksResponse{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadChunksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadChunksResponse) ProtoMessage() {}
+
+func (x *UploadChunksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadChunksResponse.ProtoReflect.Descriptor instead.
+func (*UploadChunksResponse) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UploadChunksResponse) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *UploadChunksResponse) GetStored() uint32 {
+	if x != nil {
+		return x.Stored
+	}
+	return 0
+}
+
+func (x *UploadChunksResponse) GetUnchanged() uint32 {
+	if x != nil {
+		return x.Unchanged
+	}
+	return 0
+}
+
+func (x *UploadChunksResponse) GetFailed() uint32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *UploadChunksResponse) GetResults() []*ChunkResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *UploadChunksResponse) GetStatus() *UploadStatus {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UploadId      string                 `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetStatusRequest) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+type ChunkRange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         uint32                 `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           uint32                 `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkRange) Reset() {
+	*x = ChunkRange{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkRange) ProtoMessage() {}
+
+func (x *ChunkRange) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkRange.ProtoReflect.Descriptor instead.
+func (*ChunkRange) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ChunkRange) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *ChunkRange) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+type UploadStatus struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	UploadId string                 `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	// pending, in_progress, completed, aborted, failed or expired
+	Status         string        `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	TotalChunks    uint32        `protobuf:"varint,3,opt,name=total_chunks,json=totalChunks,proto3" json:"total_chunks,omitempty"`
+	ReceivedChunks []uint32      `protobuf:"varint,4,rep,packed,name=received_chunks,json=receivedChunks,proto3" json:"received_chunks,omitempty"`
+	MissingRanges  []*ChunkRange `protobuf:"bytes,5,rep,name=missing_ranges,json=missingRanges,proto3" json:"missing_ranges,omitempty"`
+	ReceivedBytes  int64         `protobuf:"varint,6,opt,name=received_bytes,json=receivedBytes,proto3" json:"received_bytes,omitempty"`
+	TotalBytes     int64         `protobuf:"varint,7,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	Progress       float64       `protobuf:"fixed64,8,opt,name=progress,proto3" json:"progress,omitempty"`
+	FailureReason  string        `protobuf:"bytes,9,opt,name=failure_reason,json=failureReason,proto3" json:"failure_reason,omitempty"`
+	ExpiresAt      int64         `protobuf:"varint,10,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *UploadStatus) Reset() {
+	*x = UploadStatus{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadStatus) ProtoMessage() {}
+
+func (x *UploadStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadStatus.ProtoReflect.Descriptor instead.
+func (*UploadStatus) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UploadStatus) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *UploadStatus) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *UploadStatus) GetTotalChunks() uint32 {
+	if x != nil {
+		return x.TotalChunks
+	}
+	return 0
+}
+
+func (x *UploadStatus) GetReceivedChunks() []uint32 {
+	if x != nil {
+		return x.ReceivedChunks
+	}
+	return nil
+}
+
+func (x *UploadStatus) GetMissingRanges() []*ChunkRange {
+	if x != nil {
+		return x.MissingRanges
+	}
+	return nil
+}
+
+func (x *UploadStatus) GetReceivedBytes() int64 {
+	if x != nil {
+		return x.ReceivedBytes
+	}
+	return 0
+}
+
+func (x *UploadStatus) GetTotalBytes() int64 {
+	if x != nil {
+		return x.TotalBytes
+	}
+	return 0
+}
+
+func (x *UploadStatus) GetProgress() float64 {
+	if x != nil {
+		return x.Progress
+	}
+	return 0
+}
+
+func (x *UploadStatus) GetFailureReason() string {
+	if x != nil {
+		return x.FailureReason
+	}
+	return ""
+}
+
+func (x *UploadStatus) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+type AbortRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UploadId      string                 `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AbortRequest) Reset() {
+	*x = AbortRequest{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AbortRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AbortRequest) ProtoMessage() {}
+
+func (x *AbortRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AbortRequest.ProtoReflect.Descriptor instead.
+func (*AbortRequest) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AbortRequest) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+type AbortResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UploadId      string                 `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	DeletedChunks uint32                 `protobuf:"varint,3,opt,name=deleted_chunks,json=deletedChunks,proto3" json:"deleted_chunks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AbortResponse) Reset() {
+	*x = AbortResponse{}
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AbortResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AbortResponse) ProtoMessage() {}
+
+func (x *AbortResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_uploadspb_uploads_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AbortResponse.ProtoReflect.Descriptor instead.
+func (*AbortResponse) Descriptor() ([]byte, []int) {
+	return file_grpcapi_uploadspb_uploads_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AbortResponse) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *AbortResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *AbortResponse) GetDeletedChunks() uint32 {
+	if x != nil {
+		return x.DeletedChunks
+	}
+	return 0
+}
+
+var File_grpcapi_uploadspb_uploads_proto protoreflect.FileDescriptor
+
+const file_grpcapi_uploadspb_uploads_proto_rawDesc = "" +
+	"\n" +
+	"\x1fgrpcapi/uploadspb/uploads.proto\x12\x11lfusys.uploads.v1\"\xba\x01\n" +
+	"\x13UploadChunksRequest\x12\x1b\n" +
+	"\tupload_id\x18\x01 \x01(\tR\buploadId\x12\x19\n" +
+	"\bchunk_id\x18\x02 \x01(\rR\achunkId\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12%\n" +
+	"\x0ehash_algorithm\x18\x04 \x01(\tR\rhashAlgorithm\x12\x12\n" +
+	"\x04hash\x18\x05 \x01(\fR\x04hash\x12\x1c\n" +
+	"\toverwrite\x18\x06 \x01(\bR\toverwrite\"j\n" +
+	"\vChunkResult\x12\x19\n" +
+	"\bchunk_id\x18\x01 \x01(\rR\achunkId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x12\n" +
+	"\x04code\x18\x03 \x01(\tR\x04code\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"\xf4\x01\n" +
+	"\x14UploadChunksResponse\x12\x1b\n" +
+	"\tupload_id\x18\x01 \x01(\tR\buploadId\x12\x16\n" +
+	"\x06stored\x18\x02 \x01(\rR\x06stored\x12\x1c\n" +
+	"\tunchanged\x18\x03 \x01(\rR\tunchanged\x12\x16\n" +
+	"\x06failed\x18\x04 \x01(\rR\x06failed\x128\n" +
+	"\aresults\x18\x05 \x03(\v2\x1e.lfusys.uploads.v1.ChunkResultR\aresults\x127\n" +
+	"\x06status\x18\x06 \x01(\v2\x1f.lfusys.uploads.v1.UploadStatusR\x06status\"/\n" +
+	"\x10GetStatusRequest\x12\x1b\n" +
+	"\tupload_id\x18\x01 \x01(\tR\buploadId\"4\n" +
+	"\n" +
+	"ChunkRange\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\rR\x03end\"\xff\x02\n" +
+	"\fUploadStatus\x12\x1b\n" +
+	"\tupload_id\x18\x01 \x01(\tR\buploadId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12!\n" +
+	"\ftotal_chunks\x18\x03 \x01(\rR\vtotalChunks\x12'\n" +
+	"\x0freceived_chunks\x18\x04 \x03(\rR\x0ereceivedChunks\x12D\n" +
+	"\x0emissing_ranges\x18\x05 \x03(\v2\x1d.lfusys.uploads.v1.ChunkRangeR\rmissingRanges\x12%\n" +
+	"\x0ereceived_bytes\x18\x06 \x01(\x03R\rreceivedBytes\x12\x1f\n" +
+	"\vtotal_bytes\x18\a \x01(\x03R\n" +
+	"totalBytes\x12\x1a\n" +
+	"\bprogress\x18\b \x01(\x01R\bprogress\x12%\n" +
+	"\x0efailure_reason\x18\t \x01(\tR\rfailureReason\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\n" +
+	" \x01(\x03R\texpiresAt\"+\n" +
+	"\fAbortRequest\x12\x1b\n" +
+	"\tupload_id\x18\x01 \x01(\tR\buploadId\"k\n" +
+	"\rAbortResponse\x12\x1b\n" +
+	"\tupload_id\x18\x01 \x01(\tR\buploadId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12%\n" +
+	"\x0edeleted_chunks\x18\x03 \x01(\rR\rdeletedChunks2\x8b\x02\n" +
+	"\aUploads\x12a\n" +
+	"\fUploadChunks\x12&.lfusys.uploads.v1.UploadChunksRequest\x1a'.lfusys.uploads.v1.UploadChunksResponse(\x01\x12Q\n" +
+	"\tGetStatus\x12#.lfusys.uploads.v1.GetStatusRequest\x1a\x1f.lfusys.uploads.v1.UploadStatus\x12J\n" +
+	"\x05Abort\x12\x1f.lfusys.uploads.v1.AbortRequest\x1a .lfusys.uploads.v1.AbortResponseB@Z>github.com/Yulian302/lfusys-services-uploads/grpcapi/uploadspbb\x06proto3"
+
+var (
+	file_grpcapi_uploadspb_uploads_proto_rawDescOnce sync.Once
+	file_grpcapi_uploadspb_uploads_proto_rawDescData []byte
+)
+
+func file_grpcapi_uploadspb_uploads_proto_rawDescGZIP() []byte {
+	file_grpcapi_uploadspb_uploads_proto_rawDescOnce.Do(func() {
+		file_grpcapi_uploadspb_uploads_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_grpcapi_uploadspb_uploads_proto_rawDesc), len(file_grpcapi_uploadspb_uploads_proto_rawDesc)))
+	})
+	return file_grpcapi_uploadspb_uploads_proto_rawDescData
+}
+
+var file_grpcapi_uploadspb_uploads_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_grpcapi_uploadspb_uploads_proto_goTypes = []any{
+	(*UploadChunksRequest)(nil),  // 0: lfusys.uploads.v1.UploadChunksRequest
+	(*ChunkResult)(nil),          // 1: lfusys.uploads.v1.ChunkResult
+	(*UploadChunksResponse)(nil), // 2: lfusys.uploads.v1.UploadChunksResponse
+	(*GetStatusRequest)(nil),     // 3: lfusys.uploads.v1.GetStatusRequest
+	(*ChunkRange)(nil),           // 4: lfusys.uploads.v1.ChunkRange
+	(*UploadStatus)(nil),         // 5: lfusys.uploads.v1.UploadStatus
+	(*AbortRequest)(nil),         // 6: lfusys.uploads.v1.AbortRequest
+	(*AbortResponse)(nil),        // 7: lfusys.uploads.v1.AbortResponse
+}
+var file_grpcapi_uploadspb_uploads_proto_depIdxs = []int32{
+	1, // 0: lfusys.uploads.v1.UploadChunksResponse.results:type_name -> lfusys.uploads.v1.ChunkResult
+	5, // 1: lfusys.uploads.v1.UploadChunksResponse.status:type_name -> lfusys.uploads.v1.UploadStatus
+	4, // 2: lfusys.uploads.v1.UploadStatus.missing_ranges:type_name -> lfusys.uploads.v1.ChunkRange
+	0, // 3: lfusys.uploads.v1.Uploads.UploadChunks:input_type -> lfusys.uploads.v1.UploadChunksRequest
+	3, // 4: lfusys.uploads.v1.Uploads.GetStatus:input_type -> lfusys.uploads.v1.GetStatusRequest
+	6, // 5: lfusys.uploads.v1.Uploads.Abort:input_type -> lfusys.uploads.v1.AbortRequest
+	2, // 6: lfusys.uploads.v1.Uploads.UploadChunks:output_type -> lfusys.uploads.v1.UploadChunksResponse
+	5, // 7: lfusys.uploads.v1.Uploads.GetStatus:output_type -> lfusys.uploads.v1.UploadStatus
+	7, // 8: lfusys.uploads.v1.Uploads.Abort:output_type -> lfusys.uploads.v1.AbortResponse
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_grpcapi_uploadspb_uploads_proto_init() }
+func file_grpcapi_uploadspb_uploads_proto_init() {
+	if File_grpcapi_uploadspb_uploads_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_grpcapi_uploadspb_uploads_proto_rawDesc), len(file_grpcapi_uploadspb_uploads_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_grpcapi_uploadspb_uploads_proto_goTypes,
+		DependencyIndexes: file_grpcapi_uploadspb_uploads_proto_depIdxs,
+		MessageInfos:      file_grpcapi_uploadspb_uploads_proto_msgTypes,
+	}.Build()
+	File_grpcapi_uploadspb_uploads_proto = out.File
+	file_grpcapi_uploadspb_uploads_proto_goTypes = nil
+	file_grpcapi_uploadspb_uploads_proto_depIdxs = nil
+}
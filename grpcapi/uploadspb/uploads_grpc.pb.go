@@ -0,0 +1,213 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: grpcapi/uploadspb/uploads.proto
+
+package uploadspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Uploads_UploadChunks_FullMethodName = "/lfusys.uploads.v1.Uploads/UploadChunks"
+	Uploads_GetStatus_FullMethodName    = "/lfusys.uploads.v1.Uploads/GetStatus"
+	Uploads_Abort_FullMethodName        = "/lfusys.uploads.v1.Uploads/Abort"
+)
+
+// UploadsClient is the client API for Uploads service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Uploads transfers chunks of upload sessions created over HTTP. Calls carry
+// the bearer token in the authorization metadata, and the SSE-C key of
+// sessions encrypted with one in x-sse-customer-key and x-sse-customer-key-md5.
+// Failures carry a google.rpc.ErrorInfo whose reason is the problem code of
+// the HTTP API.
+type UploadsClient interface {
+	// UploadChunks stores the chunks streamed by the client in one upload
+	// session. Chunks are verified and stored independently, and recorded on
+	// the session once the client closes the stream.
+	UploadChunks(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadChunksRequest, UploadChunksResponse], error)
+	// GetStatus reports which chunks of an upload are stored.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*UploadStatus, error)
+	// Abort cancels an upload and deletes its chunks.
+	Abort(ctx context.Context, in *AbortRequest, opts ...grpc.CallOption) (*AbortResponse, error)
+}
+
+type uploadsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUploadsClient(cc grpc.ClientConnInterface) UploadsClient {
+	return &uploadsClient{cc}
+}
+
+func (c *uploadsClient) UploadChunks(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadChunksRequest, UploadChunksResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Uploads_ServiceDesc.Streams[0], Uploads_UploadChunks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadChunksRequest, UploadChunksResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploads_UploadChunksClient = grpc.ClientStreamingClient[UploadChunksRequest, UploadChunksResponse]
+
+func (c *uploadsClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*UploadStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadStatus)
+	err := c.cc.Invoke(ctx, Uploads_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uploadsClient) Abort(ctx context.Context, in *AbortRequest, opts ...grpc.CallOption) (*AbortResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AbortResponse)
+	err := c.cc.Invoke(ctx, Uploads_Abort_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploadsServer is the server API for Uploads service.
+// All implementations must embed UnimplementedUploadsServer
+// for forward compatibility.
+//
+// Uploads transfers chunks of upload sessions created over HTTP. Calls carry
+// the bearer token in the authorization metadata, and the SSE-C key of
+// sessions encrypted with one in x-sse-customer-key and x-sse-customer-key-md5.
+// Failures carry a google.rpc.ErrorInfo whose reason is the problem code of
+// the HTTP API.
+type UploadsServer interface {
+	// UploadChunks stores the chunks streamed by the client in one upload
+	// session. Chunks are verified and stored independently, and recorded on
+	// the session once the client closes the stream.
+	UploadChunks(grpc.ClientStreamingServer[UploadChunksRequest, UploadChunksResponse]) error
+	// GetStatus reports which chunks of an upload are stored.
+	GetStatus(context.Context, *GetStatusRequest) (*UploadStatus, error)
+	// Abort cancels an upload and deletes its chunks.
+	Abort(context.Context, *AbortRequest) (*AbortResponse, error)
+	mustEmbedUnimplementedUploadsServer()
+}
+
+// UnimplementedUploadsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUploadsServer struct{}
+
+func (UnimplementedUploadsServer) UploadChunks(grpc.ClientStreamingServer[UploadChunksRequest, UploadChunksResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadChunks not implemented")
+}
+func (UnimplementedUploadsServer) GetStatus(context.Context, *GetStatusRequest) (*UploadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedUploadsServer) Abort(context.Context, *AbortRequest) (*AbortResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Abort not implemented")
+}
+func (UnimplementedUploadsServer) mustEmbedUnimplementedUploadsServer() {}
+func (UnimplementedUploadsServer) testEmbeddedByValue()                 {}
+
+// UnsafeUploadsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UploadsServer will
+// result in compilation errors.
+type UnsafeUploadsServer interface {
+	mustEmbedUnimplementedUploadsServer()
+}
+
+func RegisterUploadsServer(s grpc.ServiceRegistrar, srv UploadsServer) {
+	// If the following call pancis, it indicates UnimplementedUploadsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Uploads_ServiceDesc, srv)
+}
+
+func _Uploads_UploadChunks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UploadsServer).UploadChunks(&grpc.GenericServerStream[UploadChunksRequest, UploadChunksResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploads_UploadChunksServer = grpc.ClientStreamingServer[UploadChunksRequest, UploadChunksResponse]
+
+func _Uploads_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploadsServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploads_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploadsServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Uploads_Abort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbortRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploadsServer).Abort(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploads_Abort_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploadsServer).Abort(ctx, req.(*AbortRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Uploads_ServiceDesc is the grpc.ServiceDesc for Uploads service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Uploads_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lfusys.uploads.v1.Uploads",
+	HandlerType: (*UploadsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _Uploads_GetStatus_Handler,
+		},
+		{
+			MethodName: "Abort",
+			Handler:    _Uploads_Abort_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadChunks",
+			Handler:       _Uploads_UploadChunks_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "grpcapi/uploadspb/uploads.proto",
+}
@@ -7,6 +7,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Yulian302/lfusys-services-commons/config"
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
 	_ "github.com/Yulian302/lfusys-services-uploads/docs"
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -22,15 +24,23 @@ import (
 //	@host		localhost:8080
 //	@BasePath	/
 
+//	@securityDefinitions.apikey	BearerAuth
+//	@in							header
+//	@name						Authorization
+//	@description				JWT as "Bearer <token>". S3 clients pass it as X-Amz-Security-Token.
+
 // @externalDocs.description	OpenAPI
 // @externalDocs.url			https://swagger.io/resources/open-api/
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
-	app, err := SetupApp()
+	cfg := config.LoadConfig()
+	appLogger := logger.NewSlogLogger(logger.CreateAppLogger(cfg.Env))
+
+	app, err := SetupApp(cfg, appLogger)
 	if err != nil {
-		app.Logger.Error("app initialization failed", "err", err.Error())
+		appLogger.Error("app initialization failed", "err", err.Error())
 		os.Exit(1)
 	}
 
@@ -42,6 +52,15 @@ func main() {
 		}
 	}()
 
+	if app.Settings.GRPC.Enabled() {
+		app.GRPCServer = BuildGRPCServer(app)
+		go func() {
+			if err := app.RunGRPC(); err != nil {
+				app.Logger.Error("grpc server stopped", "err", err.Error())
+			}
+		}()
+	}
+
 	<-ctx.Done()
 
 	app.Logger.Info("shutdown signal received")
@@ -0,0 +1,109 @@
+// Package problem writes RFC 7807 problem details, the error body of the
+// JSON APIs. Every problem carries a stable code clients branch on, the
+// detail text is for humans and may change.
+package problem
+
+import (
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContentType = "application/problem+json"
+
+	// typePrefix makes a problem type URI of a code.
+	typePrefix = "urn:lfusys:problem:"
+)
+
+// Problem codes. They are part of the API and must not be renamed.
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeUnauthorized   = "unauthorized"
+	CodeInvalidToken   = "invalid_token"
+	CodeForbidden      = "forbidden"
+	CodeRateLimited    = "rate_limited"
+	CodeQuotaExceeded  = "quota_exceeded"
+	CodeInternal       = "internal_error"
+
+	CodeSessionNotFound = "session_not_found"
+	CodeSessionClosed   = "session_closed"
+	CodeChunkNotFound   = "chunk_not_found"
+
+	CodeInvalidChunkID        = "invalid_chunk_id"
+	CodeChunkIndexOutOfRange  = "chunk_index_out_of_range"
+	CodeChunkSizeMismatch     = "chunk_size_mismatch"
+	CodeChunkTooLarge         = "chunk_too_large"
+	CodeEmptyChunk            = "empty_chunk"
+	CodeChunkConflict         = "chunk_conflict"
+	CodeDuplicateChunk        = "duplicate_chunk"
+	CodeLengthRequired        = "length_required"
+	CodeUnsupportedEncoding   = "unsupported_content_encoding"
+	CodeUnsupportedMediaType  = "unsupported_content_type"
+	CodeCompressionRatio      = "compression_ratio_exceeded"
+	CodeInvalidEncodedBody    = "invalid_encoded_body"
+	CodeMalformedBatch        = "malformed_batch"
+	CodeTooManyChunks         = "too_many_chunks"
+	CodeInvalidContentRange   = "invalid_content_range"
+	CodeRangeExceedsFileSize  = "range_exceeds_file_size"
+	CodeOffsetMismatch        = "offset_mismatch"
+	CodePresignNotAvailable   = "presign_not_available"
+	CodeMissingDigest         = "missing_digest"
+	CodeInvalidDigest         = "invalid_digest"
+	CodeUnsupportedAlgorithm  = "unsupported_digest_algorithm"
+	CodeIntegrityMismatch     = "integrity_mismatch"
+	CodeFileIntegrityMismatch = "file_integrity_mismatch"
+
+	CodeEncryptionKeyRequired = "encryption_key_required"
+	CodeEncryptionKeyInvalid  = "encryption_key_invalid"
+	CodeEncryptionKeyMismatch = "encryption_key_mismatch"
+	CodeCustomerKeysDisabled  = "customer_keys_disabled"
+)
+
+// Problem is an RFC 7807 problem details object with the code and request ID
+// as extension members.
+type Problem struct {
+	Type      string `json:"type" example:"urn:lfusys:problem:session_not_found"`
+	Title     string `json:"title" example:"Not Found"`
+	Status    int    `json:"status" example:"404"`
+	Detail    string `json:"detail,omitempty" example:"session not found"`
+	Instance  string `json:"instance,omitempty" example:"/api/v1/upload/abc123"`
+	Code      string `json:"code" example:"session_not_found"`
+	RequestID string `json:"request_id,omitempty" example:"5f0c6a43-2b1e-4f5e-9a55-0c6f5c1b7e21"`
+}
+
+// New describes a failure of the request c is serving.
+func New(c *gin.Context, status int, code string, detail string) Problem {
+	return Problem{
+		Type:      typePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: requestid.FromContext(c.Request.Context()),
+	}
+}
+
+// Write answers the request with a problem.
+func Write(c *gin.Context, status int, code string, detail string) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(status, New(c, status, code, detail))
+}
+
+// Abort answers the request with a problem and stops the handler chain.
+func Abort(c *gin.Context, status int, code string, detail string) {
+	Write(c, status, code, detail)
+	c.Abort()
+}
+
+// BadRequest answers a request with an invalid field, header or body.
+func BadRequest(c *gin.Context, detail string) {
+	Write(c, http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+// Internal answers a request that failed on the side of the service.
+func Internal(c *gin.Context, detail string) {
+	Write(c, http.StatusInternalServerError, CodeInternal, detail)
+}
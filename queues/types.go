@@ -1,5 +1,16 @@
 package queues
 
+const (
+	EventUploadCompleted = "upload_completed"
+	EventUploadAborted   = "upload_aborted"
+)
+
 type UploadCompleteMessage struct {
 	UploadId string `json:"upload_id" binding:"required"`
+	Event    string `json:"event,omitempty"`
+}
+
+type UploadAbortedMessage struct {
+	UploadId string `json:"upload_id" binding:"required"`
+	Event    string `json:"event"`
 }
@@ -14,6 +14,7 @@ import (
 
 type UploadNotify interface {
 	NotifyUploadComplete(ctx context.Context, uploadId string) error
+	NotifyUploadAborted(ctx context.Context, uploadId string) error
 
 	health.ReadinessCheck
 }
@@ -51,7 +52,20 @@ func (q *SQSUploadNotify) Name() string {
 func (q *SQSUploadNotify) NotifyUploadComplete(ctx context.Context, uploadId string) error {
 	messageBody := &UploadCompleteMessage{
 		UploadId: uploadId,
+		Event:    EventUploadCompleted,
 	}
+	return q.send(ctx, uploadId, fmt.Sprintf("dudup-%s", uploadId), messageBody)
+}
+
+func (q *SQSUploadNotify) NotifyUploadAborted(ctx context.Context, uploadId string) error {
+	messageBody := &UploadAbortedMessage{
+		UploadId: uploadId,
+		Event:    EventUploadAborted,
+	}
+	return q.send(ctx, uploadId, fmt.Sprintf("abort-%s", uploadId), messageBody)
+}
+
+func (q *SQSUploadNotify) send(ctx context.Context, uploadId string, deduplicationId string, messageBody any) error {
 	messageBodyStr, err := json.Marshal(messageBody)
 	if err != nil {
 		q.logger.Error("upload notification failed", "reason", "bad message body")
@@ -71,7 +85,7 @@ func (q *SQSUploadNotify) NotifyUploadComplete(ctx context.Context, uploadId str
 				MessageBody: aws.String(string(messageBodyStr)),
 
 				MessageGroupId:         aws.String(uploadId),
-				MessageDeduplicationId: aws.String(fmt.Sprintf("dudup-%s", uploadId)),
+				MessageDeduplicationId: aws.String(deduplicationId),
 			})
 			if err != nil {
 				return err
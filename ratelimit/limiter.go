@@ -0,0 +1,75 @@
+// Package ratelimit throttles API callers with token buckets, one for
+// requests and one for uploaded bytes, kept in memory or in Redis so that
+// several instances share them.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int64
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the state of a bucket after a take.
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	RetryAfter time.Duration // Wait until the take would be allowed, zero when allowed
+	Reset      time.Duration // Wait until the bucket is full again
+}
+
+// RetryAfterSeconds is RetryAfter in whole seconds for a Retry-After value,
+// never less than one.
+func (r Result) RetryAfterSeconds() int64 {
+	return max(1, int64(math.Ceil(r.RetryAfter.Seconds())))
+}
+
+// Limiter takes tokens from the bucket stored under a key. A take of more
+// tokens than the burst is allowed once the bucket is full and leaves it in
+// debt, so large bodies are paced rather than refused forever.
+type Limiter interface {
+	Take(ctx context.Context, key string, n int64, limit Limit) (Result, error)
+}
+
+// bucket is the token bucket arithmetic shared by the limiters. Tokens go
+// negative when a take exceeds what is left.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(now time.Time, n int64, limit Limit) Result {
+	burst := float64(limit.Burst)
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*limit.Rate)
+	}
+	b.last = now
+
+	need := math.Min(float64(n), burst)
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= need {
+		b.tokens -= float64(n)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((need - b.tokens) / limit.Rate)
+	}
+	res.Remaining = max(0, int64(b.tokens))
+	res.Reset = seconds((burst - b.tokens) / limit.Rate)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
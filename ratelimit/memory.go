@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets are dropped from memory.
+const sweepInterval = time.Minute
+
+// MemoryLimiter keeps buckets in process memory. Each instance limits on
+// its own, so N instances together allow N times the limit.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	idleAfter time.Time // When the bucket is full again and can be dropped
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*memoryBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *MemoryLimiter) Take(ctx context.Context, key string, n int64, limit Limit) (Result, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		l.buckets[key] = b
+	}
+	res := b.take(now, n, limit)
+	b.idleAfter = now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep drops buckets that refilled, a new bucket starts full anyway.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.After(b.idleAfter) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
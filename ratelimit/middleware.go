@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/settings"
+	"github.com/gin-gonic/gin"
+)
+
+// bucketCheck is a bucket a request draws from.
+type bucketCheck struct {
+	key   string
+	limit Limit
+}
+
+// Limits are the buckets of a RateLimitConfig.
+type Limits struct {
+	Requests    Limit // Requests per client
+	Bytes       Limit // Uploaded bytes per client
+	UploadBytes Limit // Uploaded bytes per upload session
+}
+
+func NewLimits(cfg *settings.RateLimitConfig) Limits {
+	return Limits{
+		Requests:    Limit{Rate: cfg.RequestsPerSecond, Burst: cfg.RequestsBurst},
+		Bytes:       Limit{Rate: float64(cfg.BytesPerSecond), Burst: cfg.BytesBurst},
+		UploadBytes: Limit{Rate: float64(cfg.UploadBytesPerSecond), Burst: cfg.UploadBytesBurst},
+	}
+}
+
+// Keys of the buckets of a client and of an upload session.
+func RequestsKey(client string) string { return "requests:" + client }
+func BytesKey(client string) string    { return "bytes:" + client }
+func UploadKey(uploadID string) string { return "upload:" + uploadID }
+
+// Middleware throttles callers by request rate and by uploaded bytes, per
+// client and per upload session. Clients are the authenticated user, else
+// the API key in the configured gateway header, else the client IP. Bodies
+// of known length are charged up front and refused with 429 when the bucket
+// is short, bodies of unknown length are paced while they are read. The
+// state of the bucket is reported in RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset. When the limiter fails requests are let through.
+func Middleware(l Limiter, cfg *settings.RateLimitConfig, log logger.Logger) gin.HandlerFunc {
+	limits := NewLimits(cfg)
+	requests, bytes, uploadBytes := limits.Requests, limits.Bytes, limits.UploadBytes
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		client := clientKey(c, cfg.APIKeyHeader)
+
+		if requests.Enabled() {
+			res, err := l.Take(ctx, RequestsKey(client), 1, requests)
+			if err != nil {
+				log.Warn("rate limiter unavailable", "error", err)
+			} else if !setHeaders(c, res) {
+				reject(c, log, client, "requests", res)
+				return
+			}
+		}
+
+		var checks []bucketCheck
+		if bytes.Enabled() {
+			checks = append(checks, bucketCheck{key: BytesKey(client), limit: bytes})
+		}
+		if uploadID := uploadID(c); uploadID != "" && uploadBytes.Enabled() {
+			checks = append(checks, bucketCheck{key: UploadKey(uploadID), limit: uploadBytes})
+		}
+		if len(checks) == 0 || c.Request.Body == nil || c.Request.Body == http.NoBody || c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength < 0 {
+			c.Request.Body = &pacedBody{ReadCloser: c.Request.Body, ctx: ctx, limiter: l, checks: checks, logger: log}
+			c.Next()
+			return
+		}
+
+		for _, check := range checks {
+			res, err := l.Take(ctx, check.key, c.Request.ContentLength, check.limit)
+			if err != nil {
+				log.Warn("rate limiter unavailable", "error", err)
+				continue
+			}
+			if !res.Allowed {
+				setHeaders(c, res)
+				reject(c, log, client, "bytes", res)
+				return
+			}
+			if !requests.Enabled() {
+				setHeaders(c, res)
+			}
+		}
+		c.Next()
+	}
+}
+
+func clientKey(c *gin.Context, apiKeyHeader string) string {
+	apiKey := ""
+	if apiKeyHeader != "" {
+		apiKey = c.GetHeader(apiKeyHeader)
+	}
+	return ClientKey(c.Request.Context(), apiKey, c.ClientIP())
+}
+
+// ClientKey names the client a request is counted against: the
+// authenticated user, else the API key a gateway sent, else the client IP.
+// API keys are hashed so they are never stored.
+func ClientKey(ctx context.Context, apiKey string, ip string) string {
+	if owner := auth.Owner(ctx); owner != "" {
+		return "user:" + owner
+	}
+	if apiKey != "" {
+		sum := sha256.Sum256([]byte(apiKey))
+		return "key:" + hex.EncodeToString(sum[:16])
+	}
+	return "ip:" + ip
+}
+
+// uploadID returns the upload session a request writes to, from the path
+// of the upload and tus routes or the query of the S3 routes.
+func uploadID(c *gin.Context) string {
+	if id := c.Param("uploadId"); id != "" {
+		return id
+	}
+	return c.Query("uploadId")
+}
+
+// setHeaders reports the bucket state and whether the take was allowed.
+func setHeaders(c *gin.Context, res Result) bool {
+	c.Header("RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+	return res.Allowed
+}
+
+func reject(c *gin.Context, log logger.Logger, client string, bucket string, res Result) {
+	log.Warn("rate limit exceeded",
+		"client", client,
+		"bucket", bucket,
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"retry_after", res.RetryAfter,
+	)
+	c.Header("Retry-After", strconv.FormatInt(res.RetryAfterSeconds(), 10))
+	problem.Abort(c, http.StatusTooManyRequests, problem.CodeRateLimited, "rate limit exceeded")
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// pacedBody charges bytes as they are read and waits for the buckets to
+// refill when they run short.
+type pacedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter Limiter
+	checks  []bucketCheck
+	logger  logger.Logger
+}
+
+func (b *pacedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	for _, check := range b.checks {
+		if waitErr := Wait(b.ctx, b.limiter, check.key, int64(n), check.limit, b.logger); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Wait charges n tokens to the bucket stored under key, waiting for it to
+// refill while it is short. It only fails when ctx ends first, a failing
+// limiter lets the tokens through.
+func Wait(ctx context.Context, l Limiter, key string, n int64, limit Limit, log logger.Logger) error {
+	res, err := l.Take(ctx, key, n, limit)
+	for err == nil && !res.Allowed {
+		timer := time.NewTimer(res.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		res, err = l.Take(ctx, key, n, limit)
+	}
+	if err != nil {
+		log.Warn("rate limiter unavailable", "error", err)
+	}
+	return nil
+}
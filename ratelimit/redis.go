@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces the buckets in a shared Redis.
+const keyPrefix = "uploads:ratelimit:"
+
+// takeScript applies the bucket arithmetic of bucket.take atomically on a
+// hash holding the tokens and the refill time. The Redis clock is used so
+// that instances with skewed clocks agree. Tokens are returned in
+// thousandths since Lua numbers are truncated to integers on return.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+elseif now > last then
+	tokens = math.min(burst, tokens + (now - last) * rate)
+end
+
+local need = math.min(n, burst)
+local allowed = 0
+local retry = 0
+if tokens >= need then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = (need - tokens) / rate
+end
+
+local reset = (burst - tokens) / rate
+redis.call("HSET", KEYS[1], "tokens", tokens, "last", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(reset * 1000) + 1000)
+
+return {allowed, math.floor(tokens * 1000), math.ceil(retry * 1000), math.ceil(reset * 1000)}
+`)
+
+// RedisLimiter keeps buckets in Redis so every instance draws from the same
+// buckets.
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+func (l *RedisLimiter) Take(ctx context.Context, key string, n int64, limit Limit) (Result, error) {
+	values, err := takeScript.Run(ctx, l.client, []string{keyPrefix + key}, limit.Rate, limit.Burst, n).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Burst,
+		Remaining:  max(0, values[1]/1000),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+func (l *RedisLimiter) IsReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return l.client.Ping(ctx).Err()
+}
+
+func (l *RedisLimiter) Name() string {
+	return "RateLimiter[redis]"
+}
+
+func (l *RedisLimiter) Shutdown(ctx context.Context) error {
+	return l.client.Close()
+}
@@ -0,0 +1,59 @@
+// Package requestid tags every request with an ID that is echoed in the
+// X-Request-ID response header and in error bodies, so a failed request can
+// be found in the logs.
+package requestid
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	Header = "X-Request-ID"
+
+	// maxLength bounds IDs sent by clients or proxies, longer ones are
+	// replaced.
+	maxLength = 128
+)
+
+type requestIDKey struct{}
+
+// Middleware keeps the X-Request-ID a proxy or client sent when it is
+// printable and short, and generates one otherwise.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !valid(id) {
+			id = uuid.NewString()
+		}
+
+		c.Header(Header, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext returns the ID of the request ctx belongs to, empty outside of
+// a request.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -5,7 +5,12 @@ import (
 
 	"github.com/Yulian302/lfusys-services-commons/health"
 	"github.com/Yulian302/lfusys-services-commons/responses"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/ratelimit"
+	"github.com/Yulian302/lfusys-services-uploads/requestid"
 	"github.com/Yulian302/lfusys-services-uploads/routers"
+	"github.com/Yulian302/lfusys-services-uploads/s3api"
+	"github.com/Yulian302/lfusys-services-uploads/tus"
 	"github.com/Yulian302/lfusys-services-uploads/uploads"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -17,6 +22,7 @@ import (
 func BuildRouter(app *App) *gin.Engine {
 	r := gin.New()
 
+	r.Use(requestid.Middleware())
 	applyCors(r, app)
 	applyTracing(r, app)
 	applySwagger(r, app)
@@ -30,9 +36,23 @@ func applyCors(r *gin.Engine, app *App) {
 	origins := strings.Split(app.Config.CorsConfig.Origins, ",")
 	r.Use(cors.New(
 		cors.Config{
-			AllowOrigins:     origins,
-			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Chunk-Hash"},
+			AllowOrigins: origins,
+			AllowMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowHeaders: []string{
+				"Origin", "Content-Type", "Accept", "Authorization", "X-Chunk-Hash", "Content-Range",
+				"X-Amz-Security-Token",
+				"Content-Digest", "Repr-Digest", "Content-MD5", "X-Chunk-Overwrite", "Content-Encoding",
+				"X-SSE-Customer-Key", "X-SSE-Customer-Key-MD5", "X-Request-ID",
+				"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum",
+			},
+			ExposeHeaders: []string{
+				"X-Chunk-Hash", "X-Chunk-Hash-Algorithm", "X-Chunk-Size", "Range",
+				"Repr-Digest", "Want-Content-Digest", "Accept-Encoding",
+				"WWW-Authenticate", "X-Request-ID",
+				"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Checksum-Algorithm",
+				"Upload-Offset", "Upload-Length", "Upload-Metadata",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+			},
 			AllowCredentials: true,
 		},
 	))
@@ -46,6 +66,24 @@ func applyTracing(r *gin.Engine, app *App) {
 	r.Use(otelgin.Middleware("uploads-service"))
 }
 
+func applyAuth(r *gin.RouterGroup, app *App) {
+	if app.Verifier == nil {
+		return
+	}
+
+	r.Use(auth.Middleware(app.Verifier, app.Logger))
+}
+
+// applyRateLimit runs after auth so authenticated callers are limited per
+// user rather than per IP.
+func applyRateLimit(r *gin.RouterGroup, app *App) {
+	if app.Limiter == nil {
+		return
+	}
+
+	r.Use(ratelimit.Middleware(app.Limiter, app.Settings.RateLimit, app.Logger))
+}
+
 func applySwagger(r *gin.Engine, app *App) {
 	if app.Config.Env == "PROD" {
 		return
@@ -58,18 +96,41 @@ func registerRoutes(r *gin.Engine, app *App) {
 		responses.JSONSuccess(ctx, "ok")
 	})
 
-	health.RegisterHealthRoutes(health.NewHealthHandler(
+	checks := []health.ReadinessCheck{
 		app.Services.Stores.sessions,
 		app.Services.Stores.chunks,
 		app.Services.UploadsNotify,
-	),
-		r,
-	)
+	}
+	if app.Services.Stores.quotas != nil {
+		checks = append(checks, app.Services.Stores.quotas)
+	}
+	if check, ok := app.Limiter.(health.ReadinessCheck); ok {
+		checks = append(checks, check)
+	}
+	if app.Keys != nil {
+		checks = append(checks, app.Keys)
+	}
+	if check, ok := app.Fanout.(health.ReadinessCheck); ok {
+		checks = append(checks, check)
+	}
+	health.RegisterHealthRoutes(health.NewHealthHandler(checks...), r)
 
 	v1 := routers.ApplyApiVersioning("1", r)
+	applyAuth(v1, app)
+	applyRateLimit(v1, app)
 
 	routers.RegisterUploadsRouter(
-		uploads.NewUploadsHandler(app.Services.Uploads, app.Services.Sessions, app.Logger),
+		uploads.NewUploadsHandler(app.Services.Uploads, app.Services.Sessions, app.Services.Streams, app.Settings.Limits.MaxChunkSize, app.Settings.Limits.MaxCompressionRatio, app.Events, app.Settings.Events.Heartbeat, app.Logger),
+		v1,
+	)
+
+	routers.RegisterS3Router(
+		s3api.NewS3Handler(app.Services.Uploads, app.Services.Sessions, app.Settings.Limits.MaxChunkSize, app.Logger),
+		v1,
+	)
+
+	routers.RegisterTusRouter(
+		tus.NewTusHandler(app.Services.Uploads, app.Services.Sessions, app.Services.Streams, app.Logger),
 		v1,
 	)
 }
@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"github.com/Yulian302/lfusys-services-uploads/s3api"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterS3Router(h *s3api.S3Handler, r *gin.RouterGroup) {
+	objects := r.Group("/s3")
+
+	objects.POST("/:bucket/*key", h.Post)
+	objects.PUT("/:bucket/*key", h.Put)
+	objects.GET("/:bucket/*key", h.Get)
+	objects.DELETE("/:bucket/*key", h.Delete)
+}
@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"github.com/Yulian302/lfusys-services-uploads/tus"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterTusRouter(h *tus.TusHandler, r *gin.RouterGroup) {
+	files := r.Group("/files", h.Resumable)
+
+	files.OPTIONS("", h.Options)
+	files.POST("", h.Create)
+	files.HEAD("/:uploadId", h.Head)
+	files.PATCH("/:uploadId", h.Patch)
+	files.DELETE("/:uploadId", h.Terminate)
+}
@@ -8,5 +8,14 @@ import (
 func RegisterUploadsRouter(h *uploads.UploadsHandler, r *gin.RouterGroup) {
 	uploads := r.Group("/upload")
 
+	uploads.POST("", h.Create)
+	uploads.GET("/:uploadId", h.Status)
+	uploads.GET("/:uploadId/events", h.Events)
+	uploads.PUT("/:uploadId", h.Resume)
+	uploads.DELETE("/:uploadId", h.Abort)
+	uploads.POST("/:uploadId/chunks", h.UploadBatch)
 	uploads.PUT("/:uploadId/chunk/:chunkId", h.Upload)
+	uploads.HEAD("/:uploadId/chunk/:chunkId", h.HeadChunk)
+	uploads.POST("/:uploadId/chunk/:chunkId/presign", h.PresignChunk)
+	uploads.POST("/:uploadId/chunk/:chunkId/confirm", h.ConfirmChunk)
 }
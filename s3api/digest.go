@@ -0,0 +1,42 @@
+package s3api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"hash"
+	"io"
+)
+
+var errBadDigest = errors.New("body does not match Content-MD5")
+
+// md5Reader hashes a body of a known size with MD5. When the client sent a
+// Content-MD5 it fails the read that completes the body if the sums differ,
+// so the store call fails before the part replaces the stored one.
+type md5Reader struct {
+	r         io.Reader
+	hash      hash.Hash
+	remaining int64
+	expected  []byte
+	mismatch  bool
+}
+
+func newMD5Reader(r io.Reader, size int64, expected []byte) *md5Reader {
+	return &md5Reader{r: r, hash: md5.New(), remaining: size, expected: expected}
+}
+
+func (m *md5Reader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.hash.Write(p[:n])
+	m.remaining -= int64(n)
+	if n > 0 && m.remaining == 0 && m.expected != nil && !bytes.Equal(m.hash.Sum(nil), m.expected) {
+		m.mismatch = true
+		return n, errBadDigest
+	}
+	return n, err
+}
+
+// Sum returns the MD5 of the body read so far.
+func (m *md5Reader) Sum() []byte {
+	return m.hash.Sum(nil)
+}
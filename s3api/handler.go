@@ -0,0 +1,780 @@
+package s3api
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apperror "github.com/Yulian302/lfusys-services-commons/errors"
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxCompleteBodySize bounds the CompleteMultipartUpload document, which
+// lists at most 10000 parts.
+const maxCompleteBodySize = 2 << 20
+
+// S3Handler exposes upload sessions through the subset of the S3 API that
+// multipart clients use. Every part is stored as one chunk of the session,
+// part N being chunk N-1.
+type S3Handler struct {
+	uploadService  services.UploadService
+	sessionService services.SessionService
+	maxChunkSize   int64
+
+	logger logger.Logger
+}
+
+func NewS3Handler(uploadService services.UploadService, sessionService services.SessionService, maxChunkSize int64, l logger.Logger) *S3Handler {
+	return &S3Handler{
+		uploadService:  uploadService,
+		sessionService: sessionService,
+		maxChunkSize:   maxChunkSize,
+		logger:         l,
+	}
+}
+
+// Post godoc
+//
+//	@Summary		CreateMultipartUpload and CompleteMultipartUpload
+//	@Description	With ?uploads starts a multipart upload, with ?uploadId completes it from the listed parts
+//	@Tags			s3
+//	@Accept			xml
+//	@Produce		xml
+//	@Param			bucket											path		string							true	"Bucket name"
+//	@Param			key												path		string							true	"Object key"
+//	@Param			uploads											query		string							false	"Start a multipart upload"
+//	@Param			uploadId										query		string							false	"Upload to complete"
+//	@Param			request											body		CompleteMultipartUpload			false	"Parts to complete"
+//	@Param			x-amz-server-side-encryption-customer-algorithm	header		string							false	"AES256 for SSE-C uploads"
+//	@Param			x-amz-server-side-encryption-customer-key		header		string							false	"Base64 SSE-C key of the upload"
+//	@Param			x-amz-server-side-encryption-customer-key-MD5	header		string							false	"Base64 MD5 of the SSE-C key"
+//	@Success		200												{object}	CompleteMultipartUploadResult	"Upload initiated or completed"
+//	@Failure		400												{object}	Error							"Invalid request, part or SSE-C key"
+//	@Failure		401												{object}	Error							"Missing or invalid token"
+//	@Failure		403												{object}	Error							"Access denied or SSE-C key does not match the upload"
+//	@Failure		404												{object}	Error							"Upload not found"
+//	@Failure		429												{object}	Error							"Open session quota exceeded"
+//	@Failure		500												{object}	Error							"Internal error"
+//	@Security		BearerAuth
+//	@Router			/s3/{bucket}/{key} [post]
+func (h *S3Handler) Post(c *gin.Context) {
+	if _, ok := c.GetQuery("uploads"); ok {
+		h.createMultipartUpload(c)
+		return
+	}
+	if _, ok := c.GetQuery("uploadId"); ok {
+		h.completeMultipartUpload(c)
+		return
+	}
+	h.writeError(c, http.StatusNotImplemented, "NotImplemented", "operation not supported")
+}
+
+// Put godoc
+//
+//	@Summary		UploadPart and PutObject
+//	@Description	With ?partNumber and ?uploadId uploads one part, without them stores the body as a single part upload
+//	@Tags			s3
+//	@Accept			octet-stream
+//	@Produce		xml
+//	@Param			bucket											path	string	true	"Bucket name"
+//	@Param			key												path	string	true	"Object key"
+//	@Param			partNumber										query	int		false	"Part number between 1 and 10000"
+//	@Param			uploadId										query	string	false	"Multipart upload ID"
+//	@Param			Content-MD5										header	string	false	"Base64 MD5 of the body"
+//	@Param			x-amz-content-sha256							header	string	false	"Hex SHA256 of the body"
+//	@Param			x-amz-server-side-encryption-customer-algorithm	header	string	false	"AES256 for SSE-C uploads"
+//	@Param			x-amz-server-side-encryption-customer-key		header	string	false	"Base64 SSE-C key of the upload"
+//	@Param			x-amz-server-side-encryption-customer-key-MD5	header	string	false	"Base64 MD5 of the SSE-C key"
+//	@Success		200
+//	@Header			200	{string}	ETag	"MD5 of the part, or the S3 ETag of SSE-KMS and SSE-C parts"
+//	@Failure		400	{object}	Error	"Invalid request, digest mismatch or invalid SSE-C key"
+//	@Failure		401	{object}	Error	"Missing or invalid token"
+//	@Failure		403	{object}	Error	"Access denied or SSE-C key does not match the upload"
+//	@Failure		404	{object}	Error	"Upload not found"
+//	@Failure		411	{object}	Error	"Content length required"
+//	@Failure		413	{object}	Error	"Part or object larger than the maximum chunk size or the byte quota"
+//	@Failure		429	{object}	Error	"Open session or byte quota exceeded"
+//	@Failure		500	{object}	Error	"Internal error"
+//	@Security		BearerAuth
+//	@Router			/s3/{bucket}/{key} [put]
+func (h *S3Handler) Put(c *gin.Context) {
+	if c.GetHeader("X-Amz-Copy-Source") != "" {
+		h.writeError(c, http.StatusNotImplemented, "NotImplemented", "copy is not supported")
+		return
+	}
+	if _, ok := c.GetQuery("uploadId"); ok {
+		h.uploadPart(c)
+		return
+	}
+	h.putObject(c)
+}
+
+// Get godoc
+//
+//	@Summary		ListParts
+//	@Description	List the parts stored for a multipart upload
+//	@Tags			s3
+//	@Produce		xml
+//	@Param			bucket											path		string			true	"Bucket name"
+//	@Param			key												path		string			true	"Object key"
+//	@Param			uploadId										query		string			true	"Multipart upload ID"
+//	@Param			max-parts										query		int				false	"Maximum parts to return"
+//	@Param			part-number-marker								query		int				false	"List parts after this number"
+//	@Param			x-amz-server-side-encryption-customer-algorithm	header		string			false	"AES256 for SSE-C uploads"
+//	@Param			x-amz-server-side-encryption-customer-key		header		string			false	"Base64 SSE-C key of the upload"
+//	@Param			x-amz-server-side-encryption-customer-key-MD5	header		string			false	"Base64 MD5 of the SSE-C key"
+//	@Success		200												{object}	ListPartsResult	"Stored parts"
+//	@Failure		400												{object}	Error			"Missing or invalid SSE-C key"
+//	@Failure		401												{object}	Error			"Missing or invalid token"
+//	@Failure		403												{object}	Error			"Access denied or SSE-C key does not match the upload"
+//	@Failure		404												{object}	Error			"Upload not found"
+//	@Failure		500												{object}	Error			"Internal error"
+//	@Security		BearerAuth
+//	@Router			/s3/{bucket}/{key} [get]
+func (h *S3Handler) Get(c *gin.Context) {
+	if _, ok := c.GetQuery("uploadId"); ok {
+		h.listParts(c)
+		return
+	}
+	h.writeError(c, http.StatusNotImplemented, "NotImplemented", "operation not supported")
+}
+
+// Delete godoc
+//
+//	@Summary		AbortMultipartUpload
+//	@Description	Abort a multipart upload and delete its parts
+//	@Tags			s3
+//	@Produce		xml
+//	@Param			bucket		path	string	true	"Bucket name"
+//	@Param			key			path	string	true	"Object key"
+//	@Param			uploadId	query	string	true	"Multipart upload ID"
+//	@Success		204
+//	@Failure		401	{object}	Error	"Missing or invalid token"
+//	@Failure		403	{object}	Error	"Access denied"
+//	@Failure		404	{object}	Error	"Upload not found"
+//	@Failure		500	{object}	Error	"Internal error"
+//	@Security		BearerAuth
+//	@Router			/s3/{bucket}/{key} [delete]
+func (h *S3Handler) Delete(c *gin.Context) {
+	if _, ok := c.GetQuery("uploadId"); ok {
+		h.abortMultipartUpload(c)
+		return
+	}
+	h.writeError(c, http.StatusNotImplemented, "NotImplemented", "operation not supported")
+}
+
+func (h *S3Handler) createMultipartUpload(c *gin.Context) {
+	bucket, key := c.Param("bucket"), objectKey(c)
+	if key == "" {
+		h.writeError(c, http.StatusBadRequest, "InvalidArgument", "object key is required")
+		return
+	}
+
+	customerKey, err := customerKey(c)
+	if err != nil {
+		h.writeEncryptionError(c, err)
+		return
+	}
+
+	session, err := h.sessionService.CreateSession(c.Request.Context(), services.SessionParams{
+		FileName:    key,
+		DeferLength: true,
+		CustomerKey: customerKey,
+	})
+	if err != nil {
+		if h.writeQuotaError(c, err) || h.writeEncryptionError(c, err) {
+			return
+		}
+		h.logger.Error("create multipart upload failed",
+			"key", key,
+			"error", err,
+		)
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not create upload")
+		return
+	}
+
+	setEncryptionHeaders(c, session)
+	c.XML(http.StatusOK, InitiateMultipartUploadResult{
+		Xmlns:    xmlns,
+		Bucket:   bucket,
+		Key:      key,
+		UploadId: session.UploadID,
+	})
+}
+
+func (h *S3Handler) uploadPart(c *gin.Context) {
+	uploadId := c.Query("uploadId")
+	partNumber, err := strconv.Atoi(c.Query("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		h.writeError(c, http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("part number must be between 1 and %d", maxPartNumber))
+		return
+	}
+
+	session, ok := h.lookupSession(c, uploadId)
+	if !ok {
+		return
+	}
+
+	body, size, ok := h.partBody(c)
+	if !ok {
+		return
+	}
+	if limit := session.ChunkLimit(uint32(partNumber-1), h.maxChunkSize); size > limit {
+		h.writeError(c, http.StatusRequestEntityTooLarge, "EntityTooLarge", fmt.Sprintf("part exceeds the maximum size of %d bytes", limit))
+		return
+	}
+	if !h.checkPartSize(c, session, uint32(partNumber-1), size) {
+		return
+	}
+
+	etag, stored, ok := h.storePart(c, uploadId, uint32(partNumber-1), body, size)
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.MarkChunkComplete(c.Request.Context(), uploadId, stored); err != nil {
+		if h.writeRecordError(c, err) {
+			return
+		}
+		h.logger.Error("upload part failed",
+			"upload_id", uploadId,
+			"part_number", partNumber,
+			"error", err,
+		)
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not record part")
+		return
+	}
+
+	setEncryptionHeaders(c, session)
+	c.Header("ETag", etag)
+	c.Status(http.StatusOK)
+}
+
+func (h *S3Handler) putObject(c *gin.Context) {
+	key := objectKey(c)
+	if key == "" {
+		h.writeError(c, http.StatusBadRequest, "InvalidArgument", "object key is required")
+		return
+	}
+
+	body, size, ok := h.partBody(c)
+	if !ok {
+		return
+	}
+	if size == 0 {
+		h.writeError(c, http.StatusBadRequest, "InvalidArgument", "empty objects are not supported")
+		return
+	}
+	if size > h.maxChunkSize {
+		h.writeError(c, http.StatusRequestEntityTooLarge, "EntityTooLarge", fmt.Sprintf("object exceeds the maximum size of %d bytes for a single PUT, use a multipart upload", h.maxChunkSize))
+		return
+	}
+
+	customerKey, err := customerKey(c)
+	if err != nil {
+		h.writeEncryptionError(c, err)
+		return
+	}
+
+	session, err := h.sessionService.CreateSession(c.Request.Context(), services.SessionParams{
+		FileName:    key,
+		FileSize:    size,
+		ChunkSize:   size,
+		CustomerKey: customerKey,
+	})
+	if err != nil {
+		if h.writeQuotaError(c, err) || h.writeEncryptionError(c, err) {
+			return
+		}
+		h.logger.Error("put object failed",
+			"key", key,
+			"error", err,
+		)
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not create upload")
+		return
+	}
+
+	// the session was created with the key of this request, so only
+	// unwrapping its data key can fail
+	var (
+		etag   string
+		stored store.ChunkHash
+	)
+	ok = h.applyEncryption(c, session)
+	if ok {
+		etag, stored, ok = h.storePart(c, session.UploadID, 0, body, size)
+	}
+	if !ok {
+		// the session was only for this request, release its quota
+		if err := h.sessionService.AbortUpload(c.Request.Context(), session.UploadID); err != nil {
+			h.logger.Warn("failed to abort unused upload session",
+				"upload_id", session.UploadID,
+				"error", err,
+			)
+		}
+		return
+	}
+
+	if err := h.sessionService.MarkChunkComplete(c.Request.Context(), session.UploadID, stored); err != nil {
+		if h.writeRecordError(c, err) {
+			return
+		}
+		h.logger.Error("put object failed",
+			"upload_id", session.UploadID,
+			"error", err,
+		)
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not record object")
+		return
+	}
+
+	setEncryptionHeaders(c, session)
+	c.Header("ETag", etag)
+	c.Status(http.StatusOK)
+}
+
+func (h *S3Handler) listParts(c *gin.Context) {
+	bucket, key := c.Param("bucket"), objectKey(c)
+	uploadId := c.Query("uploadId")
+
+	maxParts := defaultMaxParts
+	if v, ok := c.GetQuery("max-parts"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			h.writeError(c, http.StatusBadRequest, "InvalidArgument", "invalid max-parts")
+			return
+		}
+		maxParts = min(n, defaultMaxParts)
+	}
+
+	marker := 0
+	if v, ok := c.GetQuery("part-number-marker"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			h.writeError(c, http.StatusBadRequest, "InvalidArgument", "invalid part-number-marker")
+			return
+		}
+		marker = n
+	}
+
+	session, ok := h.lookupSession(c, uploadId)
+	if !ok {
+		return
+	}
+
+	result := ListPartsResult{
+		Xmlns:            xmlns,
+		Bucket:           bucket,
+		Key:              key,
+		UploadId:         uploadId,
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+		Parts:            []Part{},
+	}
+
+	for _, idx := range session.ReceivedChunks() {
+		partNumber := int(idx) + 1
+		if partNumber <= marker {
+			continue
+		}
+		if len(result.Parts) == maxParts {
+			result.IsTruncated = true
+			break
+		}
+
+		info, err := h.uploadService.GetChunk(c.Request.Context(), uploadId, idx)
+		if err != nil {
+			if errors.Is(err, store.ErrChunkNotFound) {
+				continue
+			}
+			h.writeError(c, http.StatusInternalServerError, "InternalError", "could not list parts")
+			return
+		}
+
+		result.Parts = append(result.Parts, Part{
+			PartNumber: partNumber,
+			ETag:       info.ETag,
+			Size:       info.Size,
+		})
+		result.NextPartNumberMarker = partNumber
+	}
+
+	c.XML(http.StatusOK, result)
+}
+
+func (h *S3Handler) completeMultipartUpload(c *gin.Context) {
+	bucket, key := c.Param("bucket"), objectKey(c)
+	uploadId := c.Query("uploadId")
+
+	var req CompleteMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(c.Request.Body, maxCompleteBodySize)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		h.writeError(c, http.StatusBadRequest, "MalformedXML", "invalid part list")
+		return
+	}
+
+	session, ok := h.lookupSession(c, uploadId)
+	if !ok {
+		return
+	}
+
+	chunks := make([]uint32, 0, len(req.Parts))
+	partHashes := make([]byte, 0, len(req.Parts)*md5.Size)
+	var fileSize, partSize int64
+
+	for i, part := range req.Parts {
+		if i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber {
+			h.writeError(c, http.StatusBadRequest, "InvalidPartOrder", "parts must be listed in ascending order")
+			return
+		}
+		if part.PartNumber < 1 || part.PartNumber > maxPartNumber {
+			h.writeError(c, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("invalid part number %d", part.PartNumber))
+			return
+		}
+
+		idx := uint32(part.PartNumber - 1)
+		info, err := h.uploadService.GetChunk(c.Request.Context(), uploadId, idx)
+		if err != nil {
+			if errors.Is(err, store.ErrChunkNotFound) {
+				h.writeError(c, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d was not uploaded", part.PartNumber))
+				return
+			}
+			h.writeError(c, http.StatusInternalServerError, "InternalError", "could not read parts")
+			return
+		}
+		if unquote(info.ETag) != unquote(part.ETag) {
+			h.writeError(c, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("ETag of part %d does not match", part.PartNumber))
+			return
+		}
+
+		// the object is laid out in chunks of the size of part 1, only the
+		// last part may be shorter
+		if i == 0 {
+			partSize = info.Size
+		}
+		last := i == len(req.Parts)-1
+		if (!last && info.Size != partSize) || (last && info.Size > partSize) {
+			h.writeError(c, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d is %d bytes, every part but the last must be %d bytes like part 1", part.PartNumber, info.Size, partSize))
+			return
+		}
+
+		sum, err := hex.DecodeString(unquote(info.ETag))
+		if err != nil {
+			h.writeError(c, http.StatusInternalServerError, "InternalError", "unexpected part ETag")
+			return
+		}
+
+		chunks = append(chunks, idx)
+		partHashes = append(partHashes, sum...)
+		fileSize += info.Size
+	}
+
+	discarded, err := h.sessionService.CompleteUpload(c.Request.Context(), uploadId, fileSize, partSize, chunks)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrChunkSize):
+			h.writeError(c, http.StatusBadRequest, "InvalidPart", "parts do not share the size of part 1")
+		case errors.Is(err, services.ErrUploadIncomplete):
+			h.writeError(c, http.StatusBadRequest, "InvalidPart", "parts must be numbered from 1 without gaps")
+		case errors.Is(err, auth.ErrForbidden):
+			h.writeError(c, http.StatusForbidden, "AccessDenied", "upload belongs to another user")
+		case noSuchUpload(err):
+			h.writeError(c, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		default:
+			h.logger.Error("complete multipart upload failed",
+				"upload_id", uploadId,
+				"error", err,
+			)
+			h.writeError(c, http.StatusInternalServerError, "InternalError", "could not complete upload")
+		}
+		return
+	}
+
+	for _, idx := range discarded {
+		if err := h.uploadService.DeleteChunk(c.Request.Context(), uploadId, idx); err != nil {
+			h.logger.Warn("failed to delete part left out of the upload",
+				"upload_id", uploadId,
+				"part_number", idx+1,
+				"error", err,
+			)
+		}
+	}
+
+	etag := md5.Sum(partHashes)
+	setEncryptionHeaders(c, session)
+	c.XML(http.StatusOK, CompleteMultipartUploadResult{
+		Xmlns:    xmlns,
+		Location: location(c),
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(etag[:]), len(req.Parts)),
+	})
+}
+
+func (h *S3Handler) abortMultipartUpload(c *gin.Context) {
+	uploadId := c.Query("uploadId")
+
+	if err := h.sessionService.AbortUpload(c.Request.Context(), uploadId); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			h.writeError(c, http.StatusForbidden, "AccessDenied", "upload belongs to another user")
+			return
+		}
+		if noSuchUpload(err) {
+			h.writeError(c, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+			return
+		}
+		h.logger.Error("abort multipart upload failed",
+			"upload_id", uploadId,
+			"error", err,
+		)
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not abort upload")
+		return
+	}
+
+	if _, err := h.uploadService.DeleteUpload(c.Request.Context(), uploadId); err != nil {
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not delete parts")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// checkPartSize rejects a part that cannot fit the layout set by part 1:
+// every part but the last has the size of part 1, so a later part is never
+// larger and a shorter one has to be the last. Parts sent before part 1 are
+// checked when the upload completes.
+func (h *S3Handler) checkPartSize(c *gin.Context, session *store.UploadSession, idx uint32, size int64) bool {
+	if idx == 0 {
+		return true
+	}
+	first, err := h.uploadService.GetChunk(c.Request.Context(), session.UploadID, 0)
+	if err != nil {
+		if errors.Is(err, store.ErrChunkNotFound) {
+			return true
+		}
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not read parts")
+		return false
+	}
+
+	if size > first.Size {
+		h.writeError(c, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part is %d bytes, parts after part 1 must not exceed its %d bytes", size, first.Size))
+		return false
+	}
+	if size < first.Size {
+		for _, received := range session.ReceivedChunks() {
+			if received > idx {
+				h.writeError(c, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part is %d bytes, only the last part may be shorter than the %d bytes of part 1", size, first.Size))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookupSession loads an open session that was created for the requested
+// key, answering NoSuchUpload otherwise. The customer key of SSE-C sessions
+// has to come with the request.
+func (h *S3Handler) lookupSession(c *gin.Context, uploadId string) (*store.UploadSession, bool) {
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			h.writeError(c, http.StatusForbidden, "AccessDenied", "upload belongs to another user")
+			return nil, false
+		}
+		if errors.Is(err, apperror.ErrSessionNotFound) {
+			h.writeError(c, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+			return nil, false
+		}
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not load upload")
+		return nil, false
+	}
+
+	if session.FileName != objectKey(c) || session.CheckWritable(time.Now()) != nil {
+		h.writeError(c, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return nil, false
+	}
+	if !h.applyEncryption(c, session) {
+		return nil, false
+	}
+	return session, true
+}
+
+// noSuchUpload reports whether err means the upload is missing or no longer
+// accepts parts, which S3 reports as NoSuchUpload.
+func noSuchUpload(err error) bool {
+	return errors.Is(err, apperror.ErrSessionNotFound) ||
+		errors.Is(err, store.ErrSessionCompleted) ||
+		errors.Is(err, store.ErrSessionAborted) ||
+		errors.Is(err, store.ErrSessionFailed) ||
+		errors.Is(err, store.ErrSessionExpired)
+}
+
+// writeRecordError answers a part that was stored but could not be recorded
+// because the upload is gone, belongs to another user, exceeds a quota or
+// failed verification once complete. It reports false for other errors.
+func (h *S3Handler) writeRecordError(c *gin.Context, err error) bool {
+	if h.writeQuotaError(c, err) {
+		return true
+	}
+	switch {
+	case errors.Is(err, services.ErrFileIntegrity):
+		h.writeError(c, http.StatusBadRequest, "BadDigest", "assembled object does not match its digests")
+	case errors.Is(err, auth.ErrForbidden):
+		h.writeError(c, http.StatusForbidden, "AccessDenied", "upload belongs to another user")
+	case noSuchUpload(err):
+		h.writeError(c, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+	default:
+		return false
+	}
+	return true
+}
+
+// writeQuotaError answers a request that would exceed a quota of the caller,
+// EntityTooLarge when it can never fit and QuotaExceeded otherwise. It
+// reports false when err is not a quota error.
+func (h *S3Handler) writeQuotaError(c *gin.Context, err error) bool {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	h.logger.Warn("s3 upload quota exceeded",
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"quota", quotaErr.Quota,
+	)
+	code := "QuotaExceeded"
+	if quotaErr.Status() == http.StatusRequestEntityTooLarge {
+		code = "EntityTooLarge"
+	}
+	if seconds := quotaErr.RetryAfterSeconds(); seconds > 0 {
+		c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	h.writeError(c, quotaErr.Status(), code, quotaErr.Error())
+	return true
+}
+
+// storePart streams the request body into the chunk, verifying the SHA256
+// and MD5 digests the client sent before it replaces a stored part, and
+// returns the part ETag and the chunk hash to record.
+func (h *S3Handler) storePart(c *gin.Context, uploadId string, chunkId uint32, body io.Reader, size int64) (string, store.ChunkHash, bool) {
+	// unsigned and streaming payloads carry no body hash
+	var expected *digest.Digest
+	if sum, err := hex.DecodeString(c.GetHeader("X-Amz-Content-Sha256")); err == nil && len(sum) == digest.SHA256.Size {
+		expected = &digest.Digest{Algorithm: digest.SHA256, Sum: sum}
+	}
+
+	var contentMD5 []byte
+	if value := c.GetHeader("Content-MD5"); value != "" {
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(sum) != md5.Size {
+			h.writeError(c, http.StatusBadRequest, "InvalidDigest", "Content-MD5 is not a base64 MD5")
+			return "", store.ChunkHash{}, false
+		}
+		contentMD5 = sum
+	}
+
+	// aws-chunked bodies are only bounded by their declared decoded length
+	body = http.MaxBytesReader(c.Writer, io.NopCloser(body), size)
+
+	md5Body := newMD5Reader(body, size, contentMD5)
+	computed, err := h.uploadService.Upload(c.Request.Context(), uploadId, chunkId, md5Body, size, expected)
+	if err != nil {
+		if md5Body.mismatch {
+			h.writeError(c, http.StatusBadRequest, "BadDigest", errBadDigest.Error())
+			return "", store.ChunkHash{}, false
+		}
+		if errors.Is(err, services.ErrIntegrity) {
+			h.writeError(c, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "body does not match x-amz-content-sha256")
+			return "", store.ChunkHash{}, false
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.writeError(c, http.StatusRequestEntityTooLarge, "EntityTooLarge", fmt.Sprintf("body exceeds its declared size of %d bytes", maxBytesErr.Limit))
+			return "", store.ChunkHash{}, false
+		}
+		if h.writeQuotaError(c, err) {
+			return "", store.ChunkHash{}, false
+		}
+		h.logger.Error("store part failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"error", err,
+		)
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not store part")
+		return "", store.ChunkHash{}, false
+	}
+
+	etag := fmt.Sprintf("\"%s\"", hex.EncodeToString(md5Body.Sum()))
+	encryption := store.EncryptionFromContext(c.Request.Context())
+	if encryption.Mode == store.EncryptionKMS || encryption.Mode == store.EncryptionCustom || encryption.DataKey != nil {
+		// the ETag S3 keeps for these objects is not the MD5 of the part, and
+		// parts are listed and completed with the stored one
+		info, err := h.uploadService.GetChunk(c.Request.Context(), uploadId, chunkId)
+		if err != nil {
+			h.writeError(c, http.StatusInternalServerError, "InternalError", "could not store part")
+			return "", store.ChunkHash{}, false
+		}
+		etag = info.ETag
+	}
+
+	return etag, store.NewChunkHash(chunkId, computed), true
+}
+
+// partBody unwraps aws-chunked bodies and reports the decoded body size.
+func (h *S3Handler) partBody(c *gin.Context) (io.Reader, int64, bool) {
+	if strings.Contains(c.GetHeader("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(c.GetHeader("X-Amz-Content-Sha256"), "STREAMING-") {
+		size, err := strconv.ParseInt(c.GetHeader("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || size < 0 {
+			h.writeError(c, http.StatusLengthRequired, "MissingContentLength", "x-amz-decoded-content-length is required")
+			return nil, 0, false
+		}
+		return newAWSChunkedReader(c.Request.Body), size, true
+	}
+
+	if c.Request.ContentLength < 0 {
+		h.writeError(c, http.StatusLengthRequired, "MissingContentLength", "content length is required")
+		return nil, 0, false
+	}
+	return c.Request.Body, c.Request.ContentLength, true
+}
+
+func (h *S3Handler) writeError(c *gin.Context, status int, code string, message string) {
+	requestId := uuid.NewString()
+	c.Header("x-amz-request-id", requestId)
+	c.XML(status, Error{
+		Code:      code,
+		Message:   message,
+		Resource:  c.Request.URL.Path,
+		RequestId: requestId,
+	})
+}
+
+func objectKey(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("key"), "/")
+}
+
+func location(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, c.Request.URL.Path)
+}
+
+func unquote(etag string) string {
+	return strings.Trim(etag, "\"")
+}
@@ -0,0 +1,91 @@
+package s3api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseHeader                  = "X-Amz-Server-Side-Encryption"
+	sseKMSKeyIDHeader          = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+	sseCustomerAlgorithmHeader = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
+	sseCustomerKeyHeader       = "X-Amz-Server-Side-Encryption-Customer-Key"
+	sseCustomerKeyMD5Header    = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+
+	sseCustomerAlgorithm = "AES256"
+)
+
+// customerKeyHeaders carry the SSE-C key of a request. S3 only knows AES256
+// customer keys.
+var customerKeyHeaders = store.CustomerKeyHeaders{
+	Key:       sseCustomerKeyHeader,
+	KeyMD5:    sseCustomerKeyMD5Header,
+	Algorithm: sseCustomerAlgorithmHeader,
+}
+
+// customerKey returns the SSE-C key sent with the request, nil when it sent
+// none.
+func customerKey(c *gin.Context) ([]byte, error) {
+	return customerKeyHeaders.CustomerKey(c.Request.Header)
+}
+
+// applyEncryption makes the part reads and writes of the request use the
+// encryption of the session, answering the request and reporting false when
+// the customer key is missing or wrong.
+func (h *S3Handler) applyEncryption(c *gin.Context, session *store.UploadSession) bool {
+	key, err := customerKey(c)
+	if err == nil {
+		var encryption store.Encryption
+		if encryption, err = h.sessionService.ChunkEncryption(c.Request.Context(), session, key); err == nil {
+			c.Request = c.Request.WithContext(store.WithEncryption(c.Request.Context(), encryption))
+			return true
+		}
+	}
+	if !h.writeEncryptionError(c, err) {
+		h.writeError(c, http.StatusInternalServerError, "InternalError", "could not load upload encryption key")
+	}
+	return false
+}
+
+// writeEncryptionError answers a request with a missing, invalid or wrong
+// customer key. It reports false when err is not about the key.
+func (h *S3Handler) writeEncryptionError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrCustomerKeyMismatch):
+		h.writeError(c, http.StatusForbidden, "AccessDenied", err.Error())
+	case errors.Is(err, store.ErrCustomerKeyRequired):
+		h.writeError(c, http.StatusBadRequest, "InvalidRequest", err.Error())
+	case errors.Is(err, store.ErrInvalidCustomerKey), errors.Is(err, services.ErrCustomerKeysDisabled):
+		h.writeError(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+	default:
+		return false
+	}
+
+	h.logger.Warn("s3 encryption key rejected",
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"error", err,
+	)
+	return true
+}
+
+// setEncryptionHeaders reports the encryption of the session the way S3
+// does on writes.
+func setEncryptionHeaders(c *gin.Context, session *store.UploadSession) {
+	switch session.Encryption {
+	case store.EncryptionS3:
+		c.Header(sseHeader, store.EncryptionS3)
+	case store.EncryptionKMS:
+		c.Header(sseHeader, store.EncryptionKMS)
+		if session.KMSKeyID != "" {
+			c.Header(sseKMSKeyIDHeader, session.KMSKeyID)
+		}
+	case store.EncryptionCustom:
+		c.Header(sseCustomerAlgorithmHeader, sseCustomerAlgorithm)
+		c.Header(sseCustomerKeyMD5Header, session.CustomerKeyMD5)
+	}
+}
@@ -13,6 +13,7 @@ import (
 type Stores struct {
 	chunks   store.ChunkStore
 	sessions store.UploadsStore
+	quotas   store.QuotaStore
 
 	logger logger.Logger
 }
@@ -20,6 +21,7 @@ type Stores struct {
 type Services struct {
 	Uploads       services.UploadService
 	Sessions      services.SessionService
+	Streams       services.StreamService
 	UploadsNotify queues.UploadNotify
 
 	Stores *Stores
@@ -35,20 +37,31 @@ func BuildServices(app *App) *Services {
 	chunkStore := store.NewS3ChunkStore(app.S3, app.Config.AWSConfig.BucketName)
 	sessionStore := store.NewDynamoDbUploadsStore(app.DynamoDB, app.Config.DynamoDBConfig.UploadsTableName)
 
-	uploadService := services.NewUploadServiceImpl(chunkStore, app.Logger)
-	sessionService := services.NewSessionServiceImpl(sessionStore, upNotifyQueue, app.Logger)
+	var quotaStore store.QuotaStore
+	if app.Settings.Quota.Enabled() {
+		quotaStore = store.NewDynamoDbQuotaStore(app.DynamoDB, app.Settings.Quota.TableName)
+	}
+	quotaService := services.NewQuotaServiceImpl(quotaStore, *app.Settings.Quota, app.Logger)
+
+	uploadService := services.NewUploadServiceImpl(chunkStore, quotaService, app.Logger)
+	sessionService := services.NewSessionServiceImpl(sessionStore, chunkStore, upNotifyQueue, quotaService, app.Settings.Limits.MaxChunkSize, *app.Settings.Encryption, app.Keys, app.Events, app.Logger)
+	streamService := services.NewStreamServiceImpl(chunkStore, sessionStore, sessionService, quotaService, app.Logger)
 
 	app.Logger.Info("uploads services initialized successfully")
 
 	return &Services{
 		Uploads:       uploadService,
 		Sessions:      sessionService,
+		Streams:       streamService,
 		UploadsNotify: upNotifyQueue,
 
 		Stores: &Stores{
 			chunks:   chunkStore,
 			sessions: sessionStore,
+			quotas:   quotaStore,
+			logger:   app.Logger,
 		},
+		logger: app.Logger,
 	}
 }
 
@@ -78,6 +91,7 @@ func (s *Stores) Shutdown(ctx context.Context) error {
 
 	shutdownIfPossible("chunks", s.chunks)
 	shutdownIfPossible("sessions", s.sessions)
+	shutdownIfPossible("quotas", s.quotas)
 
 	s.logger.Info("stores shutdown complete")
 	return nil
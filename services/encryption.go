@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/envelope"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/settings"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+var (
+	ErrCustomerKeysDisabled = errors.New("customer encryption keys are not accepted")
+	ErrKeyProviderMissing   = errors.New("upload is encrypted with a data key but no key provider is configured")
+)
+
+// CustomerKeyProblem returns the HTTP status and problem code of a request
+// with a missing, invalid or wrong customer key. It reports false when err
+// is not about the key.
+func CustomerKeyProblem(err error) (int, string, bool) {
+	switch {
+	case errors.Is(err, store.ErrCustomerKeyMismatch):
+		return http.StatusForbidden, problem.CodeEncryptionKeyMismatch, true
+	case errors.Is(err, store.ErrInvalidCustomerKey):
+		return http.StatusBadRequest, problem.CodeEncryptionKeyInvalid, true
+	case errors.Is(err, store.ErrCustomerKeyRequired):
+		return http.StatusBadRequest, problem.CodeEncryptionKeyRequired, true
+	case errors.Is(err, ErrCustomerKeysDisabled):
+		return http.StatusBadRequest, problem.CodeCustomerKeysDisabled, true
+	}
+	return 0, "", false
+}
+
+// newEncryption picks the encryption of a new session. A customer key makes
+// it an SSE-C session, otherwise the configured mode applies with the KMS key
+// of the caller tenant.
+func (s *SessionServiceImpl) newEncryption(ctx context.Context, customerKey []byte) (store.Encryption, error) {
+	if customerKey != nil {
+		if !s.encryption.AllowCustomerKeys {
+			return store.Encryption{}, ErrCustomerKeysDisabled
+		}
+		return store.Encryption{Mode: store.EncryptionCustom, CustomerKey: customerKey}, nil
+	}
+
+	switch s.encryption.Mode {
+	case settings.EncryptionSSES3:
+		return store.Encryption{Mode: store.EncryptionS3}, nil
+	case settings.EncryptionSSEKMS:
+		tenant := auth.Tenant(ctx, s.encryption.TenantClaim)
+		return store.Encryption{Mode: store.EncryptionKMS, KMSKeyID: s.encryption.KMSKey(tenant)}, nil
+	}
+	return store.Encryption{}, nil
+}
+
+// newDataKey has the key provider issue the data key of a new session. It
+// returns nil when the service does not encrypt chunks itself.
+func (s *SessionServiceImpl) newDataKey(ctx context.Context) (*envelope.DataKey, error) {
+	if s.keys == nil {
+		return nil, nil
+	}
+	key, err := s.keys.GenerateDataKey(ctx)
+	if err != nil {
+		s.logger.Error("failed to generate data key",
+			"provider", s.keys.Name(),
+			"error", err,
+		)
+		return nil, err
+	}
+	return key, nil
+}
+
+// ChunkEncryption returns the encryption the chunks of session are read and
+// written with, unwrapping the session data key when it has one.
+func (s *SessionServiceImpl) ChunkEncryption(ctx context.Context, session *store.UploadSession, customerKey []byte) (store.Encryption, error) {
+	encryption, err := session.ChunkEncryption(customerKey)
+	if err != nil || session.WrappedDataKey == nil {
+		return encryption, err
+	}
+	if s.keys == nil {
+		return store.Encryption{}, ErrKeyProviderMissing
+	}
+
+	dataKey, err := s.keys.Decrypt(ctx, session.DataKeyID, session.WrappedDataKey)
+	if err != nil {
+		s.logger.Error("failed to unwrap data key",
+			"upload_id", session.UploadID,
+			"key_id", session.DataKeyID,
+			"error", err,
+		)
+		return store.Encryption{}, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	encryption.DataKey = dataKey
+	return encryption, nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/settings"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+const (
+	QuotaOpenSessions  = "open_sessions"
+	QuotaInFlightBytes = "in_flight_bytes"
+	QuotaDailyBytes    = "daily_bytes"
+)
+
+// QuotaError reports the limit a request would exceed.
+type QuotaError struct {
+	Quota     string
+	Limit     int64
+	Requested int64     // Bytes the request needs, zero for session slots
+	ResetAt   time.Time // When the usage resets on its own, zero when it only drops as sessions close
+	err       error
+}
+
+func (e *QuotaError) Error() string {
+	switch {
+	case e.Quota == QuotaOpenSessions:
+		return fmt.Sprintf("too many open upload sessions, the limit is %d", e.Limit)
+	case e.Quota == QuotaInFlightBytes && e.TooLarge():
+		return fmt.Sprintf("upload of %d bytes exceeds the limit of %d bytes in open sessions", e.Requested, e.Limit)
+	case e.Quota == QuotaInFlightBytes:
+		return fmt.Sprintf("open upload sessions already hold the limit of %d bytes", e.Limit)
+	case e.TooLarge():
+		return fmt.Sprintf("%d bytes exceed the daily upload limit of %d bytes", e.Requested, e.Limit)
+	default:
+		return fmt.Sprintf("daily upload limit of %d bytes reached, resets at %s", e.Limit, e.ResetAt.Format(time.RFC3339))
+	}
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.err
+}
+
+// TooLarge reports whether the request alone exceeds the limit, so retrying
+// it later cannot succeed.
+func (e *QuotaError) TooLarge() bool {
+	return e.Requested > e.Limit
+}
+
+// Status is the HTTP status of the error, 413 when the request can never fit
+// the limit and 429 when it may succeed once usage drops.
+func (e *QuotaError) Status() int {
+	if e.TooLarge() {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusTooManyRequests
+}
+
+// RetryAfterSeconds is the wait until the usage resets in whole seconds for
+// a Retry-After value, zero when retrying cannot succeed or the usage only
+// drops as sessions close.
+func (e *QuotaError) RetryAfterSeconds() int64 {
+	if e.TooLarge() || e.ResetAt.IsZero() {
+		return 0
+	}
+	return max(1, int64(math.Ceil(time.Until(e.ResetAt).Seconds())))
+}
+
+// QuotaService enforces the per user limits on open sessions, bytes reserved
+// by open sessions and bytes uploaded per day. Requests without an owner,
+// which only happens with auth disabled, are not limited.
+type QuotaService interface {
+	// OpenSession reserves a session slot and the file size for a new session.
+	// Sessions without a size reserve their bytes as ChargeBytes counts them.
+	OpenSession(ctx context.Context, session *store.UploadSession) error
+	// CloseSession releases what OpenSession and ChargeBytes reserved once the
+	// session completes, fails or is aborted.
+	CloseSession(ctx context.Context, session *store.UploadSession)
+	// ChargeBytes counts n stored bytes of an upload against the daily limit
+	// of the caller, and against its in flight limit when the session was
+	// opened without a size.
+	ChargeBytes(ctx context.Context, uploadID string, n int64) (Charge, error)
+	// RefundBytes gives back a charge whose bytes were not kept.
+	RefundBytes(ctx context.Context, charge Charge)
+}
+
+// Charge is bytes counted against the daily limit on the UTC day they were
+// charged, the day a refund gives them back to, and the bytes it reserved in
+// flight for an upload without a size. The zero Charge refunds nothing.
+type Charge struct {
+	Bytes    int64
+	Day      time.Time
+	UploadID string
+	InFlight int64
+}
+
+type QuotaServiceImpl struct {
+	quotaStore store.QuotaStore
+	limits     settings.QuotaConfig
+
+	logger logger.Logger
+}
+
+// NewQuotaServiceImpl returns a service enforcing limits. A nil store
+// disables quotas.
+func NewQuotaServiceImpl(quotaStore store.QuotaStore, limits settings.QuotaConfig, l logger.Logger) *QuotaServiceImpl {
+	return &QuotaServiceImpl{
+		quotaStore: quotaStore,
+		limits:     limits,
+		logger:     l,
+	}
+}
+
+func (s *QuotaServiceImpl) OpenSession(ctx context.Context, session *store.UploadSession) error {
+	if s.quotaStore == nil || session.OwnerID == "" {
+		return nil
+	}
+
+	lease := store.SessionLease{
+		UploadID:  session.UploadID,
+		Bytes:     session.FileSize,
+		ExpiresAt: session.ExpiresAt,
+	}
+	err := s.quotaStore.OpenSession(ctx, session.OwnerID, lease, s.limits.MaxOpenSessions, s.limits.MaxInFlightBytes)
+	switch {
+	case errors.Is(err, store.ErrQuotaOpenSessions):
+		err = &QuotaError{Quota: QuotaOpenSessions, Limit: s.limits.MaxOpenSessions, err: err}
+	case errors.Is(err, store.ErrQuotaInFlightBytes):
+		err = &QuotaError{Quota: QuotaInFlightBytes, Limit: s.limits.MaxInFlightBytes, Requested: session.FileSize, err: err}
+	case err != nil:
+		s.logger.Error("failed to reserve upload quota",
+			"upload_id", session.UploadID,
+			"owner_id", session.OwnerID,
+			"error", err,
+		)
+		return err
+	default:
+		return nil
+	}
+
+	s.logger.Warn("upload quota exceeded",
+		"upload_id", session.UploadID,
+		"owner_id", session.OwnerID,
+		"error", err,
+	)
+	return err
+}
+
+func (s *QuotaServiceImpl) CloseSession(ctx context.Context, session *store.UploadSession) {
+	if s.quotaStore == nil || session.OwnerID == "" {
+		return
+	}
+
+	// a lease that is not released here lapses when the session expires
+	if err := s.quotaStore.CloseSession(ctx, session.OwnerID, session.UploadID); err != nil {
+		s.logger.Error("failed to release upload quota",
+			"upload_id", session.UploadID,
+			"owner_id", session.OwnerID,
+			"error", err,
+		)
+	}
+}
+
+func (s *QuotaServiceImpl) ChargeBytes(ctx context.Context, uploadID string, n int64) (Charge, error) {
+	owner := auth.Owner(ctx)
+	if s.quotaStore == nil || owner == "" || n <= 0 {
+		return Charge{}, nil
+	}
+
+	charge := Charge{UploadID: uploadID}
+	if s.limits.MaxInFlightBytes > 0 {
+		grown, err := s.quotaStore.GrowLease(ctx, owner, uploadID, n, s.limits.MaxInFlightBytes)
+		if errors.Is(err, store.ErrQuotaInFlightBytes) {
+			err = &QuotaError{Quota: QuotaInFlightBytes, Limit: s.limits.MaxInFlightBytes, Requested: n, err: err}
+			s.logger.Warn("upload quota exceeded",
+				"upload_id", uploadID,
+				"owner_id", owner,
+				"error", err,
+			)
+			return Charge{}, err
+		}
+		if err != nil {
+			s.logger.Error("failed to reserve upload quota",
+				"upload_id", uploadID,
+				"owner_id", owner,
+				"bytes", n,
+				"error", err,
+			)
+			return Charge{}, err
+		}
+		if grown {
+			charge.InFlight = n
+		}
+	}
+
+	now := time.Now().UTC()
+	err := s.quotaStore.AddDailyBytes(ctx, owner, now, n, s.limits.MaxDailyBytes)
+	if err != nil {
+		// bytes the day cannot take are not in flight either
+		s.RefundBytes(ctx, charge)
+	}
+	if errors.Is(err, store.ErrQuotaDailyBytes) {
+		err = &QuotaError{
+			Quota:     QuotaDailyBytes,
+			Limit:     s.limits.MaxDailyBytes,
+			Requested: n,
+			ResetAt:   now.Truncate(24 * time.Hour).Add(24 * time.Hour),
+			err:       err,
+		}
+		s.logger.Warn("upload quota exceeded",
+			"owner_id", owner,
+			"error", err,
+		)
+		return Charge{}, err
+	}
+	if err != nil {
+		s.logger.Error("failed to charge upload quota",
+			"owner_id", owner,
+			"bytes", n,
+			"error", err,
+		)
+		return Charge{}, err
+	}
+	charge.Bytes, charge.Day = n, now
+	return charge, nil
+}
+
+func (s *QuotaServiceImpl) RefundBytes(ctx context.Context, charge Charge) {
+	owner := auth.Owner(ctx)
+	if s.quotaStore == nil || owner == "" {
+		return
+	}
+
+	if charge.InFlight > 0 {
+		if _, err := s.quotaStore.GrowLease(ctx, owner, charge.UploadID, -charge.InFlight, 0); err != nil {
+			s.logger.Warn("failed to release upload quota",
+				"upload_id", charge.UploadID,
+				"owner_id", owner,
+				"bytes", charge.InFlight,
+				"error", err,
+			)
+		}
+	}
+	if charge.Bytes > 0 {
+		if err := s.quotaStore.AddDailyBytes(ctx, owner, charge.Day, -charge.Bytes, 0); err != nil {
+			s.logger.Warn("failed to refund upload quota",
+				"owner_id", owner,
+				"bytes", charge.Bytes,
+				"error", err,
+			)
+		}
+	}
+}
@@ -2,64 +2,319 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
 
 	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/compression"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/envelope"
+	"github.com/Yulian302/lfusys-services-uploads/events"
 	"github.com/Yulian302/lfusys-services-uploads/queues"
+	"github.com/Yulian302/lfusys-services-uploads/settings"
 	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/google/uuid"
 )
 
+var (
+	ErrInvalidSession   = errors.New("invalid upload session parameters")
+	ErrChunkTooLarge    = errors.New("chunk size exceeds the maximum")
+	ErrUploadIncomplete = errors.New("upload is missing chunks")
+)
+
+// ClosedSessionProblem returns the HTTP status, message and log reason of an
+// error from a session that no longer accepts chunks. Completed and failed
+// sessions conflict with the write, aborted and expired ones are gone. It
+// reports false when err is not about the session status.
+func ClosedSessionProblem(err error) (int, string, string, bool) {
+	switch {
+	case errors.Is(err, store.ErrSessionCompleted):
+		return http.StatusConflict, "upload already completed", "session_completed", true
+	case errors.Is(err, store.ErrSessionFailed):
+		return http.StatusConflict, "upload failed verification", "session_failed", true
+	case errors.Is(err, store.ErrSessionAborted):
+		return http.StatusGone, "upload aborted", "session_aborted", true
+	case errors.Is(err, store.ErrSessionExpired):
+		return http.StatusGone, "upload session expired", "session_expired", true
+	}
+	return 0, "", "", false
+}
+
+// SessionParams describes the file a new upload session is created for.
+// DeferLength sessions start without a size, which is set once the upload
+// completes. FileHash and MerkleRoot are checked against the assembled file
+// before the session completes. MaxChunkSize lowers the largest chunk body the
+// session accepts below the service limit. StorageEncoding stores the chunks
+// compressed with gzip or zstd. A CustomerKey encrypts the chunks with SSE-C,
+// clients then send the key with every request that reads or writes chunks.
+type SessionParams struct {
+	FileName          string
+	FileSize          int64
+	ChunkSize         int64
+	MaxChunkSize      int64
+	FileHash          string
+	FileHashAlgorithm string
+	MerkleRoot        string
+	HashAlgorithm     string
+	StorageEncoding   string
+	CustomerKey       []byte
+	DeferLength       bool
+}
+
 type SessionService interface {
-	MarkChunkComplete(ctx context.Context, uploadID string, chunkIdx uint32) error
+	CreateSession(ctx context.Context, params SessionParams) (*store.UploadSession, error)
+	GetSession(ctx context.Context, uploadID string) (*store.UploadSession, error)
+	MarkChunkComplete(ctx context.Context, uploadID string, chunk store.ChunkHash) error
+	MarkChunksComplete(ctx context.Context, uploadID string, chunks []store.ChunkHash) error
+	AbortUpload(ctx context.Context, uploadID string) error
+	CompleteUpload(ctx context.Context, uploadID string, fileSize int64, chunkSize int64, chunks []uint32) ([]uint32, error)
+	// ChunkEncryption returns the encryption the chunks of session are read
+	// and written with, given the customer key sent by the client.
+	ChunkEncryption(ctx context.Context, session *store.UploadSession, customerKey []byte) (store.Encryption, error)
 }
 
 type SessionServiceImpl struct {
 	uploadsStore store.UploadsStore
+	chunkStore   store.ChunkStore
 	uploadNotify queues.UploadNotify
+	quotas       QuotaService
+	maxChunkSize int64
+	encryption   settings.EncryptionConfig
+	keys         envelope.KeyProvider // Wraps the data keys of new sessions, chunks are stored as sent when nil
+	events       events.Publisher     // Receives the progress of uploads, nothing is published when nil
 
 	logger logger.Logger
 }
 
-func NewSessionServiceImpl(sessionStore store.UploadsStore, uploadNotify queues.UploadNotify, l logger.Logger) *SessionServiceImpl {
+func NewSessionServiceImpl(sessionStore store.UploadsStore, chunkStore store.ChunkStore, uploadNotify queues.UploadNotify, quotas QuotaService, maxChunkSize int64, encryption settings.EncryptionConfig, keys envelope.KeyProvider, publisher events.Publisher, l logger.Logger) *SessionServiceImpl {
 	return &SessionServiceImpl{
 		uploadsStore: sessionStore,
+		chunkStore:   chunkStore,
 		uploadNotify: uploadNotify,
+		quotas:       quotas,
+		maxChunkSize: maxChunkSize,
+		encryption:   encryption,
+		keys:         keys,
+		events:       publisher,
 		logger:       l,
 	}
 }
 
-func (s *SessionServiceImpl) MarkChunkComplete(ctx context.Context, uploadID string, chunkIdx uint32) error {
+func (s *SessionServiceImpl) CreateSession(ctx context.Context, params SessionParams) (*store.UploadSession, error) {
+	maxChunkSize := s.maxChunkSize
+	if params.MaxChunkSize > 0 {
+		if params.MaxChunkSize > s.maxChunkSize {
+			return nil, fmt.Errorf("%w: max chunk size is limited to %d bytes", ErrChunkTooLarge, s.maxChunkSize)
+		}
+		maxChunkSize = params.MaxChunkSize
+	}
+
+	chunkSize := params.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = min(store.DefaultChunkSize, maxChunkSize)
+	}
+	if (params.FileSize <= 0 && !params.DeferLength) || chunkSize < 0 || params.MaxChunkSize < 0 {
+		return nil, ErrInvalidSession
+	}
+	if chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("%w: chunk size is limited to %d bytes", ErrChunkTooLarge, maxChunkSize)
+	}
+
+	hashAlgorithm := digest.Default
+	if params.HashAlgorithm != "" {
+		alg, err := digest.Lookup(params.HashAlgorithm)
+		if err != nil {
+			return nil, ErrInvalidSession
+		}
+		hashAlgorithm = alg.Name
+	}
+
+	var fileHash, fileHashAlgorithm string
+	if params.FileHash != "" {
+		algorithm := params.FileHashAlgorithm
+		if algorithm == "" {
+			algorithm = digest.Default
+		}
+		alg, err := digest.Lookup(algorithm)
+		if err != nil {
+			return nil, ErrInvalidSession
+		}
+		expected, err := digest.Decode(alg, params.FileHash)
+		if err != nil {
+			return nil, ErrInvalidSession
+		}
+		fileHash, fileHashAlgorithm = expected.Hex(), alg.Name
+	}
+
+	storageEncoding, err := compression.Parse(params.StorageEncoding)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	if storageEncoding == compression.Identity {
+		storageEncoding = ""
+	}
+
+	encryption, err := s.newEncryption(ctx, params.CustomerKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := s.newDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var merkleRoot string
+	if params.MerkleRoot != "" {
+		root, err := digest.Decode(digest.SHA256, params.MerkleRoot)
+		if err != nil {
+			return nil, ErrInvalidSession
+		}
+		merkleRoot = root.Hex()
+	}
+
+	totalChunks := (params.FileSize + chunkSize - 1) / chunkSize
+	if totalChunks > math.MaxUint32 {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	session := &store.UploadSession{
+		UploadID:          uuid.NewString(),
+		OwnerID:           auth.Owner(ctx),
+		Status:            store.SessionStatusPending,
+		FileName:          params.FileName,
+		FileSize:          params.FileSize,
+		FileHash:          fileHash,
+		FileHashAlgorithm: fileHashAlgorithm,
+		MerkleRoot:        merkleRoot,
+		HashAlgorithm:     hashAlgorithm,
+		ChunkSize:         chunkSize,
+		MaxChunkSize:      maxChunkSize,
+		StorageEncoding:   storageEncoding,
+		Encryption:        encryption.Mode,
+		KMSKeyID:          encryption.KMSKeyID,
+		TotalChunks:       uint32(totalChunks),
+		CreatedAt:         now.Unix(),
+		ExpiresAt:         now.Add(store.SessionTTL).Unix(),
+	}
+
+	if encryption.Mode == store.EncryptionCustom {
+		session.CustomerKeyMD5 = store.CustomerKeyMD5(encryption.CustomerKey)
+	}
+	if dataKey != nil {
+		session.WrappedDataKey, session.DataKeyID = dataKey.Wrapped, dataKey.KeyID
+	}
+
+	if err := s.quotas.OpenSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	if err := s.uploadsStore.CreateSession(ctx, session); err != nil {
+		s.quotas.CloseSession(ctx, session)
+		s.logger.Error("failed to create upload session",
+			"upload_id", session.UploadID,
+			"file_size", session.FileSize,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	s.logger.Info("upload session created",
+		"upload_id", session.UploadID,
+		"file_size", session.FileSize,
+		"total_chunks", session.TotalChunks,
+	)
+	return session, nil
+}
+
+// GetSession loads a session owned by the caller.
+func (s *SessionServiceImpl) GetSession(ctx context.Context, uploadID string) (*store.UploadSession, error) {
 	session, err := s.uploadsStore.GetSession(ctx, uploadID)
 	if err != nil {
 		s.logger.Error("failed to get upload session",
 			"upload_id", uploadID,
-			"chunk_idx", chunkIdx,
 			"error", err,
 		)
+		return nil, err
+	}
+	if err := s.authorize(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// authorize refuses sessions that belong to someone other than the caller.
+func (s *SessionServiceImpl) authorize(ctx context.Context, session *store.UploadSession) error {
+	if err := auth.Authorize(ctx, session.OwnerID); err != nil {
+		s.logger.Warn("upload session access denied",
+			"upload_id", session.UploadID,
+			"owner_id", session.OwnerID,
+			"subject", auth.Owner(ctx),
+		)
 		return err
 	}
+	return nil
+}
+
+func (s *SessionServiceImpl) MarkChunkComplete(ctx context.Context, uploadID string, chunk store.ChunkHash) error {
+	return s.MarkChunksComplete(ctx, uploadID, []store.ChunkHash{chunk})
+}
 
-	if err := s.uploadsStore.PutChunk(ctx, uploadID, chunkIdx, session.TotalChunks); err != nil {
-		s.logger.Error("failed to mark chunk complete",
+// MarkChunksComplete records several stored chunks and their hashes in a
+// single session update and finalizes the upload once every chunk is present
+// and the assembled file passes verification.
+func (s *SessionServiceImpl) MarkChunksComplete(ctx context.Context, uploadID string, chunks []store.ChunkHash) error {
+	session, err := s.uploadsStore.GetSession(ctx, uploadID)
+	if err != nil {
+		s.logger.Error("failed to get upload session",
 			"upload_id", uploadID,
-			"chunk_idx", chunkIdx,
-			"total_chunks", session.TotalChunks,
+			"chunks", len(chunks),
 			"error", err,
 		)
 		return err
 	}
+	if err := s.authorize(ctx, session); err != nil {
+		return err
+	}
 
-	completed, err := s.uploadsStore.TryFinalizeUpload(
-		ctx,
-		uploadID,
-		session.TotalChunks,
-	)
+	if err := session.CheckWritable(time.Now()); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := session.ValidateChunkIndex(chunk.Index); err != nil {
+			return err
+		}
+	}
+
+	updated, err := s.uploadsStore.PutChunks(ctx, uploadID, chunks, session.TotalChunks)
 	if err != nil {
-		s.logger.Error("failed to finalize upload",
+		s.logger.Error("failed to mark chunks complete",
 			"upload_id", uploadID,
+			"chunks", len(chunks),
+			"total_chunks", session.TotalChunks,
 			"error", err,
 		)
 		return err
 	}
+	session = updated
+	if err := s.dropStaleHashes(ctx, session, chunks); err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		s.publish(ctx, events.ChunkReceived(session, chunk.Index))
+	}
+	s.publish(ctx, events.New(events.TypeProgress, session))
+
+	completed, err := s.finalize(ctx, session)
+	if err != nil {
+		return err
+	}
 
 	if completed {
 		s.logger.Info("upload finalized, notifying",
@@ -68,10 +323,193 @@ func (s *SessionServiceImpl) MarkChunkComplete(ctx context.Context, uploadID str
 		return s.uploadNotify.NotifyUploadComplete(ctx, uploadID)
 	}
 
-	s.logger.Debug("chunk marked complete",
+	s.logger.Debug("chunks marked complete",
 		"upload_id", uploadID,
-		"chunk_idx", chunkIdx,
-		"progress", float64(chunkIdx+1)/float64(session.TotalChunks),
+		"chunks", len(chunks),
+		"total_chunks", session.TotalChunks,
 	)
 	return nil
 }
+
+// dropStaleHashes removes the hashes of earlier uploads of chunks that were
+// just overwritten, so the session keeps one hash per chunk.
+func (s *SessionServiceImpl) dropStaleHashes(ctx context.Context, session *store.UploadSession, chunks []store.ChunkHash) error {
+	current := make(map[string]struct{}, len(chunks))
+	for _, chunk := range chunks {
+		current[chunk.String()] = struct{}{}
+	}
+
+	var stale []store.ChunkHash
+	for _, chunk := range chunks {
+		for _, recorded := range session.RecordedHashes(chunk.Index) {
+			if _, ok := current[recorded.String()]; !ok {
+				stale = append(stale, recorded)
+			}
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if err := s.uploadsStore.RemoveChunkHashes(ctx, session.UploadID, stale); err != nil {
+		s.logger.Error("failed to remove stale chunk hashes",
+			"upload_id", session.UploadID,
+			"stale", len(stale),
+			"error", err,
+		)
+		return err
+	}
+
+	kept := session.ChunkDigests[:0]
+	for _, value := range session.ChunkDigests {
+		if !slices.ContainsFunc(stale, func(h store.ChunkHash) bool { return h.String() == value }) {
+			kept = append(kept, value)
+		}
+	}
+	session.ChunkDigests = kept
+	return nil
+}
+
+// finalize completes a session once it holds every chunk. The assembled file
+// is verified first and a session that fails is moved to the failed status
+// with the reason, instead of completing.
+func (s *SessionServiceImpl) finalize(ctx context.Context, session *store.UploadSession) (bool, error) {
+	// sessions without a length cannot complete before the layout is set
+	if session.TotalChunks == 0 ||
+		session.Status == store.SessionStatusCompleted ||
+		uint32(len(session.ReceivedChunks())) < session.TotalChunks {
+		return false, nil
+	}
+
+	reason, err := s.verifyFile(ctx, session)
+	if err != nil {
+		s.logger.Error("failed to verify upload",
+			"upload_id", session.UploadID,
+			"error", err,
+		)
+		return false, err
+	}
+	if reason != "" {
+		s.logger.Warn("upload failed verification",
+			"upload_id", session.UploadID,
+			"reason", reason,
+		)
+		if err := s.uploadsStore.FailSession(ctx, session.UploadID, reason); err != nil {
+			s.logger.Error("failed to mark upload failed",
+				"upload_id", session.UploadID,
+				"error", err,
+			)
+			return false, err
+		}
+		s.quotas.CloseSession(ctx, session)
+
+		session.FailureReason = reason
+		s.publish(ctx, events.New(events.TypeFailed, session))
+		return false, fmt.Errorf("%w: %s", ErrFileIntegrity, reason)
+	}
+
+	completed, err := s.uploadsStore.TryFinalizeUpload(ctx, session.UploadID, session.TotalChunks)
+	if err != nil {
+		s.logger.Error("failed to finalize upload",
+			"upload_id", session.UploadID,
+			"error", err,
+		)
+		return false, err
+	}
+	if completed {
+		s.quotas.CloseSession(ctx, session)
+		s.publish(ctx, events.New(events.TypeFinalized, session))
+	}
+	return completed, nil
+}
+
+func (s *SessionServiceImpl) publish(ctx context.Context, event events.Event) {
+	if s.events != nil {
+		s.events.Publish(ctx, event)
+	}
+}
+
+func (s *SessionServiceImpl) AbortUpload(ctx context.Context, uploadID string) error {
+	session, err := s.GetSession(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.uploadsStore.AbortSession(ctx, uploadID); err != nil {
+		if errors.Is(err, store.ErrSessionAborted) {
+			// aborting twice is not an error, the first abort did the rest
+			return nil
+		}
+		s.logger.Error("failed to abort upload session",
+			"upload_id", uploadID,
+			"error", err,
+		)
+		return err
+	}
+	s.quotas.CloseSession(ctx, session)
+	s.publish(ctx, events.New(events.TypeAborted, session))
+
+	s.logger.Info("upload aborted, notifying",
+		"upload_id", uploadID,
+	)
+	return s.uploadNotify.NotifyUploadAborted(ctx, uploadID)
+}
+
+// CompleteUpload finalizes a session created without a length once the
+// client names the chunks that make up the file. Chunks must be numbered
+// from zero without gaps, and every chunk but the last is chunkSize bytes.
+// Uploaded chunks that are not listed are dropped from the session and
+// returned so their objects can be deleted.
+func (s *SessionServiceImpl) CompleteUpload(ctx context.Context, uploadID string, fileSize int64, chunkSize int64, chunks []uint32) ([]uint32, error) {
+	session, err := s.uploadsStore.GetSession(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, session); err != nil {
+		return nil, err
+	}
+
+	listed := make(map[uint32]struct{}, len(chunks))
+	for i, idx := range chunks {
+		if idx != uint32(i) {
+			return nil, ErrUploadIncomplete
+		}
+		listed[idx] = struct{}{}
+	}
+	if len(chunks) == 0 {
+		return nil, ErrUploadIncomplete
+	}
+	// the last chunk holds what the others leave of the file
+	if last := fileSize - chunkSize*int64(len(chunks)-1); chunkSize <= 0 || last <= 0 || last > chunkSize {
+		return nil, fmt.Errorf("%w: %d chunks of %d bytes cannot hold %d bytes", store.ErrChunkSize, len(chunks), chunkSize, fileSize)
+	}
+
+	var discard []uint32
+	for _, idx := range session.ReceivedChunks() {
+		if _, ok := listed[idx]; !ok {
+			discard = append(discard, idx)
+		}
+	}
+
+	updated, err := s.uploadsStore.SetLayout(ctx, uploadID, fileSize, chunkSize, uint32(len(chunks)), discard)
+	if err != nil {
+		s.logger.Error("failed to set upload layout",
+			"upload_id", uploadID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	completed, err := s.finalize(ctx, updated)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, ErrUploadIncomplete
+	}
+
+	s.logger.Info("upload finalized, notifying",
+		"upload_id", uploadID,
+	)
+	return discard, s.uploadNotify.NotifyUploadComplete(ctx, uploadID)
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+var (
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadTooLarge = errors.New("data exceeds upload length")
+)
+
+// Checksum verifies a whole request body. The body is written to Hash while
+// it is consumed and the sum is compared to Expected once it ends.
+type Checksum struct {
+	Hash     hash.Hash
+	Expected []byte
+}
+
+// StreamService accepts offset based uploads and splits them into the same
+// fixed size chunks that chunk indexed uploads produce.
+type StreamService interface {
+	// Write appends body to the upload at offset and returns the new committed offset.
+	Write(ctx context.Context, uploadID string, offset int64, body io.Reader, checksum *Checksum) (int64, error)
+}
+
+type StreamServiceImpl struct {
+	chunkStore     store.ChunkStore
+	uploadsStore   store.UploadsStore
+	sessionService SessionService
+	quotas         QuotaService
+
+	logger logger.Logger
+}
+
+func NewStreamServiceImpl(chunkStore store.ChunkStore, uploadsStore store.UploadsStore, sessionService SessionService, quotas QuotaService, l logger.Logger) *StreamServiceImpl {
+	return &StreamServiceImpl{
+		chunkStore:     chunkStore,
+		uploadsStore:   uploadsStore,
+		sessionService: sessionService,
+		quotas:         quotas,
+		logger:         l,
+	}
+}
+
+// Write buffers at most one chunk in memory. Bytes that do not fill a whole
+// chunk are kept in a tail object keyed by the committed offset and merged
+// into the chunk on the next write. Without a checksum every completed chunk
+// is committed right away so an interrupted body keeps its progress, with a
+// checksum nothing is committed until the whole body has been verified.
+func (s *StreamServiceImpl) Write(ctx context.Context, uploadID string, offset int64, body io.Reader, checksum *Checksum) (int64, error) {
+	session, err := s.uploadsStore.GetSession(ctx, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	if err := auth.Authorize(ctx, session.OwnerID); err != nil {
+		return 0, err
+	}
+	if err := session.CheckWritable(time.Now()); err != nil {
+		return session.Offset, err
+	}
+	if session.Offset != offset {
+		return session.Offset, ErrOffsetMismatch
+	}
+	if offset >= session.FileSize {
+		return offset, nil
+	}
+
+	// the context carries the customer key of SSE-C sessions
+	encryption, err := s.sessionService.ChunkEncryption(ctx, session, store.EncryptionFromContext(ctx).CustomerKey)
+	if err != nil {
+		return offset, err
+	}
+	ctx = store.WithEncryption(ctx, encryption)
+
+	alg, err := digest.Lookup(session.ChunkHashAlgorithm())
+	if err != nil {
+		return offset, err
+	}
+
+	chunkSize := session.EffectiveChunkSize()
+	idx := uint32(offset / chunkSize)
+	chunk := make([]byte, session.ChunkLength(idx))
+
+	fill := int(offset % chunkSize)
+	hadTail := fill > 0
+	if hadTail {
+		if err := s.readTail(ctx, uploadID, offset, chunk[:fill]); err != nil {
+			return offset, err
+		}
+	}
+
+	// one byte past the upload length is allowed through to detect oversized bodies
+	reader := io.LimitReader(body, session.FileSize-offset+1)
+	if checksum != nil {
+		reader = io.TeeReader(reader, checksum.Hash)
+	}
+
+	committed := offset
+	pos := offset
+	var pending []store.ChunkHash
+	var charges []Charge
+	var readErr error
+
+	for idx < session.TotalChunks {
+		length := session.ChunkLength(idx)
+
+		var n int
+		n, readErr = io.ReadFull(reader, chunk[fill:length])
+		fill += n
+		pos += int64(n)
+
+		if int64(fill) < length {
+			break
+		}
+
+		if idx == session.TotalChunks-1 {
+			var extra [1]byte
+			if n, _ := reader.Read(extra[:]); n > 0 {
+				s.discard(ctx, session, pending, charges)
+				return committed, ErrUploadTooLarge
+			}
+		}
+
+		stored, charge, err := s.putChunk(ctx, uploadID, idx, chunk[:fill], alg)
+		if err != nil {
+			s.discard(ctx, session, pending, charges)
+			return committed, err
+		}
+		fill = 0
+
+		if checksum == nil {
+			if err := s.commit(ctx, uploadID, []store.ChunkHash{stored}, committed, pos); err != nil {
+				return committed, err
+			}
+			committed = pos
+		} else {
+			pending = append(pending, stored)
+			charges = append(charges, charge)
+		}
+		idx++
+	}
+
+	interrupted := readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF)
+
+	if checksum != nil {
+		if interrupted {
+			s.discard(ctx, session, pending, charges)
+			return committed, readErr
+		}
+		if !bytes.Equal(checksum.Hash.Sum(nil), checksum.Expected) {
+			s.logger.Warn("upload body checksum mismatch",
+				"upload_id", uploadID,
+				"offset", offset,
+			)
+			s.discard(ctx, session, pending, charges)
+			return committed, ErrIntegrity
+		}
+	}
+
+	if pos == offset {
+		return offset, nil
+	}
+
+	if fill > 0 {
+		info := store.ChunkInfo{Size: int64(fill)}
+		if err := s.chunkStore.PutChunk(ctx, store.TailKey(uploadID, pos), bytes.NewReader(chunk[:fill]), info); err != nil {
+			return committed, err
+		}
+	}
+
+	if err := s.commit(ctx, uploadID, pending, committed, pos); err != nil {
+		return committed, err
+	}
+
+	if hadTail {
+		if err := s.chunkStore.DeleteChunk(ctx, store.TailKey(uploadID, offset)); err != nil {
+			s.logger.Warn("failed to delete upload tail",
+				"upload_id", uploadID,
+				"error", err,
+			)
+		}
+	}
+
+	if interrupted {
+		s.logger.Warn("upload body interrupted",
+			"upload_id", uploadID,
+			"offset", pos,
+			"error", readErr,
+		)
+	}
+	return pos, nil
+}
+
+func (s *StreamServiceImpl) readTail(ctx context.Context, uploadID string, offset int64, buf []byte) error {
+	tail, err := s.chunkStore.GetChunk(ctx, store.TailKey(uploadID, offset))
+	if err != nil {
+		return err
+	}
+	defer tail.Close()
+
+	if _, err := io.ReadFull(tail, buf); err != nil {
+		s.logger.Error("upload tail is shorter than committed offset",
+			"upload_id", uploadID,
+			"expected", len(buf),
+			"error", err,
+		)
+		return err
+	}
+	return nil
+}
+
+// putChunk stores a chunk and charges it to the daily quota.
+func (s *StreamServiceImpl) putChunk(ctx context.Context, uploadID string, idx uint32, data []byte, alg *digest.Algorithm) (store.ChunkHash, Charge, error) {
+	charge, err := s.quotas.ChargeBytes(ctx, uploadID, int64(len(data)))
+	if err != nil {
+		return store.ChunkHash{}, Charge{}, err
+	}
+
+	h := alg.New()
+	h.Write(data)
+	stored := store.ChunkHash{
+		Index:     idx,
+		Algorithm: alg.Name,
+		Hash:      hex.EncodeToString(h.Sum(nil)),
+	}
+
+	info := store.ChunkInfo{
+		Size:          int64(len(data)),
+		Hash:          stored.Hash,
+		HashAlgorithm: stored.Algorithm,
+	}
+	if err := s.chunkStore.PutChunk(ctx, store.ChunkKey(uploadID, idx), bytes.NewReader(data), info); err != nil {
+		s.logger.Error("failed to upload chunk",
+			"upload_id", uploadID,
+			"chunk_id", idx,
+			"chunk_size", len(data),
+			"error", err,
+		)
+		s.quotas.RefundBytes(ctx, charge)
+		return store.ChunkHash{}, Charge{}, err
+	}
+	return stored, charge, nil
+}
+
+// commit marks the chunks complete before moving the offset, so a lost
+// offset update only makes the client resend data that is already stored.
+func (s *StreamServiceImpl) commit(ctx context.Context, uploadID string, chunks []store.ChunkHash, from int64, to int64) error {
+	for _, chunk := range chunks {
+		if err := s.sessionService.MarkChunkComplete(ctx, uploadID, chunk); err != nil {
+			return err
+		}
+	}
+	if from == to {
+		return nil
+	}
+	return s.uploadsStore.UpdateOffset(ctx, uploadID, from, to)
+}
+
+// discard removes chunks that were stored but never committed and refunds
+// the charges made for them.
+func (s *StreamServiceImpl) discard(ctx context.Context, session *store.UploadSession, chunks []store.ChunkHash, charges []Charge) {
+	for _, chunk := range chunks {
+		if err := s.chunkStore.DeleteChunk(ctx, store.ChunkKey(session.UploadID, chunk.Index)); err != nil {
+			s.logger.Warn("failed to discard uncommitted chunk",
+				"upload_id", session.UploadID,
+				"chunk_id", chunk.Index,
+				"error", err,
+			)
+		}
+	}
+	for _, charge := range charges {
+		s.quotas.RefundBytes(ctx, charge)
+	}
+}
@@ -1,46 +1,351 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"time"
 
 	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/compression"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
 	"github.com/Yulian302/lfusys-services-uploads/store"
 )
 
+var ErrIntegrity = errors.New("chunk integrity error")
+
+// PresignExpiry is how long a presigned chunk URL stays valid.
+const PresignExpiry = 15 * time.Minute
+
 type UploadService interface {
-	Upload(ctx context.Context, uploadID string, chunkID uint32, chunkData []byte) error
+	Upload(ctx context.Context, uploadID string, chunkID uint32, body io.Reader, size int64, expected *digest.Digest) (*digest.Digest, error)
+	UploadData(ctx context.Context, uploadID string, chunkID uint32, data []byte, encoding string, expected *digest.Digest) (*digest.Digest, error)
+	GetChunk(ctx context.Context, uploadID string, chunkID uint32) (*store.ChunkInfo, error)
+	PresignChunk(ctx context.Context, uploadID string, chunkID uint32, size int64, sum *digest.Digest) (*store.PresignedRequest, error)
+	ConfirmChunk(ctx context.Context, uploadID string, chunkID uint32, size int64, recorded []store.ChunkHash) (store.ChunkHash, bool, error)
+	MatchChunk(ctx context.Context, uploadID string, chunkID uint32, expected *digest.Digest) (bool, error)
+	DeleteChunk(ctx context.Context, uploadID string, chunkID uint32) error
+	DeleteUpload(ctx context.Context, uploadID string) (int, error)
 }
 
 type UploadServiceImpl struct {
 	chunkStore store.ChunkStore
+	quotas     QuotaService
 
 	logger logger.Logger
 }
 
-func NewUploadServiceImpl(chunkStore store.ChunkStore, l logger.Logger) *UploadServiceImpl {
+func NewUploadServiceImpl(chunkStore store.ChunkStore, quotas QuotaService, l logger.Logger) *UploadServiceImpl {
 	return &UploadServiceImpl{
 		chunkStore: chunkStore,
+		quotas:     quotas,
 		logger:     l,
 	}
 }
 
-func (s *UploadServiceImpl) Upload(ctx context.Context, uploadID string, chunkID uint32, chunkData []byte) error {
-	key := fmt.Sprintf("uploads/%s/chunk_%d", uploadID, chunkID)
-	if err := s.chunkStore.PutChunk(ctx, key, chunkData); err != nil {
+// Upload streams the chunk body to a staging key of the chunk store while
+// hashing it with the algorithm of expected, and only moves it onto the chunk
+// key once the sums match, so a corrupt retry never replaces a chunk that was
+// already accepted. A nil expected digest skips the check for callers that verify the body
+// themselves, the chunk is then hashed with the default algorithm. The
+// computed digest is returned so it can be recorded on the session. The
+// size is charged to the daily quota up front and refunded if the chunk is
+// not kept.
+func (s *UploadServiceImpl) Upload(ctx context.Context, uploadID string, chunkID uint32, body io.Reader, size int64, expected *digest.Digest) (*digest.Digest, error) {
+	key := store.StagingKey(uploadID, chunkID)
+
+	charge, err := s.quotas.ChargeBytes(ctx, uploadID, size)
+	if err != nil {
+		return nil, err
+	}
+
+	alg := digest.SHA256
+	info := store.ChunkInfo{Size: size}
+	if expected != nil {
+		alg = expected.Algorithm
+		info.Hash = expected.Hex()
+		info.HashAlgorithm = alg.Name
+	}
+	hasher := alg.New()
+	body = io.TeeReader(body, hasher)
+
+	if err := s.chunkStore.PutChunk(ctx, key, body, info); err != nil {
 		s.logger.Error("failed to upload chunk",
 			"upload_id", uploadID,
 			"chunk_id", chunkID,
-			"chunk_size", len(chunkData),
+			"chunk_size", size,
 			"error", err,
 		)
-		return err
+		s.quotas.RefundBytes(ctx, charge)
+		return nil, err
+	}
+
+	computed := &digest.Digest{Algorithm: alg, Sum: hasher.Sum(nil)}
+	if expected != nil && !expected.Matches(computed.Sum) {
+		s.logger.Warn("chunk integrity error, discarding staged chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"algorithm", alg.Name,
+			"expected_hash", info.Hash,
+			"calculated_hash", computed.Hex(),
+		)
+		s.discardStaged(ctx, uploadID, chunkID, key)
+		s.quotas.RefundBytes(ctx, charge)
+		return nil, fmt.Errorf("%w: expected %s %s, got %s", ErrIntegrity, alg.Name, info.Hash, computed.Hex())
+	}
+
+	err = s.chunkStore.CopyChunk(ctx, key, store.ChunkKey(uploadID, chunkID))
+	s.discardStaged(ctx, uploadID, chunkID, key)
+	if err != nil {
+		s.logger.Error("failed to move staged chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"error", err,
+		)
+		s.quotas.RefundBytes(ctx, charge)
+		return nil, err
+	}
+
+	s.logger.Debug("chunk uploaded successfully",
+		"upload_id", uploadID,
+		"chunk_id", chunkID,
+		"chunk_size", size,
+	)
+	return computed, nil
+}
+
+// UploadData stores a chunk that is already in memory, stored compressed
+// when encoding is gzip or zstd. The data is checked against expected before
+// anything is stored, a nil expected digest hashes it with the default
+// algorithm. The decoded size is what is charged to the daily quota.
+func (s *UploadServiceImpl) UploadData(ctx context.Context, uploadID string, chunkID uint32, data []byte, encoding string, expected *digest.Digest) (*digest.Digest, error) {
+	size := int64(len(data))
+
+	alg := digest.SHA256
+	if expected != nil {
+		alg = expected.Algorithm
+	}
+	h := alg.New()
+	h.Write(data)
+	computed := &digest.Digest{Algorithm: alg, Sum: h.Sum(nil)}
+	if expected != nil && !expected.Matches(computed.Sum) {
+		s.logger.Warn("chunk integrity error",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"algorithm", alg.Name,
+			"expected_hash", expected.Hex(),
+			"calculated_hash", computed.Hex(),
+		)
+		return nil, fmt.Errorf("%w: expected %s %s, got %s", ErrIntegrity, alg.Name, expected.Hex(), computed.Hex())
+	}
+
+	info := store.ChunkInfo{
+		Size:          size,
+		Hash:          computed.Hex(),
+		HashAlgorithm: alg.Name,
+	}
+	body := data
+	if encoding != "" && encoding != compression.Identity {
+		encoded, err := compression.Encode(data, encoding)
+		if err != nil {
+			return nil, err
+		}
+		body = encoded
+		info.Encoding = encoding
+		info.StoredSize = int64(len(encoded))
+	}
+
+	charge, err := s.quotas.ChargeBytes(ctx, uploadID, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.chunkStore.PutChunk(ctx, store.ChunkKey(uploadID, chunkID), bytes.NewReader(body), info); err != nil {
+		s.logger.Error("failed to upload chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"chunk_size", size,
+			"encoding", encoding,
+			"error", err,
+		)
+		s.quotas.RefundBytes(ctx, charge)
+		return nil, err
 	}
 
 	s.logger.Debug("chunk uploaded successfully",
 		"upload_id", uploadID,
 		"chunk_id", chunkID,
-		"chunk_size", len(chunkData),
+		"chunk_size", size,
+		"stored_size", len(body),
 	)
+	return computed, nil
+}
+
+func (s *UploadServiceImpl) GetChunk(ctx context.Context, uploadID string, chunkID uint32) (*store.ChunkInfo, error) {
+	info, err := s.chunkStore.HeadChunk(ctx, store.ChunkKey(uploadID, chunkID))
+	if err != nil {
+		if !errors.Is(err, store.ErrChunkNotFound) {
+			s.logger.Error("failed to get chunk info",
+				"upload_id", uploadID,
+				"chunk_id", chunkID,
+				"error", err,
+			)
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// PresignChunk issues a URL the client PUTs the chunk to directly. sum must be
+// a SHA256 digest, S3 rejects a body that does not match it.
+func (s *UploadServiceImpl) PresignChunk(ctx context.Context, uploadID string, chunkID uint32, size int64, sum *digest.Digest) (*store.PresignedRequest, error) {
+	if sum.Algorithm != digest.SHA256 {
+		return nil, fmt.Errorf("%w: presigned uploads require %s", digest.ErrUnsupportedAlgorithm, digest.SHA256.Name)
+	}
+
+	req, err := s.chunkStore.PresignPutChunk(ctx, store.ChunkKey(uploadID, chunkID), store.ChunkInfo{
+		Size:           size,
+		Hash:           sum.Hex(),
+		HashAlgorithm:  sum.Algorithm.Name,
+		ChecksumSHA256: sum.Base64(),
+	}, PresignExpiry)
+	if err != nil {
+		if !errors.Is(err, store.ErrPresignEncrypted) {
+			s.logger.Error("failed to presign chunk upload",
+				"upload_id", uploadID,
+				"chunk_id", chunkID,
+				"error", err,
+			)
+		}
+		return nil, err
+	}
+	return req, nil
+}
+
+// ConfirmChunk checks a chunk the client uploaded through a presigned URL and
+// returns the hash to record. The object must carry the S3 verified checksum
+// that was signed into the URL and, when size is known, have that length. An
+// object that does not, or that exceeds the daily quota, is deleted. A chunk
+// whose hash is among the recorded ones of the session was confirmed before,
+// it is reported as a duplicate and not charged again.
+func (s *UploadServiceImpl) ConfirmChunk(ctx context.Context, uploadID string, chunkID uint32, size int64, recorded []store.ChunkHash) (store.ChunkHash, bool, error) {
+	info, err := s.GetChunk(ctx, uploadID, chunkID)
+	if err != nil {
+		return store.ChunkHash{}, false, err
+	}
+
+	sum, err := digest.Decode(digest.SHA256, info.ChecksumSHA256)
+	reason := ""
+	switch {
+	case err != nil:
+		reason = "object has no sha256 checksum"
+	case sum.Hex() != info.Hash:
+		reason = "object checksum does not match presigned hash"
+	case size > 0 && info.Size != size:
+		reason = "object size does not match chunk size"
+	}
+
+	if reason != "" {
+		s.logger.Warn("presigned chunk rejected, discarding stored chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"reason", reason,
+		)
+		s.discardChunk(ctx, uploadID, chunkID)
+		return store.ChunkHash{}, false, fmt.Errorf("%w: %s", ErrIntegrity, reason)
+	}
+
+	confirmed := store.NewChunkHash(chunkID, sum)
+	for _, h := range recorded {
+		if h == confirmed {
+			return confirmed, true, nil
+		}
+	}
+
+	if _, err := s.quotas.ChargeBytes(ctx, uploadID, info.Size); err != nil {
+		var quotaErr *QuotaError
+		if errors.As(err, &quotaErr) {
+			s.discardChunk(ctx, uploadID, chunkID)
+		}
+		return store.ChunkHash{}, false, err
+	}
+
+	return confirmed, false, nil
+}
+
+func (s *UploadServiceImpl) discardChunk(ctx context.Context, uploadID string, chunkID uint32) {
+	if err := s.chunkStore.DeleteChunk(ctx, store.ChunkKey(uploadID, chunkID)); err != nil {
+		s.logger.Error("failed to discard rejected chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"error", err,
+		)
+	}
+}
+
+// discardStaged deletes the staging object of a chunk upload.
+func (s *UploadServiceImpl) discardStaged(ctx context.Context, uploadID string, chunkID uint32, key string) {
+	if err := s.chunkStore.DeleteChunk(ctx, key); err != nil {
+		s.logger.Error("failed to discard staged chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"key", key,
+			"error", err,
+		)
+	}
+}
+
+// MatchChunk reads a stored chunk back and reports whether it matches
+// expected. It is used when the chunk was recorded with another algorithm.
+func (s *UploadServiceImpl) MatchChunk(ctx context.Context, uploadID string, chunkID uint32, expected *digest.Digest) (bool, error) {
+	body, err := s.chunkStore.GetChunk(ctx, store.ChunkKey(uploadID, chunkID))
+	if err != nil {
+		if !errors.Is(err, store.ErrChunkNotFound) {
+			s.logger.Error("failed to read chunk",
+				"upload_id", uploadID,
+				"chunk_id", chunkID,
+				"error", err,
+			)
+		}
+		return false, err
+	}
+	defer body.Close()
+
+	h := expected.Algorithm.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return false, err
+	}
+	return expected.Matches(h.Sum(nil)), nil
+}
+
+func (s *UploadServiceImpl) DeleteChunk(ctx context.Context, uploadID string, chunkID uint32) error {
+	if err := s.chunkStore.DeleteChunk(ctx, store.ChunkKey(uploadID, chunkID)); err != nil {
+		s.logger.Error("failed to delete chunk",
+			"upload_id", uploadID,
+			"chunk_id", chunkID,
+			"error", err,
+		)
+		return err
+	}
 	return nil
 }
+
+func (s *UploadServiceImpl) DeleteUpload(ctx context.Context, uploadID string) (int, error) {
+	deleted, err := s.chunkStore.DeleteChunks(ctx, store.UploadPrefix(uploadID))
+	if err != nil {
+		s.logger.Error("failed to delete upload chunks",
+			"upload_id", uploadID,
+			"deleted", deleted,
+			"error", err,
+		)
+		return deleted, err
+	}
+
+	s.logger.Debug("upload chunks deleted",
+		"upload_id", uploadID,
+		"deleted", deleted,
+	)
+	return deleted, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+var ErrFileIntegrity = errors.New("file integrity error")
+
+const (
+	failureFileSize   = "assembled file size does not match file size"
+	failureFileHash   = "assembled file does not match file hash"
+	failureMerkleRoot = "chunk hashes do not match merkle root"
+)
+
+// verifyFile checks the assembled file of a session that holds every chunk
+// against the whole file digest and Merkle root given at creation. It returns
+// the reason the file was rejected, or an empty reason when it matches or
+// nothing was expected.
+func (s *SessionServiceImpl) verifyFile(ctx context.Context, session *store.UploadSession) (string, error) {
+	if session.FileHash == "" && session.MerkleRoot == "" {
+		return "", nil
+	}
+
+	// chunks are read back with the session data key, the context only
+	// carries the customer key of SSE-C sessions
+	encryption, err := s.ChunkEncryption(ctx, session, store.EncryptionFromContext(ctx).CustomerKey)
+	if err != nil {
+		return "", err
+	}
+	ctx = store.WithEncryption(ctx, encryption)
+
+	if session.FileHash != "" {
+		reason, err := s.verifyFileHash(ctx, session)
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+
+	if session.MerkleRoot != "" {
+		return s.verifyMerkleRoot(ctx, session)
+	}
+	return "", nil
+}
+
+// verifyFileHash reads the chunks back in order, as the file will be
+// assembled, and hashes them.
+func (s *SessionServiceImpl) verifyFileHash(ctx context.Context, session *store.UploadSession) (string, error) {
+	algorithm := session.FileHashAlgorithm
+	if algorithm == "" {
+		algorithm = digest.Default
+	}
+	alg, err := digest.Lookup(algorithm)
+	if err != nil {
+		return "", err
+	}
+	expected, err := digest.Decode(alg, session.FileHash)
+	if err != nil {
+		return "", err
+	}
+
+	h := alg.New()
+	var size int64
+	for idx := uint32(0); idx < session.TotalChunks; idx++ {
+		n, err := s.hashChunk(ctx, session.UploadID, idx, h)
+		if err != nil {
+			return "", err
+		}
+		size += n
+	}
+
+	if session.FileSize > 0 && size != session.FileSize {
+		return failureFileSize, nil
+	}
+	if !expected.Matches(h.Sum(nil)) {
+		return failureFileHash, nil
+	}
+	return "", nil
+}
+
+// verifyMerkleRoot builds the tree from the recorded chunk hashes. Chunks
+// recorded in another algorithm, or more than once, are read back and hashed
+// with the session algorithm.
+func (s *SessionServiceImpl) verifyMerkleRoot(ctx context.Context, session *store.UploadSession) (string, error) {
+	alg, err := digest.Lookup(session.ChunkHashAlgorithm())
+	if err != nil {
+		return "", err
+	}
+	expected, err := hex.DecodeString(session.MerkleRoot)
+	if err != nil {
+		return "", err
+	}
+
+	leaves := make([][]byte, 0, session.TotalChunks)
+	for idx := uint32(0); idx < session.TotalChunks; idx++ {
+		recorded := session.RecordedHashes(idx)
+		if len(recorded) == 1 && recorded[0].Algorithm == alg.Name {
+			if leaf, err := hex.DecodeString(recorded[0].Hash); err == nil {
+				leaves = append(leaves, leaf)
+				continue
+			}
+		}
+
+		h := alg.New()
+		if _, err := s.hashChunk(ctx, session.UploadID, idx, h); err != nil {
+			return "", err
+		}
+		leaves = append(leaves, h.Sum(nil))
+	}
+
+	if !bytes.Equal(expected, digest.MerkleRoot(leaves)) {
+		return failureMerkleRoot, nil
+	}
+	return "", nil
+}
+
+func (s *SessionServiceImpl) hashChunk(ctx context.Context, uploadID string, idx uint32, h hash.Hash) (int64, error) {
+	body, err := s.chunkStore.GetChunk(ctx, store.ChunkKey(uploadID, idx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read chunk %d: %w", idx, err)
+	}
+	defer body.Close()
+
+	return io.Copy(h, body)
+}
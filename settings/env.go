@@ -0,0 +1,55 @@
+package settings
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+func stringEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && strings.TrimSpace(value) != "" {
+		return strings.TrimSpace(value)
+	}
+	return fallback
+}
+
+func int64Env(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(stringEnv(key, ""), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func floatEnv(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(stringEnv(key, ""), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func boolEnv(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(stringEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// mapEnv reads comma separated key=value pairs. A pair without a value maps
+// its key to the empty string.
+func mapEnv(key string) map[string]string {
+	value := stringEnv(key, "")
+	if value == "" {
+		return nil
+	}
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(pair, "=")
+		if k = strings.TrimSpace(k); k != "" {
+			pairs[k] = strings.TrimSpace(v)
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,281 @@
+// Package settings loads the service options that are not part of the shared
+// commons config. Every option is read from the environment.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type AuthConfig struct {
+	Enabled    bool
+	HMACSecret string // Shared secret for HS256 tokens
+	JWKSFile   string // Path of a JWKS document with the RS256 keys
+	JWKSURL    string // URL of a JWKS document with the RS256 keys
+	Issuer     string // Required iss claim, unchecked when empty
+	Audience   string // Required aud claim, unchecked when empty
+}
+
+// QuotaConfig holds the per user upload limits. Limits of zero are
+// unlimited and quotas are off without a table.
+type QuotaConfig struct {
+	TableName        string
+	MaxOpenSessions  int64 // Sessions that are neither completed, aborted, failed nor expired
+	MaxInFlightBytes int64 // Total file size of the open sessions
+	MaxDailyBytes    int64 // Bytes stored per UTC day
+}
+
+func (q QuotaConfig) Enabled() bool {
+	return q.TableName != ""
+}
+
+// RateLimitConfig holds the token bucket limits. A rate of zero turns the
+// limit off, a burst of zero defaults to one second at the rate. Buckets are
+// kept in Redis when an address is set and in memory otherwise.
+type RateLimitConfig struct {
+	RequestsPerSecond    float64 // Requests per client
+	RequestsBurst        int64
+	BytesPerSecond       int64 // Uploaded bytes per client
+	BytesBurst           int64
+	UploadBytesPerSecond int64 // Uploaded bytes per upload session
+	UploadBytesBurst     int64
+	APIKeyHeader         string // Header a gateway sets to the caller API key, ignored when empty
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+func (r RateLimitConfig) Enabled() bool {
+	return r.RequestsPerSecond > 0 || r.BytesPerSecond > 0 || r.UploadBytesPerSecond > 0
+}
+
+// Server side encryption modes of EncryptionConfig.
+const (
+	EncryptionNone   = "none"
+	EncryptionSSES3  = "sse-s3"
+	EncryptionSSEKMS = "sse-kms"
+)
+
+// EncryptionConfig selects how the chunks of new sessions are encrypted at
+// rest. Sessions created with a customer key use SSE-C whatever the mode.
+type EncryptionConfig struct {
+	Mode              string            // none, sse-s3 or sse-kms
+	KMSKeyID          string            // Default key of sse-kms, the AWS managed key when empty
+	TenantKMSKeys     map[string]string // Key of sse-kms per tenant
+	TenantClaim       string            // Token claim naming the tenant of the caller
+	AllowCustomerKeys bool              // Accept SSE-C keys sent by clients
+}
+
+// KMSKey returns the KMS key of the tenant, the default key when it has
+// none of its own.
+func (e EncryptionConfig) KMSKey(tenant string) string {
+	if key, ok := e.TenantKMSKeys[tenant]; ok && tenant != "" {
+		return key
+	}
+	return e.KMSKeyID
+}
+
+// Key providers of EnvelopeConfig.
+const (
+	KeyProviderNone  = "none"
+	KeyProviderLocal = "local"
+	KeyProviderKMS   = "kms"
+)
+
+// EnvelopeConfig turns on encryption of chunk data by the service itself.
+// Each new session gets a data key wrapped by a master key of the provider.
+type EnvelopeConfig struct {
+	KeyProvider string        // none, local or kms
+	KeyringFile string        // JSON keyring of the local provider
+	KMSKeyID    string        // Master key of the kms provider
+	KeyCacheTTL time.Duration // How long unwrapped data keys are kept in memory
+}
+
+func (e EnvelopeConfig) Enabled() bool {
+	return e.KeyProvider != KeyProviderNone
+}
+
+// EventsConfig holds the upload progress streams. Events are shared between
+// instances over Redis when an address is set and stay on the instance that
+// published them otherwise.
+type EventsConfig struct {
+	Heartbeat     time.Duration // Interval of keep alive messages on idle streams
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	RedisChannel  string
+}
+
+// GRPCConfig holds the gRPC upload API, served next to the HTTP API when an
+// address is set.
+type GRPCConfig struct {
+	Addr string
+}
+
+func (g GRPCConfig) Enabled() bool {
+	return g.Addr != ""
+}
+
+const (
+	// DefaultMaxChunkSize is the chunk body limit when MAX_CHUNK_SIZE is unset.
+	DefaultMaxChunkSize int64 = 64 * 1024 * 1024
+	// DefaultMaxCompressionRatio bounds how far encoded chunks may expand when
+	// MAX_COMPRESSION_RATIO is unset.
+	DefaultMaxCompressionRatio int64 = 200
+)
+
+// LimitsConfig bounds request bodies.
+type LimitsConfig struct {
+	MaxChunkSize        int64 // Largest chunk or part body, and largest chunk size of a session
+	MaxCompressionRatio int64 // Decoded bytes per encoded byte of gzip or zstd chunks, unchecked when zero
+}
+
+type Settings struct {
+	Limits     *LimitsConfig
+	Auth       *AuthConfig
+	Quota      *QuotaConfig
+	RateLimit  *RateLimitConfig
+	Encryption *EncryptionConfig
+	Envelope   *EnvelopeConfig
+	Events     *EventsConfig
+	GRPC       *GRPCConfig
+}
+
+func Load() Settings {
+	return Settings{
+		Limits: &LimitsConfig{
+			MaxChunkSize:        int64Env("MAX_CHUNK_SIZE", DefaultMaxChunkSize),
+			MaxCompressionRatio: int64Env("MAX_COMPRESSION_RATIO", DefaultMaxCompressionRatio),
+		},
+		Auth: &AuthConfig{
+			Enabled:    boolEnv("AUTH_ENABLED", true),
+			HMACSecret: stringEnv("JWT_HMAC_SECRET", ""),
+			JWKSFile:   stringEnv("JWT_JWKS_FILE", ""),
+			JWKSURL:    stringEnv("JWT_JWKS_URL", ""),
+			Issuer:     stringEnv("JWT_ISSUER", ""),
+			Audience:   stringEnv("JWT_AUDIENCE", ""),
+		},
+		Quota: &QuotaConfig{
+			TableName:        stringEnv("DYNAMODB_QUOTAS_TABLE_NAME", ""),
+			MaxOpenSessions:  int64Env("QUOTA_MAX_OPEN_SESSIONS", 0),
+			MaxInFlightBytes: int64Env("QUOTA_MAX_IN_FLIGHT_BYTES", 0),
+			MaxDailyBytes:    int64Env("QUOTA_MAX_DAILY_BYTES", 0),
+		},
+		RateLimit: loadRateLimit(),
+		Encryption: &EncryptionConfig{
+			Mode:              stringEnv("SSE_MODE", EncryptionNone),
+			KMSKeyID:          stringEnv("SSE_KMS_KEY_ID", ""),
+			TenantKMSKeys:     mapEnv("SSE_KMS_TENANT_KEYS"),
+			TenantClaim:       stringEnv("SSE_TENANT_CLAIM", "tenant_id"),
+			AllowCustomerKeys: boolEnv("SSE_CUSTOMER_KEYS_ENABLED", true),
+		},
+		Envelope: &EnvelopeConfig{
+			KeyProvider: stringEnv("ENVELOPE_KEY_PROVIDER", KeyProviderNone),
+			KeyringFile: stringEnv("ENVELOPE_KEYRING_FILE", ""),
+			KMSKeyID:    stringEnv("ENVELOPE_KMS_KEY_ID", ""),
+			KeyCacheTTL: time.Duration(int64Env("ENVELOPE_KEY_CACHE_SECONDS", 300)) * time.Second,
+		},
+		Events: &EventsConfig{
+			Heartbeat:     time.Duration(int64Env("EVENTS_HEARTBEAT_SECONDS", 15)) * time.Second,
+			RedisAddr:     stringEnv("EVENTS_REDIS_ADDR", ""),
+			RedisPassword: stringEnv("EVENTS_REDIS_PASSWORD", ""),
+			RedisDB:       int(int64Env("EVENTS_REDIS_DB", 0)),
+			RedisChannel:  stringEnv("EVENTS_REDIS_CHANNEL", "uploads:events"),
+		},
+		GRPC: &GRPCConfig{
+			Addr: stringEnv("GRPC_ADDR", ""),
+		},
+	}
+}
+
+func loadRateLimit() *RateLimitConfig {
+	r := &RateLimitConfig{
+		RequestsPerSecond:    floatEnv("RATE_LIMIT_REQUESTS_PER_SEC", 0),
+		RequestsBurst:        int64Env("RATE_LIMIT_REQUESTS_BURST", 0),
+		BytesPerSecond:       int64Env("RATE_LIMIT_BYTES_PER_SEC", 0),
+		BytesBurst:           int64Env("RATE_LIMIT_BYTES_BURST", 0),
+		UploadBytesPerSecond: int64Env("RATE_LIMIT_UPLOAD_BYTES_PER_SEC", 0),
+		UploadBytesBurst:     int64Env("RATE_LIMIT_UPLOAD_BYTES_BURST", 0),
+		APIKeyHeader:         stringEnv("RATE_LIMIT_API_KEY_HEADER", ""),
+		RedisAddr:            stringEnv("RATE_LIMIT_REDIS_ADDR", ""),
+		RedisPassword:        stringEnv("RATE_LIMIT_REDIS_PASSWORD", ""),
+		RedisDB:              int(int64Env("RATE_LIMIT_REDIS_DB", 0)),
+	}
+	if r.RequestsBurst == 0 {
+		r.RequestsBurst = int64(math.Ceil(r.RequestsPerSecond))
+	}
+	if r.BytesBurst == 0 {
+		r.BytesBurst = r.BytesPerSecond
+	}
+	if r.UploadBytesBurst == 0 {
+		r.UploadBytesBurst = r.UploadBytesPerSecond
+	}
+	return r
+}
+
+func (s Settings) Validate() error {
+	if s.Limits.MaxChunkSize <= 0 {
+		return errors.New("MAX_CHUNK_SIZE must be positive")
+	}
+	if s.Limits.MaxCompressionRatio < 0 {
+		return errors.New("MAX_COMPRESSION_RATIO must not be negative")
+	}
+	if s.Auth.Enabled && s.Auth.HMACSecret == "" && s.Auth.JWKSFile == "" && s.Auth.JWKSURL == "" {
+		return errors.New("auth is enabled but none of JWT_HMAC_SECRET, JWT_JWKS_FILE or JWT_JWKS_URL is set, set one of them or AUTH_ENABLED=false")
+	}
+	if s.Auth.JWKSFile != "" && s.Auth.JWKSURL != "" {
+		return errors.New("JWT_JWKS_FILE and JWT_JWKS_URL are mutually exclusive")
+	}
+	if s.Quota.MaxOpenSessions < 0 || s.Quota.MaxInFlightBytes < 0 || s.Quota.MaxDailyBytes < 0 {
+		return errors.New("quota limits must not be negative")
+	}
+	if !s.Quota.Enabled() && (s.Quota.MaxOpenSessions > 0 || s.Quota.MaxInFlightBytes > 0 || s.Quota.MaxDailyBytes > 0) {
+		return errors.New("quota limits are set but DYNAMODB_QUOTAS_TABLE_NAME is not")
+	}
+	r := s.RateLimit
+	if r.RequestsPerSecond < 0 || r.RequestsBurst < 0 || r.BytesPerSecond < 0 || r.BytesBurst < 0 ||
+		r.UploadBytesPerSecond < 0 || r.UploadBytesBurst < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	e := s.Encryption
+	switch e.Mode {
+	case EncryptionNone, EncryptionSSES3, EncryptionSSEKMS:
+	default:
+		return fmt.Errorf("SSE_MODE must be one of %s, %s or %s", EncryptionNone, EncryptionSSES3, EncryptionSSEKMS)
+	}
+	if (e.KMSKeyID != "" || len(e.TenantKMSKeys) > 0) && e.Mode != EncryptionSSEKMS {
+		return errors.New("SSE_KMS_KEY_ID and SSE_KMS_TENANT_KEYS need SSE_MODE=sse-kms")
+	}
+	for tenant, key := range e.TenantKMSKeys {
+		if key == "" {
+			return fmt.Errorf("SSE_KMS_TENANT_KEYS has no key for tenant %q", tenant)
+		}
+	}
+	v := s.Envelope
+	switch v.KeyProvider {
+	case KeyProviderNone:
+	case KeyProviderLocal:
+		if v.KeyringFile == "" {
+			return errors.New("ENVELOPE_KEY_PROVIDER=local needs ENVELOPE_KEYRING_FILE")
+		}
+	case KeyProviderKMS:
+		if v.KMSKeyID == "" {
+			return errors.New("ENVELOPE_KEY_PROVIDER=kms needs ENVELOPE_KMS_KEY_ID")
+		}
+	default:
+		return fmt.Errorf("ENVELOPE_KEY_PROVIDER must be one of %s, %s or %s", KeyProviderNone, KeyProviderLocal, KeyProviderKMS)
+	}
+	if v.KeyCacheTTL < 0 {
+		return errors.New("ENVELOPE_KEY_CACHE_SECONDS must not be negative")
+	}
+	if s.Events.Heartbeat <= 0 {
+		return errors.New("EVENTS_HEARTBEAT_SECONDS must be positive")
+	}
+	if s.Events.RedisAddr != "" && s.Events.RedisChannel == "" {
+		return errors.New("EVENTS_REDIS_ADDR needs EVENTS_REDIS_CHANNEL")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -11,37 +12,57 @@ import (
 	common "github.com/Yulian302/lfusys-services-commons"
 	"github.com/Yulian302/lfusys-services-commons/config"
 	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/envelope"
+	"github.com/Yulian302/lfusys-services-uploads/events"
+	"github.com/Yulian302/lfusys-services-uploads/ratelimit"
+	"github.com/Yulian302/lfusys-services-uploads/settings"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
 )
 
 type App struct {
-	Server *http.Server
+	Server     *http.Server
+	GRPCServer *grpc.Server
 
 	DynamoDB *dynamodb.Client
 	S3       *s3.Client
 	Sqs      *sqs.Client
 
 	Config    config.Config
+	Settings  settings.Settings
 	AwsConfig aws.Config
+	Verifier  *auth.Verifier
+	Limiter   ratelimit.Limiter
+	Keys      envelope.KeyProvider
+	Events    *events.Bus
+	Fanout    events.Fanout
 
 	Services       *Services
 	TracerProvider *trace.TracerProvider
 	Logger         logger.Logger
 }
 
-func SetupApp() (*App, error) {
-	cfg := config.LoadConfig()
-
+// SetupApp builds the app from cfg. appLogger is created by the caller so
+// initialization errors can be reported with it.
+func SetupApp(cfg config.Config, appLogger logger.Logger) (*App, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
+	st := settings.Load()
+	if err := st.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+
 	if strings.EqualFold(cfg.Env, "PROD") {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -66,18 +87,49 @@ func SetupApp() (*App, error) {
 		return nil, errors.New("could not init sqs")
 	}
 
-	appLogger := logger.NewSlogLogger(logger.CreateAppLogger(cfg.Env))
-
 	app := &App{
 		DynamoDB: db,
 		S3:       s3,
 		Sqs:      sqs,
 
 		Config:    cfg,
+		Settings:  st,
 		AwsConfig: awsCfg,
 		Logger:    appLogger,
 	}
 
+	if st.Auth.Enabled {
+		verifier, err := auth.NewVerifier(context.Background(), st.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("init auth: %w", err)
+		}
+		app.Verifier = verifier
+	} else {
+		app.Logger.Warn("authentication disabled, upload sessions are not bound to their owners")
+	}
+
+	if st.RateLimit.Enabled() {
+		app.Limiter = initLimiter(st.RateLimit)
+	}
+
+	if st.Envelope.Enabled() {
+		keys, err := initKeyProvider(st.Envelope, awsCfg)
+		if err != nil {
+			return nil, fmt.Errorf("init key provider: %w", err)
+		}
+		app.Keys = keys
+	}
+
+	if st.Events.RedisAddr != "" {
+		app.Fanout = events.NewRedisFanout(redis.NewClient(&redis.Options{
+			Addr:     st.Events.RedisAddr,
+			Password: st.Events.RedisPassword,
+			DB:       st.Events.RedisDB,
+		}), st.Events.RedisChannel)
+	}
+	app.Events = events.NewBus(app.Fanout, appLogger)
+	app.Events.Start()
+
 	if cfg.Tracing {
 		tp, err := common.InitTracer(context.Background(), "uploads", cfg.TracingAddr)
 		if err != nil {
@@ -99,10 +151,21 @@ func (a *App) Run(r *gin.Engine) error {
 		Addr:    a.Config.UploadsAddr,
 		Handler: r,
 	}
+	// progress streams never finish by themselves
+	a.Server.RegisterOnShutdown(a.Events.Close)
 
 	return a.Server.ListenAndServe()
 }
 
+func (a *App) RunGRPC() error {
+	lis, err := net.Listen("tcp", a.Settings.GRPC.Addr)
+	if err != nil {
+		return err
+	}
+
+	return a.GRPCServer.Serve(lis)
+}
+
 func initAWS(cfg config.AWSConfig) (aws.Config, error) {
 	awsCfg, err := awsconfig.LoadDefaultConfig(
 		context.Background(),
@@ -126,6 +189,38 @@ func initSqs(cfg aws.Config) *sqs.Client {
 	return sqs.NewFromConfig(cfg)
 }
 
+func initLimiter(cfg *settings.RateLimitConfig) ratelimit.Limiter {
+	if cfg.RedisAddr == "" {
+		return ratelimit.NewMemoryLimiter()
+	}
+	return ratelimit.NewRedisLimiter(redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	}))
+}
+
+func initKeyProvider(cfg *settings.EnvelopeConfig, awsCfg aws.Config) (envelope.KeyProvider, error) {
+	var provider envelope.KeyProvider
+	switch cfg.KeyProvider {
+	case settings.KeyProviderLocal:
+		keyring, err := envelope.NewLocalKeyring(cfg.KeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		provider = keyring
+	case settings.KeyProviderKMS:
+		provider = envelope.NewKMSProvider(kms.NewFromConfig(awsCfg), cfg.KMSKeyID)
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", cfg.KeyProvider)
+	}
+
+	if cfg.KeyCacheTTL > 0 {
+		provider = envelope.NewCachingProvider(provider, cfg.KeyCacheTTL)
+	}
+	return provider, nil
+}
+
 func (a *App) Shutdown(ctx context.Context) error {
 	a.Logger.Info("starting graceful shutdown")
 
@@ -135,12 +230,39 @@ func (a *App) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// calls in flight still use the services, so they drain first
+	if a.GRPCServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			a.GRPCServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			a.GRPCServer.Stop()
+			a.Logger.Error("grpc server shutdown failed", "err", ctx.Err().Error())
+		}
+	}
+
 	if a.Services != nil {
 		if err := a.Services.Shutdown(ctx); err != nil {
 			a.Logger.Error("services shutdown failed", "err", err.Error())
 		}
 	}
 
+	if a.Events != nil {
+		if err := a.Events.Shutdown(ctx); err != nil {
+			a.Logger.Error("event bus shutdown failed", "err", err.Error())
+		}
+	}
+
+	if sh, ok := a.Limiter.(Shutdowner); ok {
+		if err := sh.Shutdown(ctx); err != nil {
+			a.Logger.Error("rate limiter shutdown failed", "err", err.Error())
+		}
+	}
+
 	if a.TracerProvider != nil {
 		if err := a.TracerProvider.Shutdown(ctx); err != nil {
 			a.Logger.Error("tracer shutdown failed", "err", err.Error())
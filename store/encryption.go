@@ -0,0 +1,206 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/envelope"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Server side encryption modes recorded on sessions.
+const (
+	EncryptionNone   = ""
+	EncryptionS3     = "AES256"
+	EncryptionKMS    = "aws:kms"
+	EncryptionCustom = "SSE-C"
+
+	// CustomerKeySize is the length of an SSE-C key, S3 only accepts AES-256.
+	CustomerKeySize = 32
+)
+
+// Encryption is how the chunks of a session are encrypted at rest. The SSE-C
+// key is never stored, clients send it with every request that reads or
+// writes chunks. A DataKey has the chunk store encrypt chunk data itself
+// before it is sent to the bucket, on top of any server side encryption.
+type Encryption struct {
+	Mode        string
+	KMSKeyID    string // KMS key of aws:kms, the AWS managed key when empty
+	CustomerKey []byte // AES-256 key of SSE-C
+	DataKey     []byte // Unwrapped AES-256 data key of the session
+}
+
+// CustomerKeyMD5 returns the base64 MD5 S3 uses to check an SSE-C key.
+func CustomerKeyMD5(key []byte) string {
+	sum := md5.Sum(key)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParseCustomerKey decodes a base64 SSE-C key and checks it against the
+// base64 MD5 the client sent along, when it sent one.
+func ParseCustomerKey(value string, keyMD5 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != CustomerKeySize {
+		return nil, ErrInvalidCustomerKey
+	}
+	if keyMD5 != "" && keyMD5 != CustomerKeyMD5(key) {
+		return nil, ErrInvalidCustomerKey
+	}
+	return key, nil
+}
+
+// CustomerKeyHeaders names the request headers carrying a base64 SSE-C key
+// and its base64 MD5. Algorithm, when set, names a header that has to be
+// AES256 whenever a key is sent, as S3 requires.
+type CustomerKeyHeaders struct {
+	Key       string
+	KeyMD5    string
+	Algorithm string
+}
+
+// DefaultCustomerKeyHeaders are the SSE-C headers of the uploads and tus
+// APIs, modelled on the x-amz-server-side-encryption-customer-* headers.
+var DefaultCustomerKeyHeaders = CustomerKeyHeaders{
+	Key:    "X-SSE-Customer-Key",
+	KeyMD5: "X-SSE-Customer-Key-MD5",
+}
+
+// CustomerKey returns the SSE-C key sent in header, nil when none was sent.
+func (h CustomerKeyHeaders) CustomerKey(header http.Header) ([]byte, error) {
+	value := header.Get(h.Key)
+	if value == "" {
+		return nil, nil
+	}
+	if h.Algorithm != "" && header.Get(h.Algorithm) != string(types.ServerSideEncryptionAes256) {
+		return nil, ErrInvalidCustomerKey
+	}
+	return ParseCustomerKey(value, header.Get(h.KeyMD5))
+}
+
+type encryptionKey struct{}
+
+// WithEncryption returns ctx carrying the encryption the chunk store applies
+// to chunk reads and writes made with it.
+func WithEncryption(ctx context.Context, enc Encryption) context.Context {
+	return context.WithValue(ctx, encryptionKey{}, enc)
+}
+
+// EncryptionFromContext returns the encryption carried by ctx, none when it
+// carries none.
+func EncryptionFromContext(ctx context.Context) Encryption {
+	enc, _ := ctx.Value(encryptionKey{}).(Encryption)
+	return enc
+}
+
+func (e Encryption) customerKeyParams() (*string, *string, *string) {
+	if e.Mode != EncryptionCustom {
+		return nil, nil, nil
+	}
+	return aws.String(string(types.ServerSideEncryptionAes256)),
+		aws.String(base64.StdEncoding.EncodeToString(e.CustomerKey)),
+		aws.String(CustomerKeyMD5(e.CustomerKey))
+}
+
+func (e Encryption) applyPut(in *s3.PutObjectInput) {
+	switch e.Mode {
+	case EncryptionS3:
+		in.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case EncryptionKMS:
+		in.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if e.KMSKeyID != "" {
+			in.SSEKMSKeyId = aws.String(e.KMSKeyID)
+		}
+	case EncryptionCustom:
+		in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerKeyParams()
+	}
+}
+
+// applyCopy encrypts the copy like applyPut, an SSE-C source is read with the
+// same customer key it is written with.
+func (e Encryption) applyCopy(in *s3.CopyObjectInput) {
+	switch e.Mode {
+	case EncryptionS3:
+		in.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case EncryptionKMS:
+		in.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if e.KMSKeyID != "" {
+			in.SSEKMSKeyId = aws.String(e.KMSKeyID)
+		}
+	case EncryptionCustom:
+		in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerKeyParams()
+		in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = e.customerKeyParams()
+	}
+}
+
+func (e Encryption) applyGet(in *s3.GetObjectInput) {
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerKeyParams()
+}
+
+func (e Encryption) applyHead(in *s3.HeadObjectInput) {
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerKeyParams()
+}
+
+// sealChunk returns the length bytes of a chunk body sealed with the data key
+// in segments, so a chunk is never held in memory whole, and the base64
+// nonce prefix to store with it. The object key is authenticated along, so a
+// sealed chunk only opens at the key it was written to.
+func sealChunk(dataKey []byte, key string, body io.Reader, length int64) (io.Reader, string, error) {
+	prefix, sealed, err := envelope.NewSealReader(dataKey, body, length, []byte(key))
+	if err != nil {
+		return nil, "", err
+	}
+	return sealed, base64.StdEncoding.EncodeToString(prefix), nil
+}
+
+// openChunk returns the data of a sealed chunk object, which closes the
+// object body. Segmented chunks are opened as they are read, chunks sealed
+// whole by earlier versions are read and opened at once.
+func openChunk(dataKey []byte, key string, body io.ReadCloser, nonce string, segmented bool) (io.ReadCloser, error) {
+	if dataKey == nil {
+		body.Close()
+		return nil, ErrDataKeyRequired
+	}
+	rawNonce, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("invalid %s metadata: %w", chunkNonceMetadataKey, err)
+	}
+
+	if segmented {
+		opened, err := envelope.NewOpenReader(dataKey, rawNonce, body, []byte(key))
+		if err != nil {
+			body.Close()
+			return nil, fmt.Errorf("failed to decrypt chunk: %w", err)
+		}
+		return &openedChunk{Reader: opened, body: body}, nil
+	}
+
+	defer body.Close()
+	sealed, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk: %w", err)
+	}
+
+	data, err := envelope.Open(dataKey, rawNonce, sealed, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt chunk: %w", err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// openedChunk closes the stored object of a chunk opened as it is read.
+type openedChunk struct {
+	io.Reader
+	body io.Closer
+}
+
+func (o *openedChunk) Close() error {
+	return o.body.Close()
+}
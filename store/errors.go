@@ -0,0 +1,24 @@
+package store
+
+import "errors"
+
+var (
+	ErrChunkNotFound    = errors.New("chunk not found")
+	ErrSessionAborted   = errors.New("upload session aborted")
+	ErrSessionCompleted = errors.New("upload session already completed")
+	ErrSessionFailed    = errors.New("upload session failed verification")
+	ErrSessionExpired   = errors.New("upload session expired")
+	ErrOffsetConflict   = errors.New("upload offset changed concurrently")
+	ErrChunkOutOfRange  = errors.New("chunk index out of range")
+	ErrChunkSize        = errors.New("chunk size does not match session")
+
+	ErrInvalidCustomerKey  = errors.New("invalid encryption key")
+	ErrCustomerKeyRequired = errors.New("upload is encrypted with a customer key")
+	ErrCustomerKeyMismatch = errors.New("encryption key does not match upload")
+	ErrDataKeyRequired     = errors.New("chunk is encrypted with a data key")
+	ErrPresignEncrypted    = errors.New("uploads encrypted by the service cannot be presigned")
+
+	ErrQuotaOpenSessions  = errors.New("too many open upload sessions")
+	ErrQuotaInFlightBytes = errors.New("too many bytes in open upload sessions")
+	ErrQuotaDailyBytes    = errors.New("daily upload volume exceeded")
+)
@@ -1,6 +1,271 @@
 package store
 
+import (
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+)
+
+const DefaultChunkSize int64 = 5 * 1024 * 1024
+
+// SessionTTL is how long a new session accepts chunks before it expires.
+const SessionTTL = 24 * time.Hour
+
+const (
+	SessionStatusPending    = "pending"
+	SessionStatusInProgress = "in_progress"
+	SessionStatusCompleted  = "completed"
+	SessionStatusAborted    = "aborted"
+	SessionStatusFailed     = "failed"
+
+	// SessionStatusExpired is reported for pending and in progress sessions
+	// past their expiry. It is never stored.
+	SessionStatusExpired = "expired"
+)
+
 type UploadSession struct {
-	TotalChunks    uint32 `dynamodbav:"total_chunks"`              // Number of 5MB chunks required
-	UploadedChunks []int  `dynamodbav:"uploaded_chunks,omitempty"` // Bitmask of uploaded chunks (in bytes)
+	UploadID          string   `dynamodbav:"upload_id"`
+	Status            string   `dynamodbav:"status,omitempty"`
+	OwnerID           string   `dynamodbav:"owner_id,omitempty"` // Subject of the caller that created the session
+	FileName          string   `dynamodbav:"file_name,omitempty"`
+	FileSize          int64    `dynamodbav:"file_size,omitempty"`
+	FileHash          string   `dynamodbav:"file_hash,omitempty"`
+	HashAlgorithm     string   `dynamodbav:"hash_algorithm,omitempty"`      // Default chunk hash, sha-256 when unset
+	FileHashAlgorithm string   `dynamodbav:"file_hash_algorithm,omitempty"` // Algorithm of FileHash, sha-256 when unset
+	MerkleRoot        string   `dynamodbav:"merkle_root,omitempty"`         // Hex root over the chunk hashes
+	FailureReason     string   `dynamodbav:"failure_reason,omitempty"`
+	ChunkSize         int64    `dynamodbav:"chunk_size,omitempty"`
+	MaxChunkSize      int64    `dynamodbav:"max_chunk_size,omitempty"`   // Largest chunk body accepted, unbounded by the session when unset
+	StorageEncoding   string   `dynamodbav:"storage_encoding,omitempty"` // gzip or zstd to store chunks compressed, decoded when unset
+	Encryption        string   `dynamodbav:"encryption,omitempty"`       // AES256, aws:kms or SSE-C, unencrypted when unset
+	KMSKeyID          string   `dynamodbav:"kms_key_id,omitempty"`
+	CustomerKeyMD5    string   `dynamodbav:"customer_key_md5,omitempty"` // Base64 MD5 of the SSE-C key
+	WrappedDataKey    []byte   `dynamodbav:"wrapped_data_key,omitempty"` // Data key the service encrypts chunks with, wrapped by DataKeyID
+	DataKeyID         string   `dynamodbav:"data_key_id,omitempty"`      // Master key of the key provider that wrapped the data key
+	Offset            int64    `dynamodbav:"upload_offset,omitempty"`    // Bytes committed by offset based uploads
+	CreatedAt         int64    `dynamodbav:"created_at,omitempty"`
+	ExpiresAt         int64    `dynamodbav:"expires_at,omitempty"`             // Unix time chunks stop being accepted, never when unset
+	TotalChunks       uint32   `dynamodbav:"total_chunks"`                     // Number of 5MB chunks required
+	UploadedChunks    []int    `dynamodbav:"uploaded_chunks,omitempty"`        // Bitmask of uploaded chunks (in bytes)
+	ChunkDigests      []string `dynamodbav:"chunk_hashes,stringset,omitempty"` // "<idx>:<algorithm>:<hex>" per stored chunk
+}
+
+// ChunkHash is the recorded hash of a stored chunk.
+type ChunkHash struct {
+	Index     uint32
+	Algorithm string
+	Hash      string // hex encoded
+}
+
+func (h ChunkHash) String() string {
+	return fmt.Sprintf("%d:%s:%s", h.Index, h.Algorithm, h.Hash)
+}
+
+func NewChunkHash(idx uint32, d *digest.Digest) ChunkHash {
+	return ChunkHash{Index: idx, Algorithm: d.Algorithm.Name, Hash: d.Hex()}
+}
+
+func parseChunkHash(value string) (ChunkHash, bool) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 {
+		return ChunkHash{}, false
+	}
+	idx, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return ChunkHash{}, false
+	}
+	return ChunkHash{Index: uint32(idx), Algorithm: parts[1], Hash: parts[2]}, true
+}
+
+// ChunkRange is an inclusive range of chunk indexes.
+type ChunkRange struct {
+	Start uint32
+	End   uint32
+}
+
+// IsTerminal reports whether the session reached a status it never leaves.
+func (s *UploadSession) IsTerminal() bool {
+	switch s.Status {
+	case SessionStatusCompleted, SessionStatusAborted, SessionStatusFailed:
+		return true
+	}
+	return false
+}
+
+// Expired reports whether the session is still open but past its expiry.
+func (s *UploadSession) Expired(now time.Time) bool {
+	return !s.IsTerminal() && s.ExpiresAt > 0 && now.Unix() >= s.ExpiresAt
+}
+
+// CurrentStatus returns the status of the session at now, reporting open
+// sessions past their expiry as expired.
+func (s *UploadSession) CurrentStatus(now time.Time) string {
+	if s.Expired(now) {
+		return SessionStatusExpired
+	}
+	return s.Status
+}
+
+// CheckWritable returns the error for a session that no longer accepts
+// chunks at now, or nil while it is pending or in progress.
+func (s *UploadSession) CheckWritable(now time.Time) error {
+	switch s.CurrentStatus(now) {
+	case SessionStatusCompleted:
+		return ErrSessionCompleted
+	case SessionStatusAborted:
+		return ErrSessionAborted
+	case SessionStatusFailed:
+		return ErrSessionFailed
+	case SessionStatusExpired:
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+func (s *UploadSession) EffectiveChunkSize() int64 {
+	if s.ChunkSize > 0 {
+		return s.ChunkSize
+	}
+	return DefaultChunkSize
+}
+
+// ChunkLimit returns the largest body accepted for the chunk at idx: the
+// chunk length once the layout is known, else the session limit, and never
+// more than max.
+func (s *UploadSession) ChunkLimit(idx uint32, max int64) int64 {
+	limit := max
+	if s.MaxChunkSize > 0 {
+		limit = min(limit, s.MaxChunkSize)
+	}
+	if s.TotalChunks > 0 && s.FileSize > 0 {
+		limit = min(limit, s.ChunkLength(idx))
+	}
+	return limit
+}
+
+// ChunkEncryption returns the encryption of the session chunks. SSE-C
+// sessions need the key the client created them with.
+func (s *UploadSession) ChunkEncryption(customerKey []byte) (Encryption, error) {
+	if s.Encryption != EncryptionCustom {
+		return Encryption{Mode: s.Encryption, KMSKeyID: s.KMSKeyID}, nil
+	}
+	if customerKey == nil {
+		return Encryption{}, ErrCustomerKeyRequired
+	}
+	if subtle.ConstantTimeCompare([]byte(CustomerKeyMD5(customerKey)), []byte(s.CustomerKeyMD5)) != 1 {
+		return Encryption{}, ErrCustomerKeyMismatch
+	}
+	return Encryption{Mode: EncryptionCustom, CustomerKey: customerKey}, nil
+}
+
+func (s *UploadSession) ChunkHashAlgorithm() string {
+	if s.HashAlgorithm != "" {
+		return s.HashAlgorithm
+	}
+	return digest.Default
+}
+
+// RecordedHashes returns the hashes recorded for the chunk at idx. A chunk
+// stored more than once with different content has several.
+func (s *UploadSession) RecordedHashes(idx uint32) []ChunkHash {
+	var hashes []ChunkHash
+	for _, value := range s.ChunkDigests {
+		if h, ok := parseChunkHash(value); ok && h.Index == idx {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+func (s *UploadSession) HasChunk(idx uint32) bool {
+	for _, uploaded := range s.UploadedChunks {
+		if uploaded == int(idx) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReceivedChunks returns the sorted indexes of the chunks already stored.
+// Sessions created without a length accept any index until they complete.
+func (s *UploadSession) ReceivedChunks() []uint32 {
+	received := make([]uint32, 0, len(s.UploadedChunks))
+	for _, idx := range s.UploadedChunks {
+		if idx < 0 || (s.TotalChunks > 0 && uint32(idx) >= s.TotalChunks) {
+			continue
+		}
+		received = append(received, uint32(idx))
+	}
+	sort.Slice(received, func(i, j int) bool { return received[i] < received[j] })
+	return received
+}
+
+// MissingRanges returns the chunk indexes not received yet, collapsed into ranges.
+func (s *UploadSession) MissingRanges() []ChunkRange {
+	ranges := []ChunkRange{}
+	next := uint32(0)
+	for _, idx := range s.ReceivedChunks() {
+		if idx > next {
+			ranges = append(ranges, ChunkRange{Start: next, End: idx - 1})
+		}
+		next = idx + 1
+	}
+	if next < s.TotalChunks {
+		ranges = append(ranges, ChunkRange{Start: next, End: s.TotalChunks - 1})
+	}
+	return ranges
+}
+
+// ChunkLength returns the expected length of the chunk at idx. Only the last
+// chunk may be shorter than the session chunk size.
+func (s *UploadSession) ChunkLength(idx uint32) int64 {
+	size := s.EffectiveChunkSize()
+	if s.FileSize <= 0 || idx+1 < s.TotalChunks {
+		return size
+	}
+	return s.FileSize - size*int64(s.TotalChunks-1)
+}
+
+// ValidateChunkIndex rejects indexes past the last chunk. Sessions without a
+// length accept any index until their layout is set.
+func (s *UploadSession) ValidateChunkIndex(idx uint32) error {
+	if s.TotalChunks > 0 && idx >= s.TotalChunks {
+		return fmt.Errorf("%w: chunk %d requested, session has %d chunks", ErrChunkOutOfRange, idx, s.TotalChunks)
+	}
+	return nil
+}
+
+// ValidateChunk checks a chunk against the session layout. Every chunk but
+// the last is exactly the chunk size and the last one holds the remainder.
+func (s *UploadSession) ValidateChunk(idx uint32, size int64) error {
+	if err := s.ValidateChunkIndex(idx); err != nil {
+		return err
+	}
+	if s.TotalChunks == 0 || s.FileSize <= 0 {
+		return nil
+	}
+	if expected := s.ChunkLength(idx); size != expected {
+		return fmt.Errorf("%w: chunk %d must be %d bytes, got %d", ErrChunkSize, idx, expected, size)
+	}
+	return nil
+}
+
+func (s *UploadSession) TotalBytes() int64 {
+	if s.FileSize > 0 {
+		return s.FileSize
+	}
+	return s.EffectiveChunkSize() * int64(s.TotalChunks)
+}
+
+func (s *UploadSession) ReceivedBytes() int64 {
+	var received int64
+	for _, idx := range s.ReceivedChunks() {
+		received += s.ChunkLength(idx)
+	}
+	return received
 }
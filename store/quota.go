@@ -0,0 +1,456 @@
+package store
+
+import (
+	"context"
+	cerr "errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yulian302/lfusys-services-commons/health"
+	"github.com/Yulian302/lfusys-services-commons/retries"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dailyUsageTTL keeps daily usage items around a day past the day they count.
+const dailyUsageTTL = 48 * time.Hour
+
+// leaseBytesPrefix names the attribute counting the bytes a lease of zero
+// bytes reserved as the chunks of its session were stored.
+const leaseBytesPrefix = "lease_bytes_"
+
+func leaseBytesName(uploadID string) string {
+	return leaseBytesPrefix + uploadID
+}
+
+// SessionLease is the share of a user's quota held by an open session.
+// Sessions opened without a size lease zero bytes and reserve bytes as their
+// chunks are stored instead.
+type SessionLease struct {
+	UploadID  string
+	Bytes     int64
+	ExpiresAt int64 // Unix time the lease lapses with its session, never when zero
+}
+
+func (l SessionLease) String() string {
+	return fmt.Sprintf("%s|%d|%d", l.UploadID, l.ExpiresAt, l.Bytes)
+}
+
+func parseSessionLease(value string) (SessionLease, bool) {
+	parts := strings.SplitN(value, "|", 3)
+	if len(parts) != 3 {
+		return SessionLease{}, false
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return SessionLease{}, false
+	}
+	bytes, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return SessionLease{}, false
+	}
+	return SessionLease{UploadID: parts[0], Bytes: bytes, ExpiresAt: expiresAt}, true
+}
+
+// QuotaUsage is what a user currently holds.
+type QuotaUsage struct {
+	Owner         string           `dynamodbav:"quota_key"`
+	OpenSessions  int64            `dynamodbav:"open_sessions"`
+	InFlightBytes int64            `dynamodbav:"in_flight_bytes"`
+	Leases        []string         `dynamodbav:"leases,stringset,omitempty"` // SessionLease per open session
+	LeaseBytes    map[string]int64 `dynamodbav:"-"`                          // Bytes reserved since opening, by upload ID
+}
+
+func unmarshalQuotaUsage(item map[string]types.AttributeValue, usage *QuotaUsage) error {
+	if err := attributevalue.UnmarshalMap(item, usage); err != nil {
+		return err
+	}
+	usage.LeaseBytes = make(map[string]int64)
+	for name, value := range item {
+		uploadID, ok := strings.CutPrefix(name, leaseBytesPrefix)
+		if !ok {
+			continue
+		}
+		var n int64
+		if err := attributevalue.Unmarshal(value, &n); err != nil {
+			return err
+		}
+		usage.LeaseBytes[uploadID] = n
+	}
+	return nil
+}
+
+// QuotaStore keeps per user usage counters. Limits of zero are unlimited.
+type QuotaStore interface {
+	// OpenSession takes a session slot and reserves the lease bytes, failing
+	// with ErrQuotaOpenSessions or ErrQuotaInFlightBytes when a limit would be
+	// exceeded. Leases of expired sessions are released to make room.
+	OpenSession(ctx context.Context, owner string, lease SessionLease, maxSessions int64, maxInFlight int64) error
+	// CloseSession releases the slot and bytes of a session. Releasing a
+	// session twice is a no-op.
+	CloseSession(ctx context.Context, owner string, uploadID string) error
+	// GrowLease reserves n more bytes for a session that leased zero bytes,
+	// failing with ErrQuotaInFlightBytes when maxInFlight would be exceeded. A
+	// negative n gives bytes back. It reports false and changes nothing for
+	// other sessions and ones already closed.
+	GrowLease(ctx context.Context, owner string, uploadID string, n int64, maxInFlight int64) (bool, error)
+	// AddDailyBytes adds n bytes to the usage of the day, failing with
+	// ErrQuotaDailyBytes when the total would exceed limit. A negative n
+	// refunds bytes.
+	AddDailyBytes(ctx context.Context, owner string, day time.Time, n int64, limit int64) error
+
+	health.ReadinessCheck
+}
+
+type DynamoDbQuotaStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewDynamoDbQuotaStore(client *dynamodb.Client, tableName string) *DynamoDbQuotaStore {
+	return &DynamoDbQuotaStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+func (s *DynamoDbQuotaStore) IsReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return retries.Retry(
+		ctx,
+		retries.HealthAttempts,
+		retries.HealthBaseDelay,
+		func() error {
+			_, err := s.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+				TableName: aws.String(s.tableName),
+			})
+
+			return err
+		},
+		retries.IsRetriableDbError,
+	)
+}
+
+func (s *DynamoDbQuotaStore) Name() string {
+	return "QuotaStore[quotas]"
+}
+
+func (s *DynamoDbQuotaStore) OpenSession(ctx context.Context, owner string, lease SessionLease, maxSessions int64, maxInFlight int64) error {
+	if maxInFlight > 0 && lease.Bytes > maxInFlight {
+		return ErrQuotaInFlightBytes
+	}
+
+	usage, err := s.openSession(ctx, owner, lease, maxSessions, maxInFlight)
+	if err == nil || usage == nil {
+		return err
+	}
+
+	// sessions that expired without closing still hold their lease
+	released, err := s.releaseExpired(ctx, usage)
+	if err != nil {
+		return err
+	}
+	if released > 0 {
+		usage, err = s.openSession(ctx, owner, lease, maxSessions, maxInFlight)
+		if err == nil || usage == nil {
+			return err
+		}
+	}
+
+	if maxSessions > 0 && usage.OpenSessions >= maxSessions {
+		return ErrQuotaOpenSessions
+	}
+	return ErrQuotaInFlightBytes
+}
+
+// openSession applies the lease and returns the usage that failed the limits
+// when it could not be applied.
+func (s *DynamoDbQuotaStore) openSession(ctx context.Context, owner string, lease SessionLease, maxSessions int64, maxInFlight int64) (*QuotaUsage, error) {
+	values := map[string]types.AttributeValue{
+		":one":   &types.AttributeValueMemberN{Value: "1"},
+		":bytes": &types.AttributeValueMemberN{Value: strconv.FormatInt(lease.Bytes, 10)},
+		":lease": &types.AttributeValueMemberSS{Value: []string{lease.String()}},
+	}
+	var conditions []string
+	if maxSessions > 0 {
+		conditions = append(conditions, "(attribute_not_exists(open_sessions) OR open_sessions < :max_sessions)")
+		values[":max_sessions"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(maxSessions, 10)}
+	}
+	if maxInFlight > 0 {
+		conditions = append(conditions, "(attribute_not_exists(in_flight_bytes) OR in_flight_bytes <= :room)")
+		values[":room"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(maxInFlight-lease.Bytes, 10)}
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"quota_key": &types.AttributeValueMemberS{Value: owner},
+		},
+		UpdateExpression:                    aws.String("ADD open_sessions :one, in_flight_bytes :bytes, leases :lease"),
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if lease.Bytes == 0 {
+		input.UpdateExpression = aws.String("SET #lease_bytes = :zero ADD open_sessions :one, in_flight_bytes :bytes, leases :lease")
+		input.ExpressionAttributeNames = map[string]string{"#lease_bytes": leaseBytesName(lease.UploadID)}
+		values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+	}
+	if len(conditions) > 0 {
+		input.ConditionExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+
+	var usage *QuotaUsage
+
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, input)
+
+			var cfe *types.ConditionalCheckFailedException
+			if cerr.As(err, &cfe) {
+				usage = &QuotaUsage{}
+				return unmarshalQuotaUsage(cfe.Item, usage)
+			}
+			return err
+		},
+		retries.IsRetriableDbError,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if usage != nil {
+		return usage, ErrQuotaOpenSessions
+	}
+	return nil, nil
+}
+
+// releaseExpired releases the leases of sessions past their expiry and
+// returns how many were released.
+func (s *DynamoDbQuotaStore) releaseExpired(ctx context.Context, usage *QuotaUsage) (int, error) {
+	now := time.Now().Unix()
+	released := 0
+	for _, value := range usage.Leases {
+		lease, ok := parseSessionLease(value)
+		if !ok || lease.ExpiresAt == 0 || lease.ExpiresAt > now {
+			continue
+		}
+		if err := s.release(ctx, usage.Owner, value, lease, usage.LeaseBytes[lease.UploadID]); err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+func (s *DynamoDbQuotaStore) CloseSession(ctx context.Context, owner string, uploadID string) error {
+	var usage QuotaUsage
+
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"quota_key": &types.AttributeValueMemberS{Value: owner},
+				},
+				ConsistentRead: aws.Bool(true),
+			})
+			if err != nil || out.Item == nil {
+				return err
+			}
+			return unmarshalQuotaUsage(out.Item, &usage)
+		},
+		retries.IsRetriableDbError,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range usage.Leases {
+		if lease, ok := parseSessionLease(value); ok && lease.UploadID == uploadID {
+			return s.release(ctx, owner, value, lease, usage.LeaseBytes[uploadID])
+		}
+	}
+	return nil
+}
+
+// release drops a lease and gives back its slot, its bytes and the reserved
+// bytes read with it, unless another caller released it first. Bytes
+// reserved since they were read are read again and released with it.
+func (s *DynamoDbQuotaStore) release(ctx context.Context, owner string, value string, lease SessionLease, reserved int64) error {
+	for range retries.DefaultAttempts {
+		var usage *QuotaUsage
+
+		err := retries.Retry(
+			ctx,
+			retries.DefaultAttempts,
+			retries.DefaultBaseDelay,
+			func() error {
+				_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+					TableName: aws.String(s.tableName),
+					Key: map[string]types.AttributeValue{
+						"quota_key": &types.AttributeValueMemberS{Value: owner},
+					},
+					UpdateExpression:    aws.String("DELETE leases :lease REMOVE #lease_bytes ADD open_sessions :minus_one, in_flight_bytes :minus_bytes"),
+					ConditionExpression: aws.String("contains(leases, :value) AND (attribute_not_exists(#lease_bytes) OR #lease_bytes = :reserved)"),
+					ExpressionAttributeNames: map[string]string{
+						"#lease_bytes": leaseBytesName(lease.UploadID),
+					},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":lease":       &types.AttributeValueMemberSS{Value: []string{value}},
+						":value":       &types.AttributeValueMemberS{Value: value},
+						":reserved":    &types.AttributeValueMemberN{Value: strconv.FormatInt(reserved, 10)},
+						":minus_one":   &types.AttributeValueMemberN{Value: "-1"},
+						":minus_bytes": &types.AttributeValueMemberN{Value: strconv.FormatInt(-lease.Bytes-reserved, 10)},
+					},
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				})
+
+				var cfe *types.ConditionalCheckFailedException
+				if cerr.As(err, &cfe) {
+					usage = &QuotaUsage{}
+					return unmarshalQuotaUsage(cfe.Item, usage)
+				}
+				return err
+			},
+			retries.IsRetriableDbError,
+		)
+		if err != nil || usage == nil || !slices.Contains(usage.Leases, value) {
+			return err
+		}
+		reserved = usage.LeaseBytes[lease.UploadID]
+	}
+	return fmt.Errorf("release lease of upload %s: reserved bytes kept changing", lease.UploadID)
+}
+
+func (s *DynamoDbQuotaStore) GrowLease(ctx context.Context, owner string, uploadID string, n int64, maxInFlight int64) (bool, error) {
+	if maxInFlight > 0 && n > maxInFlight {
+		return false, ErrQuotaInFlightBytes
+	}
+
+	grown, usage, err := s.growLease(ctx, owner, uploadID, n, maxInFlight)
+	if usage == nil {
+		return grown, err
+	}
+
+	// sessions that expired without closing still hold their lease
+	released, err := s.releaseExpired(ctx, usage)
+	if err != nil {
+		return false, err
+	}
+	if released > 0 {
+		if grown, usage, err = s.growLease(ctx, owner, uploadID, n, maxInFlight); usage == nil {
+			return grown, err
+		}
+	}
+	return false, ErrQuotaInFlightBytes
+}
+
+// growLease adds n bytes to the lease and returns the usage that failed the
+// limit when they could not be added.
+func (s *DynamoDbQuotaStore) growLease(ctx context.Context, owner string, uploadID string, n int64, maxInFlight int64) (bool, *QuotaUsage, error) {
+	name := leaseBytesName(uploadID)
+	values := map[string]types.AttributeValue{
+		":n": &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)},
+	}
+	condition := "attribute_exists(#lease_bytes)"
+	if maxInFlight > 0 && n > 0 {
+		condition += " AND (attribute_not_exists(in_flight_bytes) OR in_flight_bytes <= :room)"
+		values[":room"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(maxInFlight-n, 10)}
+	}
+
+	var (
+		grown = true
+		usage *QuotaUsage
+	)
+
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"quota_key": &types.AttributeValueMemberS{Value: owner},
+				},
+				UpdateExpression:                    aws.String("ADD #lease_bytes :n, in_flight_bytes :n"),
+				ConditionExpression:                 aws.String(condition),
+				ExpressionAttributeNames:            map[string]string{"#lease_bytes": name},
+				ExpressionAttributeValues:           values,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			})
+
+			var cfe *types.ConditionalCheckFailedException
+			if cerr.As(err, &cfe) {
+				if _, ok := cfe.Item[name]; !ok {
+					// the session has a size or was closed
+					grown = false
+					return nil
+				}
+				usage = &QuotaUsage{}
+				return unmarshalQuotaUsage(cfe.Item, usage)
+			}
+			return err
+		},
+		retries.IsRetriableDbError,
+	)
+	if err != nil {
+		return false, nil, err
+	}
+	if usage != nil {
+		return false, usage, ErrQuotaInFlightBytes
+	}
+	return grown, nil, nil
+}
+
+func (s *DynamoDbQuotaStore) AddDailyBytes(ctx context.Context, owner string, day time.Time, n int64, limit int64) error {
+	day = day.UTC().Truncate(24 * time.Hour)
+	if limit > 0 && n > limit {
+		return ErrQuotaDailyBytes
+	}
+
+	values := map[string]types.AttributeValue{
+		":n":   &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)},
+		":ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(day.Add(dailyUsageTTL).Unix(), 10)},
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"quota_key": &types.AttributeValueMemberS{Value: owner + "#daily#" + day.Format(time.DateOnly)},
+		},
+		UpdateExpression:          aws.String("ADD daily_bytes :n SET expires_at = :ttl"),
+		ExpressionAttributeValues: values,
+	}
+	if limit > 0 && n > 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(daily_bytes) OR daily_bytes <= :room")
+		values[":room"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(limit-n, 10)}
+	}
+
+	return retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, input)
+
+			var cfe *types.ConditionalCheckFailedException
+			if cerr.As(err, &cfe) {
+				return ErrQuotaDailyBytes
+			}
+			return err
+		},
+		retries.IsRetriableDbError,
+	)
+}
@@ -1,35 +1,108 @@
 package store
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/Yulian302/lfusys-services-commons/health"
 	"github.com/Yulian302/lfusys-services-commons/retries"
+	"github.com/Yulian302/lfusys-services-uploads/compression"
+	"github.com/Yulian302/lfusys-services-uploads/envelope"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
 )
 
+const (
+	chunkHashMetadataKey          = "chunk-hash"
+	chunkHashAlgorithmMetadataKey = "chunk-hash-algorithm"
+	chunkEncodingMetadataKey      = "chunk-encoding"
+	chunkSizeMetadataKey          = "chunk-size"
+	chunkNonceMetadataKey         = "chunk-nonce"
+	chunkSegmentMetadataKey       = "chunk-segment-size"
+
+	// DeleteObjects accepts at most 1000 keys per request
+	deleteBatchSize = 1000
+)
+
+// ChunkInfo describes a stored chunk object. Size and Hash are those of the
+// chunk data, which is stored compressed when Encoding is set and may be
+// sealed with the data key of its session.
+type ChunkInfo struct {
+	Size           int64
+	Encoding       string // gzip or zstd, identity when empty
+	StoredSize     int64  // Length of the object when it is encoded or sealed
+	Hash           string // hex encoded
+	HashAlgorithm  string
+	ChecksumSHA256 string // base64, verified by S3 against the body when set
+	ETag           string
+}
+
+// PresignedRequest is a request a client sends straight to the bucket. Every
+// header in Headers is signed and has to be sent unchanged.
+type PresignedRequest struct {
+	URL       string
+	Method    string
+	Headers   http.Header
+	ExpiresAt time.Time
+}
+
+// ChunkStore keeps chunk objects. Chunks are written and read with the
+// Encryption carried by the context of the call.
 type ChunkStore interface {
-	PutChunk(ctx context.Context, key string, chunkData []byte) error
+	PutChunk(ctx context.Context, key string, body io.Reader, info ChunkInfo) error
+	GetChunk(ctx context.Context, key string) (io.ReadCloser, error)
+	HeadChunk(ctx context.Context, key string) (*ChunkInfo, error)
+	PresignPutChunk(ctx context.Context, key string, info ChunkInfo, expires time.Duration) (*PresignedRequest, error)
+	CopyChunk(ctx context.Context, src string, dst string) error
+	DeleteChunk(ctx context.Context, key string) error
+	DeleteChunks(ctx context.Context, prefix string) (int, error)
 
 	health.ReadinessCheck
 }
 
 type S3ChunkStore struct {
 	client     *s3.Client
+	presign    *s3.PresignClient
 	bucketName string
 }
 
 func NewS3ChunkStore(client *s3.Client, bucketName string) *S3ChunkStore {
 	return &S3ChunkStore{
 		client:     client,
+		presign:    s3.NewPresignClient(client),
 		bucketName: bucketName,
 	}
 }
 
+func UploadPrefix(uploadID string) string {
+	return fmt.Sprintf("uploads/%s/", uploadID)
+}
+
+func ChunkKey(uploadID string, chunkIdx uint32) string {
+	return fmt.Sprintf("%schunk_%d", UploadPrefix(uploadID), chunkIdx)
+}
+
+// StagingKey is where a chunk is written before it is checked and moved to
+// its chunk key, so a rejected body never replaces a chunk already stored.
+// Every call returns a new key, concurrent writes of a chunk do not share it.
+func StagingKey(uploadID string, chunkIdx uint32) string {
+	return fmt.Sprintf("%sstaging/chunk_%d_%s", UploadPrefix(uploadID), chunkIdx, uuid.NewString())
+}
+
+// TailKey is where offset based uploads keep the bytes committed up to offset
+// that do not fill a whole chunk yet.
+func TailKey(uploadID string, offset int64) string {
+	return fmt.Sprintf("%stail_%d", UploadPrefix(uploadID), offset)
+}
+
 func (s *S3ChunkStore) IsReady(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
@@ -52,23 +125,450 @@ func (s *S3ChunkStore) Name() string {
 	return "S3[uploadChunks]"
 }
 
-func (store *S3ChunkStore) PutChunk(ctx context.Context, key string, chunkData []byte) error {
+func (store *S3ChunkStore) PutChunk(ctx context.Context, key string, body io.Reader, info ChunkInfo) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(store.bucketName),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(info.Size),
+		Metadata: map[string]string{
+			chunkHashMetadataKey:          info.Hash,
+			chunkHashAlgorithmMetadataKey: info.HashAlgorithm,
+		},
+	}
+	if info.Encoding != "" && info.Encoding != compression.Identity {
+		// the decoded size is kept for readers that need the chunk layout
+		input.ContentLength = aws.Int64(info.StoredSize)
+		input.ContentEncoding = aws.String(info.Encoding)
+		input.Metadata[chunkEncodingMetadataKey] = info.Encoding
+		input.Metadata[chunkSizeMetadataKey] = strconv.FormatInt(info.Size, 10)
+	}
+
+	encryption := EncryptionFromContext(ctx)
+	if encryption.DataKey != nil {
+		length := aws.ToInt64(input.ContentLength)
+		sealed, nonce, err := sealChunk(encryption.DataKey, key, body, length)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt chunk: %w", err)
+		}
+		body = sealed
+		input.Body = body
+		input.ContentLength = aws.Int64(envelope.SealedSize(length))
+		input.Metadata[chunkNonceMetadataKey] = nonce
+		input.Metadata[chunkSegmentMetadataKey] = strconv.Itoa(envelope.SegmentSize)
+		input.Metadata[chunkSizeMetadataKey] = strconv.FormatInt(info.Size, 10)
+	}
+	encryption.applyPut(input)
+
+	put := func() error {
+		_, err := store.client.PutObject(ctx, input)
+		return err
+	}
+
+	var err error
+	if seeker, ok := body.(io.Seeker); ok {
+		err = retries.Retry(
+			ctx,
+			retries.DefaultAttempts,
+			retries.DefaultBaseDelay,
+			func() error {
+				if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				return put()
+			},
+			retries.IsRetriableS3Error,
+		)
+	} else {
+		// a streamed request body can only be read once, so it cannot be retried
+		err = put()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload chunk: %w", err)
+	}
+	return nil
+}
+
+// GetChunk returns the chunk data, opening chunks sealed with a data key and
+// decoding chunks that are stored compressed.
+func (store *S3ChunkStore) GetChunk(ctx context.Context, key string) (io.ReadCloser, error) {
+	var (
+		body      io.ReadCloser
+		encoding  string
+		nonce     string
+		segmented bool
+	)
+
 	err := retries.Retry(
 		ctx,
 		retries.DefaultAttempts,
 		retries.DefaultBaseDelay,
 		func() error {
-			_, err := store.client.PutObject(ctx, &s3.PutObjectInput{
+			input := &s3.GetObjectInput{
+				Bucket: aws.String(store.bucketName),
+				Key:    aws.String(key),
+			}
+			EncryptionFromContext(ctx).applyGet(input)
+
+			out, err := store.client.GetObject(ctx, input)
+			if err != nil {
+				var nsk *types.NoSuchKey
+				if errors.As(err, &nsk) {
+					return ErrChunkNotFound
+				}
+				return err
+			}
+
+			body = out.Body
+			encoding = out.Metadata[chunkEncodingMetadataKey]
+			nonce = out.Metadata[chunkNonceMetadataKey]
+			segmented, err = sealedInSegments(out.Metadata)
+			if err != nil {
+				out.Body.Close()
+			}
+			return err
+		},
+		retries.IsRetriableS3Error,
+	)
+	if err != nil {
+		if errors.Is(err, ErrChunkNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get chunk: %w", err)
+	}
+
+	if nonce != "" {
+		body, err = openChunk(EncryptionFromContext(ctx).DataKey, key, body, nonce, segmented)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if encoding == "" || encoding == compression.Identity {
+		return body, nil
+	}
+	decoded, err := compression.NewReader(body, encoding, compression.Limits{})
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to decode chunk: %w", err)
+	}
+	return &decodedChunk{ReadCloser: decoded, body: body}, nil
+}
+
+// decodedChunk closes the stored object along with its decoder.
+type decodedChunk struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (d *decodedChunk) Close() error {
+	d.ReadCloser.Close()
+	return d.body.Close()
+}
+
+func (store *S3ChunkStore) HeadChunk(ctx context.Context, key string) (*ChunkInfo, error) {
+	var info ChunkInfo
+
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			input := &s3.HeadObjectInput{
+				Bucket:       aws.String(store.bucketName),
+				Key:          aws.String(key),
+				ChecksumMode: types.ChecksumModeEnabled,
+			}
+			EncryptionFromContext(ctx).applyHead(input)
+
+			out, err := store.client.HeadObject(ctx, input)
+			if err != nil {
+				var nf *types.NotFound
+				if errors.As(err, &nf) {
+					return ErrChunkNotFound
+				}
+				return err
+			}
+
+			info = ChunkInfo{
+				Size:           aws.ToInt64(out.ContentLength),
+				Hash:           out.Metadata[chunkHashMetadataKey],
+				HashAlgorithm:  out.Metadata[chunkHashAlgorithmMetadataKey],
+				ChecksumSHA256: aws.ToString(out.ChecksumSHA256),
+				ETag:           aws.ToString(out.ETag),
+			}
+			if value, ok := out.Metadata[chunkSizeMetadataKey]; ok {
+				size, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid %s metadata: %w", chunkSizeMetadataKey, err)
+				}
+				info.Encoding, info.StoredSize, info.Size = out.Metadata[chunkEncodingMetadataKey], info.Size, size
+			}
+			return nil
+		},
+		retries.IsRetriableS3Error,
+	)
+	if err != nil {
+		if errors.Is(err, ErrChunkNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to head chunk: %w", err)
+	}
+	return &info, nil
+}
+
+// PresignPutChunk signs a PUT of the chunk at key. The length, hash metadata,
+// x-amz-checksum-sha256 and encryption headers are part of the signature, so
+// S3 only accepts a body of info.Size bytes matching info.ChecksumSHA256 that
+// is encrypted like the other chunks of the upload. Chunks of sessions with a
+// data key cannot be presigned, the client would store them unsealed.
+func (store *S3ChunkStore) PresignPutChunk(ctx context.Context, key string, info ChunkInfo, expires time.Duration) (*PresignedRequest, error) {
+	if EncryptionFromContext(ctx).DataKey != nil {
+		return nil, ErrPresignEncrypted
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:         aws.String(store.bucketName),
+		Key:            aws.String(key),
+		ContentLength:  aws.Int64(info.Size),
+		ChecksumSHA256: aws.String(info.ChecksumSHA256),
+		Metadata: map[string]string{
+			chunkHashMetadataKey:          info.Hash,
+			chunkHashAlgorithmMetadataKey: info.HashAlgorithm,
+		},
+	}
+	EncryptionFromContext(ctx).applyPut(input)
+
+	req, err := store.presign.PresignPutObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign chunk upload: %w", err)
+	}
+
+	return &PresignedRequest{
+		URL:       req.URL,
+		Method:    req.Method,
+		Headers:   req.SignedHeader,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// CopyChunk copies the chunk object at src to dst along with its metadata.
+// Chunks sealed with a data key are opened and sealed again for dst, since
+// the key they are sealed under is authenticated along.
+func (store *S3ChunkStore) CopyChunk(ctx context.Context, src string, dst string) error {
+	encryption := EncryptionFromContext(ctx)
+
+	head := &s3.HeadObjectInput{
+		Bucket: aws.String(store.bucketName),
+		Key:    aws.String(src),
+	}
+	encryption.applyHead(head)
+	var out *s3.HeadObjectOutput
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			var err error
+			out, err = store.client.HeadObject(ctx, head)
+			if err != nil {
+				var nf *types.NotFound
+				if errors.As(err, &nf) {
+					return ErrChunkNotFound
+				}
+			}
+			return err
+		},
+		retries.IsRetriableS3Error,
+	)
+	if err != nil {
+		if errors.Is(err, ErrChunkNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to copy chunk: %w", err)
+	}
+
+	if out.Metadata[chunkNonceMetadataKey] != "" {
+		return store.resealChunk(ctx, src, dst, out)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(store.bucketName),
+		Key:               aws.String(dst),
+		CopySource:        aws.String(store.bucketName + "/" + url.PathEscape(src)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+	encryption.applyCopy(input)
+
+	err = retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := store.client.CopyObject(ctx, input)
+			return err
+		},
+		retries.IsRetriableS3Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy chunk: %w", err)
+	}
+	return nil
+}
+
+// resealChunk writes the sealed chunk at src to dst sealed for dst, opening
+// and sealing it again as it streams through. The stored bytes are kept as
+// they are, encoded chunks are not decoded.
+func (store *S3ChunkStore) resealChunk(ctx context.Context, src string, dst string, head *s3.HeadObjectOutput) error {
+	encryption := EncryptionFromContext(ctx)
+
+	segmented, err := sealedInSegments(head.Metadata)
+	if err != nil {
+		return err
+	}
+	length := aws.ToInt64(head.ContentLength)
+	if segmented {
+		length = envelope.OpenedSize(length)
+	} else {
+		length -= envelope.Overhead
+	}
+
+	metadata := make(map[string]string, len(head.Metadata)+1)
+	for k, v := range head.Metadata {
+		metadata[k] = v
+	}
+	metadata[chunkSegmentMetadataKey] = strconv.Itoa(envelope.SegmentSize)
+
+	err = retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			get := &s3.GetObjectInput{
+				Bucket: aws.String(store.bucketName),
+				Key:    aws.String(src),
+			}
+			encryption.applyGet(get)
+			out, err := store.client.GetObject(ctx, get)
+			if err != nil {
+				return err
+			}
+			body, err := openChunk(encryption.DataKey, src, out.Body, head.Metadata[chunkNonceMetadataKey], segmented)
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+
+			sealed, nonce, err := sealChunk(encryption.DataKey, dst, body, length)
+			if err != nil {
+				return err
+			}
+			metadata[chunkNonceMetadataKey] = nonce
+
+			input := &s3.PutObjectInput{
+				Bucket:          aws.String(store.bucketName),
+				Key:             aws.String(dst),
+				Body:            sealed,
+				ContentLength:   aws.Int64(envelope.SealedSize(length)),
+				ContentEncoding: head.ContentEncoding,
+				Metadata:        metadata,
+			}
+			encryption.applyPut(input)
+			_, err = store.client.PutObject(ctx, input)
+			return err
+		},
+		retries.IsRetriableS3Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy chunk: %w", err)
+	}
+	return nil
+}
+
+// sealedInSegments reports whether a sealed chunk was sealed in segments,
+// which have to be of the size this version seals with.
+func sealedInSegments(metadata map[string]string) (bool, error) {
+	value, ok := metadata[chunkSegmentMetadataKey]
+	if !ok {
+		return false, nil
+	}
+	if value != strconv.Itoa(envelope.SegmentSize) {
+		return false, fmt.Errorf("unsupported %s metadata %q", chunkSegmentMetadataKey, value)
+	}
+	return true, nil
+}
+
+func (store *S3ChunkStore) DeleteChunk(ctx context.Context, key string) error {
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := store.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 				Bucket: aws.String(store.bucketName),
 				Key:    aws.String(key),
-				Body:   bytes.NewReader(chunkData),
 			})
 			return err
 		},
 		retries.IsRetriableS3Error,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to upload chunk: %w", err)
+		return fmt.Errorf("failed to delete chunk: %w", err)
 	}
 	return nil
 }
+
+// DeleteChunks removes every object stored under prefix and returns how many
+// objects were deleted.
+func (store *S3ChunkStore) DeleteChunks(ctx context.Context, prefix string) (int, error) {
+	deleted := 0
+
+	paginator := s3.NewListObjectsV2Paginator(store.client, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(store.bucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(deleteBatchSize),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list chunks: %w", err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		objects := make([]types.ObjectIdentifier, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, types.ObjectIdentifier{Key: obj.Key})
+		}
+
+		err = retries.Retry(
+			ctx,
+			retries.DefaultAttempts,
+			retries.DefaultBaseDelay,
+			func() error {
+				out, err := store.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+					Bucket: aws.String(store.bucketName),
+					Delete: &types.Delete{
+						Objects: objects,
+						Quiet:   aws.Bool(true),
+					},
+				})
+				if err != nil {
+					return err
+				}
+				if len(out.Errors) > 0 {
+					return fmt.Errorf("%d objects not deleted, first error: %s", len(out.Errors), aws.ToString(out.Errors[0].Message))
+				}
+				return nil
+			},
+			retries.IsRetriableS3Error,
+		)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete chunks: %w", err)
+		}
+		deleted += len(objects)
+	}
+
+	return deleted, nil
+}
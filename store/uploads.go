@@ -16,9 +16,15 @@ import (
 )
 
 type UploadsStore interface {
+	CreateSession(ctx context.Context, session *UploadSession) error
 	GetSession(ctx context.Context, uploadID string) (*UploadSession, error)
-	PutChunk(ctx context.Context, uploadID string, chunkIdx uint32, totalChunks uint32) error
+	PutChunks(ctx context.Context, uploadID string, chunks []ChunkHash, totalChunks uint32) (*UploadSession, error)
 	TryFinalizeUpload(ctx context.Context, uploadID string, totalChunks uint32) (bool, error)
+	AbortSession(ctx context.Context, uploadID string) error
+	UpdateOffset(ctx context.Context, uploadID string, from int64, to int64) error
+	SetLayout(ctx context.Context, uploadID string, fileSize int64, chunkSize int64, totalChunks uint32, discard []uint32) (*UploadSession, error)
+	FailSession(ctx context.Context, uploadID string, reason string) error
+	RemoveChunkHashes(ctx context.Context, uploadID string, hashes []ChunkHash) error
 
 	health.ReadinessCheck
 }
@@ -58,6 +64,28 @@ func (s *DynamoDbUploadsStore) Name() string {
 	return "UploadsStore[sessions]"
 }
 
+func (s *DynamoDbUploadsStore) CreateSession(ctx context.Context, session *UploadSession) error {
+	item, err := attributevalue.MarshalMap(session)
+	if err != nil {
+		return err
+	}
+
+	return retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName:           aws.String(s.tableName),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(upload_id)"),
+			})
+			return err
+		},
+		retries.IsRetriableDbError,
+	)
+}
+
 func (s *DynamoDbUploadsStore) GetSession(ctx context.Context, uploadID string) (*UploadSession, error) {
 	var session UploadSession
 
@@ -92,45 +120,93 @@ func (s *DynamoDbUploadsStore) GetSession(ctx context.Context, uploadID string)
 	return &session, nil
 }
 
-func (s *DynamoDbUploadsStore) PutChunk(ctx context.Context, uploadID string, chunkIdx uint32, totalChunks uint32) error {
-	return retries.Retry(
+// PutChunks adds the chunks and their hashes to the session and returns the
+// session as updated. Chunks without a hash are recorded without one. Indexes
+// past the last chunk of the session are rejected with ErrChunkOutOfRange and
+// sessions that no longer accept chunks with the error for their status, so a
+// late chunk never moves a completed session back to in progress.
+func (s *DynamoDbUploadsStore) PutChunks(ctx context.Context, uploadID string, chunks []ChunkHash, totalChunks uint32) (*UploadSession, error) {
+	// number sets reject duplicate members
+	seen := make(map[uint32]struct{}, len(chunks))
+	idxs := make([]string, 0, len(chunks))
+	hashes := make([]string, 0, len(chunks))
+	var maxIdx uint32
+	for _, chunk := range chunks {
+		if _, ok := seen[chunk.Index]; ok {
+			continue
+		}
+		seen[chunk.Index] = struct{}{}
+		maxIdx = max(maxIdx, chunk.Index)
+		idxs = append(idxs, strconv.FormatUint(uint64(chunk.Index), 10))
+		if chunk.Hash != "" {
+			hashes = append(hashes, chunk.String())
+		}
+	}
+
+	update := "ADD uploaded_chunks :chunk SET #status = :in_progress"
+	values := map[string]types.AttributeValue{
+		":chunk": &types.AttributeValueMemberNS{
+			Value: idxs,
+		},
+		":in_progress": &types.AttributeValueMemberS{Value: SessionStatusInProgress},
+		":zero":        &types.AttributeValueMemberN{Value: "0"},
+		":max_idx":     &types.AttributeValueMemberN{Value: strconv.FormatUint(uint64(maxIdx), 10)},
+	}
+	now := time.Now()
+	addWritableValues(values, now)
+	if len(hashes) > 0 {
+		update = "ADD uploaded_chunks :chunk, chunk_hashes :hashes SET #status = :in_progress"
+		values[":hashes"] = &types.AttributeValueMemberSS{Value: hashes}
+	}
+
+	var session *UploadSession
+
+	err := retries.Retry(
 		ctx,
 		retries.DefaultAttempts,
 		retries.DefaultBaseDelay,
 		func() error {
-			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 				TableName: aws.String(s.tableName),
 				Key: map[string]types.AttributeValue{
 					"upload_id": &types.AttributeValueMemberS{Value: uploadID},
 				},
-				UpdateExpression: aws.String(`
-            ADD uploaded_chunks :chunk
-            SET #status = :in_progress
-        `),
-				ConditionExpression: aws.String(`
-			attribute_exists(upload_id)
-        `),
-				ExpressionAttributeValues: map[string]types.AttributeValue{
-					":chunk": &types.AttributeValueMemberNS{
-						Value: []string{strconv.FormatUint(uint64(chunkIdx), 10)},
-					},
-					":in_progress": &types.AttributeValueMemberS{Value: "in_progress"},
-				},
+				UpdateExpression: aws.String(update),
+				ConditionExpression: aws.String(writableCondition + `
+			AND (total_chunks = :zero OR total_chunks > :max_idx)
+		`),
+				ExpressionAttributeValues: values,
 				ExpressionAttributeNames: map[string]string{
 					"#status": "status",
 				},
-				ReturnValues: types.ReturnValueAllNew,
+				ReturnValues:                        types.ReturnValueAllNew,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 			})
 
 			var cfe *types.ConditionalCheckFailedException
 			if err != nil && !cerr.As(err, &cfe) {
 				return err
 			}
+			if cfe != nil {
+				if cfe.Item == nil {
+					return apperror.ErrSessionNotFound
+				}
+				if err := closedSessionError(cfe, now); err != nil {
+					return err
+				}
+				return ErrChunkOutOfRange
+			}
 
-			return nil
+			session = &UploadSession{}
+			return attributevalue.UnmarshalMap(out.Attributes, session)
 		},
 		retries.IsRetriableDbError,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
 }
 
 func (s *DynamoDbUploadsStore) TryFinalizeUpload(
@@ -155,11 +231,13 @@ func (s *DynamoDbUploadsStore) TryFinalizeUpload(
 		`),
 				ConditionExpression: aws.String(`
 			size(uploaded_chunks) = :total
-			AND #status <> :completed
+			AND NOT (#status IN (:completed, :aborted, :failed))
 		`),
 				ExpressionAttributeValues: map[string]types.AttributeValue{
 					":total":     &types.AttributeValueMemberN{Value: strconv.FormatUint(uint64(totalChunks), 10)},
-					":completed": &types.AttributeValueMemberS{Value: "completed"},
+					":completed": &types.AttributeValueMemberS{Value: SessionStatusCompleted},
+					":aborted":   &types.AttributeValueMemberS{Value: SessionStatusAborted},
+					":failed":    &types.AttributeValueMemberS{Value: SessionStatusFailed},
 				},
 				ExpressionAttributeNames: map[string]string{
 					"#status": "status",
@@ -183,3 +261,299 @@ func (s *DynamoDbUploadsStore) TryFinalizeUpload(
 
 	return finalized, err
 }
+
+// AbortSession marks a pending or in progress session aborted so no further
+// chunks are accepted. Sessions created before statuses were recorded count
+// as in progress. Sessions in any other status are left untouched and
+// reported with the error for their status, ErrSessionAborted when they were
+// aborted already.
+func (s *DynamoDbUploadsStore) AbortSession(ctx context.Context, uploadID string) error {
+	now := time.Now()
+
+	return retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"upload_id": &types.AttributeValueMemberS{Value: uploadID},
+				},
+				UpdateExpression: aws.String(`
+			SET #status = :aborted, aborted_at = :now
+		`),
+				ConditionExpression: aws.String(`
+			attribute_exists(upload_id)
+			AND (attribute_not_exists(#status) OR #status IN (:pending, :in_progress))
+		`),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":aborted":     &types.AttributeValueMemberS{Value: SessionStatusAborted},
+					":pending":     &types.AttributeValueMemberS{Value: SessionStatusPending},
+					":in_progress": &types.AttributeValueMemberS{Value: SessionStatusInProgress},
+					":now":         &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+				},
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			})
+
+			if err != nil {
+				var cfe *types.ConditionalCheckFailedException
+				if cerr.As(err, &cfe) {
+					if closed := closedSessionError(cfe, now); closed != nil {
+						return closed
+					}
+				}
+				return err
+			}
+
+			return nil
+		},
+		retries.IsRetriableDbError,
+	)
+}
+
+// UpdateOffset moves the committed byte offset of the session from one value
+// to another, failing with ErrOffsetConflict if another writer moved it first.
+// Completed sessions still accept the move, since the chunk that completes a
+// session is committed before the offset that covers it.
+func (s *DynamoDbUploadsStore) UpdateOffset(ctx context.Context, uploadID string, from int64, to int64) error {
+	return retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"upload_id": &types.AttributeValueMemberS{Value: uploadID},
+				},
+				UpdateExpression: aws.String(`
+			SET upload_offset = :to
+		`),
+				ConditionExpression: aws.String(`
+			attribute_exists(upload_id)
+			AND NOT (#status IN (:aborted, :failed))
+			AND (upload_offset = :from OR (attribute_not_exists(upload_offset) AND :from = :zero))
+		`),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":from":    &types.AttributeValueMemberN{Value: strconv.FormatInt(from, 10)},
+					":to":      &types.AttributeValueMemberN{Value: strconv.FormatInt(to, 10)},
+					":zero":    &types.AttributeValueMemberN{Value: "0"},
+					":aborted": &types.AttributeValueMemberS{Value: SessionStatusAborted},
+					":failed":  &types.AttributeValueMemberS{Value: SessionStatusFailed},
+				},
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			})
+
+			if err != nil {
+				var cfe *types.ConditionalCheckFailedException
+				if cerr.As(err, &cfe) {
+					if cfe.Item == nil {
+						return apperror.ErrSessionNotFound
+					}
+					status, _ := cfe.Item["status"].(*types.AttributeValueMemberS)
+					switch {
+					case status != nil && status.Value == SessionStatusAborted:
+						return ErrSessionAborted
+					case status != nil && status.Value == SessionStatusFailed:
+						return ErrSessionFailed
+					}
+					return ErrOffsetConflict
+				}
+				return err
+			}
+
+			return nil
+		},
+		retries.IsRetriableDbError,
+	)
+}
+
+// SetLayout fixes the size and chunk size of a session created without a
+// length and drops the discarded chunk indexes from its uploaded set. It
+// returns the session as updated.
+func (s *DynamoDbUploadsStore) SetLayout(ctx context.Context, uploadID string, fileSize int64, chunkSize int64, totalChunks uint32, discard []uint32) (*UploadSession, error) {
+	update := "SET file_size = :size, chunk_size = :chunk, total_chunks = :total"
+	values := map[string]types.AttributeValue{
+		":size":  &types.AttributeValueMemberN{Value: strconv.FormatInt(fileSize, 10)},
+		":chunk": &types.AttributeValueMemberN{Value: strconv.FormatInt(chunkSize, 10)},
+		":total": &types.AttributeValueMemberN{Value: strconv.FormatUint(uint64(totalChunks), 10)},
+	}
+	now := time.Now()
+	addWritableValues(values, now)
+	if len(discard) > 0 {
+		chunks := make([]string, 0, len(discard))
+		for _, idx := range discard {
+			chunks = append(chunks, strconv.FormatUint(uint64(idx), 10))
+		}
+		update += " DELETE uploaded_chunks :discard"
+		values[":discard"] = &types.AttributeValueMemberNS{Value: chunks}
+	}
+
+	var session *UploadSession
+
+	err := retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"upload_id": &types.AttributeValueMemberS{Value: uploadID},
+				},
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(writableCondition),
+				ExpressionAttributeValues: values,
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ReturnValues:                        types.ReturnValueAllNew,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			})
+
+			if err != nil {
+				var cfe *types.ConditionalCheckFailedException
+				if cerr.As(err, &cfe) {
+					if closed := closedSessionError(cfe, now); closed != nil {
+						return closed
+					}
+				}
+				return err
+			}
+
+			session = &UploadSession{}
+			return attributevalue.UnmarshalMap(out.Attributes, session)
+		},
+		retries.IsRetriableDbError,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// FailSession marks the session failed with the reason it was rejected, so
+// no further chunks are accepted and it never completes.
+func (s *DynamoDbUploadsStore) FailSession(ctx context.Context, uploadID string, reason string) error {
+	return retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"upload_id": &types.AttributeValueMemberS{Value: uploadID},
+				},
+				UpdateExpression: aws.String(`
+			SET #status = :failed, failure_reason = :reason, failed_at = :now
+		`),
+				ConditionExpression: aws.String(`
+			attribute_exists(upload_id)
+			AND NOT (#status IN (:completed, :aborted))
+		`),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":failed":    &types.AttributeValueMemberS{Value: SessionStatusFailed},
+					":completed": &types.AttributeValueMemberS{Value: SessionStatusCompleted},
+					":aborted":   &types.AttributeValueMemberS{Value: SessionStatusAborted},
+					":reason":    &types.AttributeValueMemberS{Value: reason},
+					":now":       &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+				},
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			})
+
+			if err != nil {
+				var cfe *types.ConditionalCheckFailedException
+				if cerr.As(err, &cfe) {
+					if closed := closedSessionError(cfe, time.Now()); closed != nil {
+						return closed
+					}
+				}
+				return err
+			}
+
+			return nil
+		},
+		retries.IsRetriableDbError,
+	)
+}
+
+// RemoveChunkHashes drops hashes recorded for chunks that have since been
+// overwritten.
+func (s *DynamoDbUploadsStore) RemoveChunkHashes(ctx context.Context, uploadID string, hashes []ChunkHash) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	stale := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		stale = append(stale, h.String())
+	}
+
+	return retries.Retry(
+		ctx,
+		retries.DefaultAttempts,
+		retries.DefaultBaseDelay,
+		func() error {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"upload_id": &types.AttributeValueMemberS{Value: uploadID},
+				},
+				UpdateExpression:    aws.String("DELETE chunk_hashes :stale"),
+				ConditionExpression: aws.String("attribute_exists(upload_id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":stale": &types.AttributeValueMemberSS{Value: stale},
+				},
+			})
+
+			var cfe *types.ConditionalCheckFailedException
+			if cerr.As(err, &cfe) {
+				return apperror.ErrSessionNotFound
+			}
+			return err
+		},
+		retries.IsRetriableDbError,
+	)
+}
+
+// writableCondition holds for sessions that still accept chunks: pending or
+// in progress and not past their expiry. addWritableValues sets its values.
+const writableCondition = `
+			attribute_exists(upload_id)
+			AND NOT (#status IN (:completed, :aborted, :failed))
+			AND (attribute_not_exists(expires_at) OR expires_at > :now)
+		`
+
+func addWritableValues(values map[string]types.AttributeValue, now time.Time) {
+	values[":completed"] = &types.AttributeValueMemberS{Value: SessionStatusCompleted}
+	values[":aborted"] = &types.AttributeValueMemberS{Value: SessionStatusAborted}
+	values[":failed"] = &types.AttributeValueMemberS{Value: SessionStatusFailed}
+	values[":now"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)}
+}
+
+// closedSessionError maps a failed status condition to the error for the
+// state the session was found in at now. It returns nil for sessions that
+// still accept chunks, whose condition failed for another reason.
+func closedSessionError(cfe *types.ConditionalCheckFailedException, now time.Time) error {
+	if cfe.Item == nil {
+		return apperror.ErrSessionNotFound
+	}
+
+	var session UploadSession
+	if err := attributevalue.UnmarshalMap(cfe.Item, &session); err != nil {
+		return err
+	}
+	return session.CheckWritable(now)
+}
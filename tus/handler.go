@@ -0,0 +1,360 @@
+package tus
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apperror "github.com/Yulian302/lfusys-services-commons/errors"
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+)
+
+type TusHandler struct {
+	uploadService  services.UploadService
+	sessionService services.SessionService
+	streamService  services.StreamService
+
+	logger logger.Logger
+}
+
+func NewTusHandler(uploadService services.UploadService, sessionService services.SessionService, streamService services.StreamService, l logger.Logger) *TusHandler {
+	return &TusHandler{
+		uploadService:  uploadService,
+		sessionService: sessionService,
+		streamService:  streamService,
+		logger:         l,
+	}
+}
+
+// Resumable stamps every response with the protocol version and rejects
+// requests for versions other than the one supported.
+func (h *TusHandler) Resumable(c *gin.Context) {
+	c.Header("Tus-Resumable", Version)
+
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != Version {
+		c.Header("Tus-Version", Version)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+	c.Next()
+}
+
+// Options godoc
+//
+//	@Summary		tus capabilities
+//	@Description	Report the supported tus version, extensions and checksum algorithms
+//	@Tags			tus
+//	@Success		204
+//	@Header			204	{string}	Tus-Version				"Supported protocol versions"
+//	@Header			204	{string}	Tus-Extension			"Supported extensions"
+//	@Header			204	{string}	Tus-Checksum-Algorithm	"Supported checksum algorithms"
+//	@Router			/files [options]
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Version", Version)
+	c.Header("Tus-Extension", Extensions)
+	c.Header("Tus-Checksum-Algorithm", supportedChecksumAlgorithms())
+	c.Status(http.StatusNoContent)
+}
+
+// Create godoc
+//
+//	@Summary		tus creation
+//	@Description	Create an upload session for a file of Upload-Length bytes
+//	@Tags			tus
+//	@Param			Tus-Resumable			header	string	true	"Protocol version"
+//	@Param			Upload-Length			header	int		true	"File size in bytes"
+//	@Param			Upload-Metadata			header	string	false	"Comma separated key and base64 value pairs"
+//	@Param			X-SSE-Customer-Key		header	string	false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header	string	false	"Base64 MD5 of the SSE-C key"
+//	@Success		201
+//	@Header			201	{string}	Location		"Upload URL"
+//	@Failure		400	{object}	problem.Problem	"Invalid request or encryption key"
+//	@Failure		401	{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		412	"Unsupported protocol version"
+//	@Failure		413	{object}	problem.Problem	"Upload-Length larger than the open session byte quota"
+//	@Failure		429	{object}	problem.Problem	"Open session or byte quota exceeded"
+//	@Failure		500	{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/files [post]
+func (h *TusHandler) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		problem.BadRequest(c, "invalid Upload-Length")
+		return
+	}
+
+	meta, ok := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if !ok {
+		problem.BadRequest(c, "invalid Upload-Metadata")
+		return
+	}
+
+	fileName := meta["filename"]
+	if fileName == "" {
+		fileName = meta["name"]
+	}
+
+	key, err := store.DefaultCustomerKeyHeaders.CustomerKey(c.Request.Header)
+	if err != nil {
+		h.respondEncryptionError(c, "", err)
+		return
+	}
+
+	session, err := h.sessionService.CreateSession(c.Request.Context(), services.SessionParams{
+		FileName:    fileName,
+		FileSize:    length,
+		CustomerKey: key,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSession) {
+			problem.BadRequest(c, "invalid Upload-Length")
+			return
+		}
+		if h.respondQuotaExceeded(c, "", err) || h.respondEncryptionError(c, "", err) {
+			return
+		}
+		h.logger.Error("tus create failed",
+			"upload_length", length,
+			"error", err,
+		)
+		problem.Internal(c, "could not create upload session")
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.UploadID)
+	c.Status(http.StatusCreated)
+}
+
+// Head godoc
+//
+//	@Summary		tus offset
+//	@Description	Report how many bytes of the upload are committed
+//	@Tags			tus
+//	@Param			uploadId		path	string	true	"Upload session ID"
+//	@Param			Tus-Resumable	header	string	true	"Protocol version"
+//	@Success		200
+//	@Header			200	{integer}	Upload-Offset	"Committed bytes"
+//	@Header			200	{integer}	Upload-Length	"File size in bytes"
+//	@Failure		401	"Missing or invalid token"
+//	@Failure		403	"Upload belongs to another user"
+//	@Failure		404	"Upload not found"
+//	@Failure		410	"Upload terminated or expired"
+//	@Security		BearerAuth
+//	@Router			/files/{uploadId} [head]
+func (h *TusHandler) Head(c *gin.Context) {
+	session, err := h.sessionService.GetSession(c.Request.Context(), c.Param("uploadId"))
+	if err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			c.Status(http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, apperror.ErrSessionNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	switch session.CurrentStatus(time.Now()) {
+	case store.SessionStatusAborted, store.SessionStatusFailed, store.SessionStatusExpired:
+		c.Status(http.StatusGone)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.FileSize, 10))
+	if session.FileName != "" {
+		c.Header("Upload-Metadata", encodeMetadata(map[string]string{"filename": session.FileName}))
+	}
+	c.Status(http.StatusOK)
+}
+
+// Patch godoc
+//
+//	@Summary		tus append
+//	@Description	Append bytes to the upload at Upload-Offset
+//	@Tags			tus
+//	@Accept			application/offset+octet-stream
+//	@Param			uploadId				path	string	true	"Upload session ID"
+//	@Param			Tus-Resumable			header	string	true	"Protocol version"
+//	@Param			Upload-Offset			header	int		true	"Offset the body starts at"
+//	@Param			Upload-Checksum			header	string	false	"Checksum algorithm and base64 digest of the body"
+//	@Param			X-SSE-Customer-Key		header	string	false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header	string	false	"Base64 MD5 of the SSE-C key"
+//	@Success		204
+//	@Header			204	{integer}	Upload-Offset	"Committed bytes"
+//	@Failure		400	{object}	problem.Problem	"Invalid request or missing encryption key"
+//	@Failure		401	{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		403	{object}	problem.Problem	"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		404	{object}	problem.Problem	"Upload not found"
+//	@Failure		409	{object}	problem.Problem	"Offset mismatch, upload already completed or failed verification"
+//	@Failure		410	{object}	problem.Problem	"Upload terminated or expired"
+//	@Failure		413	{object}	problem.Problem	"Body exceeds Upload-Length or daily byte quota"
+//	@Failure		415	{object}	problem.Problem	"Unsupported content type"
+//	@Failure		422	{object}	problem.Problem	"Assembled file failed verification"
+//	@Failure		429	{object}	problem.Problem	"Daily byte quota exceeded"
+//	@Failure		460	{object}	problem.Problem	"Checksum mismatch"
+//	@Failure		500	{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/files/{uploadId} [patch]
+func (h *TusHandler) Patch(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+
+	if c.ContentType() != OffsetContentType {
+		problem.Write(c, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "content type must be "+OffsetContentType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		problem.BadRequest(c, "invalid Upload-Offset")
+		return
+	}
+
+	var checksum *services.Checksum
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		checksum, err = parseChecksum(header)
+		if err != nil {
+			problem.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	key, err := store.DefaultCustomerKeyHeaders.CustomerKey(c.Request.Header)
+	if err != nil {
+		h.respondEncryptionError(c, uploadId, err)
+		return
+	}
+	// the stream service checks the key against the session
+	ctx := store.WithEncryption(c.Request.Context(), store.Encryption{CustomerKey: key})
+
+	newOffset, err := h.streamService.Write(ctx, uploadId, offset, c.Request.Body, checksum)
+	if err != nil {
+		if h.respondEncryptionError(c, uploadId, err) {
+			return
+		}
+		var quotaErr *services.QuotaError
+		if errors.As(err, &quotaErr) {
+			// chunks stored before the limit was hit stay committed
+			c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+			h.respondQuotaExceeded(c, uploadId, err)
+			return
+		}
+		if status, message, _, ok := services.ClosedSessionProblem(err); ok {
+			if errors.Is(err, store.ErrSessionCompleted) {
+				c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+			}
+			problem.Write(c, status, problem.CodeSessionClosed, message)
+			return
+		}
+		switch {
+		case errors.Is(err, auth.ErrForbidden):
+			problem.Write(c, http.StatusForbidden, problem.CodeForbidden, "upload belongs to another user")
+		case errors.Is(err, apperror.ErrSessionNotFound):
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "upload not found")
+		case errors.Is(err, services.ErrFileIntegrity):
+			problem.Write(c, http.StatusUnprocessableEntity, problem.CodeFileIntegrityMismatch, "file integrity check failed")
+		case errors.Is(err, services.ErrOffsetMismatch), errors.Is(err, store.ErrOffsetConflict):
+			c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+			problem.Write(c, http.StatusConflict, problem.CodeOffsetMismatch, "offset mismatch")
+		case errors.Is(err, services.ErrIntegrity):
+			problem.Write(c, StatusChecksumMismatch, problem.CodeIntegrityMismatch, "checksum mismatch")
+		case errors.Is(err, services.ErrUploadTooLarge):
+			problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeRangeExceedsFileSize, "body exceeds Upload-Length")
+		default:
+			h.logger.Error("tus patch failed",
+				"upload_id", uploadId,
+				"offset", offset,
+				"error", err,
+			)
+			problem.Internal(c, "internal server error")
+		}
+		return
+	}
+
+	h.logger.Debug("tus patch accepted",
+		"upload_id", uploadId,
+		"offset", newOffset,
+	)
+
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Terminate godoc
+//
+//	@Summary		tus termination
+//	@Description	Abort the upload and delete its stored data
+//	@Tags			tus
+//	@Param			uploadId		path	string	true	"Upload session ID"
+//	@Param			Tus-Resumable	header	string	true	"Protocol version"
+//	@Success		204
+//	@Failure		401	{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		403	{object}	problem.Problem	"Upload belongs to another user"
+//	@Failure		404	{object}	problem.Problem	"Upload not found"
+//	@Failure		409	{object}	problem.Problem	"Upload already completed or failed verification"
+//	@Failure		500	{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/files/{uploadId} [delete]
+func (h *TusHandler) Terminate(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+
+	if err := h.sessionService.AbortUpload(c.Request.Context(), uploadId); err != nil {
+		if status, message, _, ok := services.ClosedSessionProblem(err); ok {
+			problem.Write(c, status, problem.CodeSessionClosed, message)
+			return
+		}
+		switch {
+		case errors.Is(err, auth.ErrForbidden):
+			problem.Write(c, http.StatusForbidden, problem.CodeForbidden, "upload belongs to another user")
+		case errors.Is(err, apperror.ErrSessionNotFound):
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "upload not found")
+		default:
+			h.logger.Error("tus terminate failed",
+				"upload_id", uploadId,
+				"error", err,
+			)
+			problem.Internal(c, "internal server error")
+		}
+		return
+	}
+
+	if _, err := h.uploadService.DeleteUpload(c.Request.Context(), uploadId); err != nil {
+		problem.Internal(c, "could not delete upload data")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func parseChecksum(header string) (*services.Checksum, error) {
+	algorithm, digest, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, errors.New("invalid Upload-Checksum")
+	}
+
+	alg, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, errors.New("unsupported checksum algorithm")
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(digest)
+	if err != nil {
+		return nil, errors.New("invalid Upload-Checksum")
+	}
+
+	return &services.Checksum{
+		Hash:     alg.New(),
+		Expected: expected,
+	}, nil
+}
@@ -0,0 +1,24 @@
+package tus
+
+import (
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/gin-gonic/gin"
+)
+
+// respondEncryptionError answers a request with a missing, invalid or wrong
+// customer key. It reports false when err is not about the key.
+func (h *TusHandler) respondEncryptionError(c *gin.Context, uploadId string, err error) bool {
+	status, code, ok := services.CustomerKeyProblem(err)
+	if !ok {
+		return false
+	}
+
+	h.logger.Warn("tus encryption key rejected",
+		"upload_id", uploadId,
+		"method", c.Request.Method,
+		"error", err,
+	)
+	problem.Write(c, status, code, err.Error())
+	return true
+}
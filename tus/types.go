@@ -0,0 +1,78 @@
+package tus
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+)
+
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,termination,checksum"
+
+	OffsetContentType = "application/offset+octet-stream"
+
+	// StatusChecksumMismatch is the tus checksum extension status for a body
+	// that does not match its Upload-Checksum header.
+	StatusChecksumMismatch = 460
+)
+
+// checksumAlgorithms maps tus algorithm names onto the digest registry.
+var checksumAlgorithms = map[string]*digest.Algorithm{
+	"md5":    digest.MD5,
+	"sha1":   digest.SHA1,
+	"sha256": digest.SHA256,
+	"crc32c": digest.CRC32C,
+	"blake3": digest.BLAKE3,
+}
+
+func supportedChecksumAlgorithms() string {
+	names := make([]string, 0, len(checksumAlgorithms))
+	for name := range checksumAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// parseMetadata decodes an Upload-Metadata header of comma separated
+// "key base64(value)" pairs. Keys without a value map to an empty string.
+func parseMetadata(header string) (map[string]string, bool) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, true
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			meta[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, false
+			}
+			meta[parts[0]] = string(value)
+		default:
+			return nil, false
+		}
+	}
+	return meta, true
+}
+
+func encodeMetadata(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(meta[key])))
+	}
+	return strings.Join(pairs, ",")
+}
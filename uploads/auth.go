@@ -0,0 +1,26 @@
+package uploads
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/auth"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// respondForbidden answers a request for a session owned by someone else. It
+// reports false when err is not an ownership error.
+func (h *UploadsHandler) respondForbidden(c *gin.Context, uploadId string, err error) bool {
+	if !errors.Is(err, auth.ErrForbidden) {
+		return false
+	}
+
+	h.logger.Warn("upload session access denied",
+		"upload_id", uploadId,
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+	)
+	problem.Write(c, http.StatusForbidden, problem.CodeForbidden, "upload belongs to another user")
+	return true
+}
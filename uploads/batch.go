@@ -0,0 +1,428 @@
+package uploads
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperror "github.com/Yulian302/lfusys-services-commons/errors"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// BatchContentType is the framed binary batch format. Every frame is a
+	// big endian uint32 chunk index, the raw 32 byte SHA256 of the chunk, a
+	// big endian uint32 length and the chunk bytes.
+	BatchContentType = "application/x-lfusys-chunks"
+
+	maxBatchChunks = 256
+	// batchConcurrency bounds the chunks of a batch stored at once. With the
+	// chunk read next, a batch holds at most batchConcurrency+1 chunks of up
+	// to the session chunk limit in memory.
+	batchConcurrency = 4
+
+	batchStatusStored    = "stored"
+	batchStatusUnchanged = "unchanged"
+	batchStatusFailed    = "failed"
+)
+
+var errMalformedBatch = errors.New("malformed batch body")
+
+type batchChunk struct {
+	index  uint32
+	digest *digest.Digest
+	data   []byte
+	code   string
+	err    string
+}
+
+// batchReader yields the chunks of a batch body one at a time. The next
+// chunk is read while earlier ones are being stored and waits for one of
+// them to finish, so the rest of the body is not buffered.
+type batchReader interface {
+	next() (*batchChunk, error)
+}
+
+type framedBatchReader struct {
+	r       *bufio.Reader
+	maxSize func(idx uint32) int64
+}
+
+func (f *framedBatchReader) next() (*batchChunk, error) {
+	var header [4 + sha256.Size + 4]byte
+	if _, err := io.ReadFull(f.r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, errMalformedBatch
+	}
+
+	chunk := &batchChunk{
+		index: binary.BigEndian.Uint32(header[:4]),
+		digest: &digest.Digest{
+			Algorithm: digest.SHA256,
+			Sum:       bytes.Clone(header[4 : 4+sha256.Size]),
+		},
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[4+sha256.Size:]))
+	if limit := f.maxSize(chunk.index); length > limit {
+		if _, err := io.CopyN(io.Discard, f.r, length); err != nil {
+			return nil, errMalformedBatch
+		}
+		chunk.code, chunk.err = problem.CodeChunkTooLarge, chunkTooLargeMessage(limit)
+		return chunk, nil
+	}
+
+	chunk.data = make([]byte, length)
+	if _, err := io.ReadFull(f.r, chunk.data); err != nil {
+		return nil, errMalformedBatch
+	}
+	return chunk, nil
+}
+
+// multipartBatchReader reads form parts named chunk_<index>. The digest comes
+// from the part's digest headers, as for single chunk uploads, or from a
+// hash_<index> field in the session algorithm sent before the chunk.
+type multipartBatchReader struct {
+	mr      *multipart.Reader
+	session *store.UploadSession
+	hashes  map[uint32]string
+	maxSize func(idx uint32) int64
+}
+
+func (m *multipartBatchReader) next() (*batchChunk, error) {
+	for {
+		part, err := m.mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, errMalformedBatch
+		}
+
+		name := part.FormName()
+		if idxStr, ok := strings.CutPrefix(name, "hash_"); ok {
+			idx, err := strconv.ParseUint(idxStr, 10, 32)
+			if err != nil {
+				return nil, errMalformedBatch
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 256))
+			if err != nil {
+				return nil, errMalformedBatch
+			}
+			m.hashes[uint32(idx)] = strings.TrimSpace(string(value))
+			continue
+		}
+
+		idxStr, ok := strings.CutPrefix(name, "chunk_")
+		if !ok {
+			continue
+		}
+		idx, err := strconv.ParseUint(idxStr, 10, 32)
+		if err != nil {
+			return nil, errMalformedBatch
+		}
+
+		chunk := &batchChunk{index: uint32(idx)}
+
+		header := http.Header(part.Header)
+		if hash, ok := m.hashes[chunk.index]; ok && header.Get("X-Chunk-Hash") == "" {
+			header.Set("X-Chunk-Hash", hash)
+		}
+		chunk.digest, err = chunkDigest(header, m.session)
+		if err != nil {
+			chunk.code, chunk.err = digestProblem(err)
+			return chunk, nil
+		}
+
+		limit := m.maxSize(chunk.index)
+		data, err := io.ReadAll(io.LimitReader(part, limit+1))
+		if err != nil {
+			return nil, errMalformedBatch
+		}
+		if int64(len(data)) > limit {
+			chunk.code, chunk.err = problem.CodeChunkTooLarge, chunkTooLargeMessage(limit)
+			return chunk, nil
+		}
+		chunk.data = data
+		return chunk, nil
+	}
+}
+
+// UploadBatch godoc
+//
+//	@Summary		Upload several chunks
+//	@Description	Upload many chunks in one request, either as multipart/form-data parts named chunk_<index> with Content-Digest, Repr-Digest, Content-MD5 or X-Chunk-Hash part headers or a preceding hash_<index> field, or as application/x-lfusys-chunks frames of uint32 index, 32 byte SHA256, uint32 length and data. Chunks are verified and stored independently. Chunks already uploaded with the same content are reported unchanged, ones with different content fail unless X-Chunk-Overwrite is set.
+//	@Tags			uploads
+//	@Accept			mpfd
+//	@Accept			application/x-lfusys-chunks
+//	@Produce		json
+//	@Param			uploadId				path		string				true	"Upload session ID"
+//	@Param			X-Chunk-Overwrite		header		bool				false	"Replace chunks already uploaded with different content"
+//	@Param			X-SSE-Customer-Key		header		string				false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header		string				false	"Base64 MD5 of the SSE-C key"
+//	@Success		200						{object}	BatchUploadResponse	"Per chunk results"
+//	@Failure		400						{object}	problem.Problem		"Malformed batch body"
+//	@Failure		401						{object}	problem.Problem		"Missing or invalid token"
+//	@Failure		403						{object}	problem.Problem		"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		404						{object}	problem.Problem		"Session not found"
+//	@Failure		409						{object}	problem.Problem		"Upload completed or failed verification"
+//	@Failure		410						{object}	problem.Problem		"Upload aborted or session expired"
+//	@Failure		413						{object}	problem.Problem		"Too many chunks"
+//	@Failure		415						{object}	problem.Problem		"Unsupported content type"
+//	@Failure		422						{object}	problem.Problem		"Assembled file failed verification"
+//	@Failure		500						{object}	problem.Problem		"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId}/chunks [post]
+func (h *UploadsHandler) UploadBatch(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if errors.Is(err, apperror.ErrSessionNotFound) {
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+			return
+		}
+		h.logger.Error("batch upload failed",
+			"upload_id", uploadId,
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+		return
+	}
+
+	// completed sessions still answer identical chunks as unchanged
+	if err := session.CheckWritable(time.Now()); err != nil && !errors.Is(err, store.ErrSessionCompleted) {
+		h.respondClosedSession(c, uploadId, err)
+		return
+	}
+	if !h.applyEncryption(c, session) {
+		return
+	}
+
+	reader, ok := newBatchReader(c, session, h.maxChunkSize)
+	if !ok {
+		problem.Write(c, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "content type must be multipart/form-data or "+BatchContentType)
+		return
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		results   []BatchChunkResult
+		stored    []store.ChunkHash
+		unchanged []store.ChunkHash
+	)
+	sem := make(chan struct{}, batchConcurrency)
+	seen := make(map[uint32]struct{})
+
+	fail := func(chunkId uint32, code string, reason string) {
+		mu.Lock()
+		results = append(results, BatchChunkResult{ChunkId: chunkId, Status: batchStatusFailed, Code: code, Error: reason})
+		mu.Unlock()
+	}
+
+	overwrite := overwriteRequested(c.Request.Header)
+
+	var readErr error
+	for count := 0; ; count++ {
+		chunk, err := reader.next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = err
+			}
+			break
+		}
+		if count == maxBatchChunks {
+			readErr = fmt.Errorf("batch exceeds %d chunks", maxBatchChunks)
+			break
+		}
+
+		if code, reason := validateBatchChunk(session, chunk, seen); code != "" {
+			fail(chunk.index, code, reason)
+			continue
+		}
+		seen[chunk.index] = struct{}{}
+
+		match, err := h.matchChunk(c.Request.Context(), session, chunk.index, chunk.digest)
+		if err != nil {
+			fail(chunk.index, problem.CodeInternal, "failed to compare with stored chunk")
+			continue
+		}
+		if match == chunkSame {
+			mu.Lock()
+			results = append(results, BatchChunkResult{ChunkId: chunk.index, Status: batchStatusUnchanged})
+			unchanged = append(unchanged, store.NewChunkHash(chunk.index, chunk.digest))
+			mu.Unlock()
+			continue
+		}
+		if match == chunkDifferent && !overwrite {
+			fail(chunk.index, problem.CodeChunkConflict, "chunk already uploaded with different content")
+			continue
+		}
+		if session.Status == store.SessionStatusCompleted {
+			fail(chunk.index, problem.CodeSessionClosed, "upload already completed")
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(chunk *batchChunk) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			computed, err := h.uploadService.UploadData(c.Request.Context(), uploadId, chunk.index, chunk.data, session.StorageEncoding, chunk.digest)
+			if err != nil {
+				var quotaErr *services.QuotaError
+				if errors.As(err, &quotaErr) {
+					fail(chunk.index, problem.CodeQuotaExceeded, quotaErr.Error())
+					return
+				}
+				fail(chunk.index, problem.CodeInternal, "failed to store chunk")
+				return
+			}
+
+			mu.Lock()
+			results = append(results, BatchChunkResult{ChunkId: chunk.index, Status: batchStatusStored})
+			stored = append(stored, store.NewChunkHash(chunk.index, computed))
+			mu.Unlock()
+		}(chunk)
+	}
+	wg.Wait()
+
+	// chunks stored before a read error are still recorded so the client
+	// only has to resend what is missing, and a retry after a lost
+	// finalization completes the upload again
+	record := stored
+	if len(record) == 0 && len(unchanged) > 0 &&
+		session.Status != store.SessionStatusCompleted && uint32(len(session.ReceivedChunks())) == session.TotalChunks {
+		record = unchanged
+	}
+	if len(record) > 0 {
+		if err := h.sessionService.MarkChunksComplete(c.Request.Context(), uploadId, record); err != nil {
+			if h.respondClosedSession(c, uploadId, err) {
+				return
+			}
+			switch {
+			case errors.Is(err, services.ErrFileIntegrity):
+				problem.Write(c, http.StatusUnprocessableEntity, problem.CodeFileIntegrityMismatch, err.Error())
+				return
+			}
+			h.logger.Error("batch upload failed",
+				"upload_id", uploadId,
+				"stored", len(stored),
+				"error", err,
+			)
+			problem.Internal(c, "could not update session details")
+			return
+		}
+	}
+
+	if readErr != nil {
+		h.logger.Warn("batch upload failed",
+			"upload_id", uploadId,
+			"stored", len(stored),
+			"error", readErr,
+		)
+		if errors.Is(readErr, errMalformedBatch) {
+			problem.Write(c, http.StatusBadRequest, problem.CodeMalformedBatch, readErr.Error())
+		} else {
+			problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeTooManyChunks, readErr.Error())
+		}
+		return
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ChunkId < results[j].ChunkId })
+
+	failed := len(results) - len(stored) - len(unchanged)
+
+	h.logger.Info("chunk batch uploaded",
+		"upload_id", uploadId,
+		"stored", len(stored),
+		"unchanged", len(unchanged),
+		"failed", failed,
+	)
+
+	c.JSON(http.StatusOK, BatchUploadResponse{
+		UploadId:  uploadId,
+		Stored:    len(stored),
+		Unchanged: len(unchanged),
+		Failed:    failed,
+		Results:   results,
+	})
+}
+
+func newBatchReader(c *gin.Context, session *store.UploadSession, maxChunkSize int64) (batchReader, bool) {
+	maxSize := func(idx uint32) int64 {
+		return min(session.EffectiveChunkSize(), session.ChunkLimit(idx, maxChunkSize))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil {
+		return nil, false
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		if params["boundary"] == "" {
+			return nil, false
+		}
+		return &multipartBatchReader{
+			mr:      multipart.NewReader(c.Request.Body, params["boundary"]),
+			session: session,
+			hashes:  map[uint32]string{},
+			maxSize: maxSize,
+		}, true
+	case BatchContentType:
+		return &framedBatchReader{
+			r:       bufio.NewReader(c.Request.Body),
+			maxSize: maxSize,
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// validateBatchChunk returns the problem code and reason a chunk fails with,
+// empty ones for a valid chunk.
+func validateBatchChunk(session *store.UploadSession, chunk *batchChunk, seen map[uint32]struct{}) (string, string) {
+	if chunk.err != "" {
+		return chunk.code, chunk.err
+	}
+	if _, ok := seen[chunk.index]; ok {
+		return problem.CodeDuplicateChunk, "duplicate chunk"
+	}
+	if len(chunk.data) == 0 {
+		return problem.CodeEmptyChunk, "no chunk binary data"
+	}
+	if err := session.ValidateChunk(chunk.index, int64(len(chunk.data))); err != nil {
+		return chunkLayoutProblem(err), err.Error()
+	}
+
+	hash := chunk.digest.Algorithm.New()
+	hash.Write(chunk.data)
+	if !chunk.digest.Matches(hash.Sum(nil)) {
+		return problem.CodeIntegrityMismatch, "chunk does not match its digest"
+	}
+	return "", ""
+}
@@ -0,0 +1,25 @@
+package uploads
+
+import (
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/gin-gonic/gin"
+)
+
+// respondClosedSession answers a write to a session that no longer accepts
+// chunks. It reports false when err is not about the session status.
+func (h *UploadsHandler) respondClosedSession(c *gin.Context, uploadId string, err error) bool {
+	status, message, reason, ok := services.ClosedSessionProblem(err)
+	if !ok {
+		return false
+	}
+
+	h.logger.Warn("upload session closed",
+		"upload_id", uploadId,
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"reason", reason,
+	)
+	problem.Write(c, status, problem.CodeSessionClosed, message)
+	return true
+}
@@ -0,0 +1,64 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+// OverwriteHeader asks to replace a chunk that was already accepted with
+// different content. Completed uploads are never overwritten.
+const OverwriteHeader = "X-Chunk-Overwrite"
+
+type chunkMatch int
+
+const (
+	chunkNew chunkMatch = iota
+	chunkSame
+	chunkDifferent
+)
+
+// matchChunk compares an incoming chunk with the one the session already
+// holds at idx. Hashes recorded in the same algorithm are compared directly,
+// otherwise the stored chunk is read back and hashed.
+func (h *UploadsHandler) matchChunk(ctx context.Context, session *store.UploadSession, idx uint32, expected *digest.Digest) (chunkMatch, error) {
+	if !session.HasChunk(idx) {
+		return chunkNew, nil
+	}
+
+	comparable := false
+	for _, recorded := range session.RecordedHashes(idx) {
+		if recorded.Algorithm != expected.Algorithm.Name {
+			continue
+		}
+		if recorded.Hash == expected.Hex() {
+			return chunkSame, nil
+		}
+		comparable = true
+	}
+	if comparable {
+		return chunkDifferent, nil
+	}
+
+	same, err := h.uploadService.MatchChunk(ctx, session.UploadID, idx, expected)
+	if err != nil {
+		if errors.Is(err, store.ErrChunkNotFound) {
+			// recorded but lost, storing it again repairs the session
+			return chunkNew, nil
+		}
+		return chunkNew, err
+	}
+	if same {
+		return chunkSame, nil
+	}
+	return chunkDifferent, nil
+}
+
+func overwriteRequested(header http.Header) bool {
+	overwrite, _ := strconv.ParseBool(header.Get(OverwriteHeader))
+	return overwrite
+}
@@ -0,0 +1,67 @@
+package uploads
+
+import (
+	"strconv"
+	"strings"
+)
+
+// contentRange is a parsed "bytes first-last/total" header. First and last
+// are -1 for the "bytes */total" status query form, total is -1 when the
+// client sent "*" for it.
+type contentRange struct {
+	first int64
+	last  int64
+	total int64
+}
+
+func (r contentRange) isQuery() bool {
+	return r.first < 0
+}
+
+func (r contentRange) length() int64 {
+	return r.last - r.first + 1
+}
+
+func parseContentRange(header string) (contentRange, bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !ok {
+		return contentRange{}, false
+	}
+
+	rangeStr, totalStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return contentRange{}, false
+	}
+
+	r := contentRange{first: -1, last: -1, total: -1}
+	if totalStr != "*" {
+		total, err := strconv.ParseInt(totalStr, 10, 64)
+		if err != nil || total < 0 {
+			return contentRange{}, false
+		}
+		r.total = total
+	}
+
+	if rangeStr == "*" {
+		return r, r.total >= 0
+	}
+
+	firstStr, lastStr, ok := strings.Cut(rangeStr, "-")
+	if !ok {
+		return contentRange{}, false
+	}
+	first, err := strconv.ParseInt(firstStr, 10, 64)
+	if err != nil || first < 0 {
+		return contentRange{}, false
+	}
+	last, err := strconv.ParseInt(lastStr, 10, 64)
+	if err != nil || last < first {
+		return contentRange{}, false
+	}
+	if r.total >= 0 && last >= r.total {
+		return contentRange{}, false
+	}
+
+	r.first, r.last = first, last
+	return r, true
+}
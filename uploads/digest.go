@@ -0,0 +1,150 @@
+package uploads
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+var errMissingDigest = errors.New("missing chunk digest")
+
+// chunkDigest picks the expected digest of a chunk sent without a
+// Content-Encoding from its headers. The body is the chunk itself, so the
+// RFC 9530 Content-Digest comes first, then the representation fields read
+// by reprDigest.
+func chunkDigest(header http.Header, session *store.UploadSession) (*digest.Digest, error) {
+	d, err := fieldDigest(header, "Content-Digest", session)
+	if err != nil || d != nil {
+		return d, err
+	}
+	return reprDigest(header, session)
+}
+
+// encodedChunkDigests picks the expected digests of a chunk sent with a
+// Content-Encoding. Content-Digest covers the encoded body, it is returned
+// as content to be checked before the body is decoded. The fields of
+// reprDigest cover the decoded chunk, which has no expected digest when only
+// a Content-Digest is sent.
+func encodedChunkDigests(header http.Header, session *store.UploadSession) (chunk *digest.Digest, content *digest.Digest, err error) {
+	content, err = fieldDigest(header, "Content-Digest", session)
+	if err != nil {
+		return nil, nil, err
+	}
+	chunk, err = reprDigest(header, session)
+	if errors.Is(err, errMissingDigest) && content != nil {
+		return nil, content, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return chunk, content, nil
+}
+
+// reprDigest picks the expected digest of the chunk data from the RFC 9530
+// Repr-Digest field, then Content-MD5 and finally X-Chunk-Hash, read as hex
+// or base64 of the session algorithm.
+func reprDigest(header http.Header, session *store.UploadSession) (*digest.Digest, error) {
+	d, err := fieldDigest(header, "Repr-Digest", session)
+	if err != nil || d != nil {
+		return d, err
+	}
+
+	if value := header.Get("Content-MD5"); value != "" {
+		return digest.Decode(digest.MD5, value)
+	}
+
+	if value := header.Get("X-Chunk-Hash"); value != "" {
+		alg, err := digest.Lookup(session.ChunkHashAlgorithm())
+		if err != nil {
+			return nil, err
+		}
+		return digest.Decode(alg, value)
+	}
+
+	return nil, errMissingDigest
+}
+
+// fieldDigest parses an RFC 9530 digest field, preferring the session
+// algorithm when several are listed. It returns nil when the field is not
+// sent.
+func fieldDigest(header http.Header, field string, session *store.UploadSession) (*digest.Digest, error) {
+	values := header.Values(field)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	digests, err := digest.ParseHeader(strings.Join(values, ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(digests) == 0 {
+		return nil, digest.ErrUnsupportedAlgorithm
+	}
+	for _, d := range digests {
+		if d.Algorithm.Name == session.ChunkHashAlgorithm() {
+			return d, nil
+		}
+	}
+	return digests[0], nil
+}
+
+// dataDigest hashes decoded chunk data with the session algorithm, for
+// encoded chunks sent with only a Content-Digest.
+func dataDigest(data []byte, session *store.UploadSession) (*digest.Digest, error) {
+	alg, err := digest.Lookup(session.ChunkHashAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	h := alg.New()
+	h.Write(data)
+	return &digest.Digest{Algorithm: alg, Sum: h.Sum(nil)}, nil
+}
+
+// digestProblem returns the problem code and message of a chunkDigest
+// failure.
+func digestProblem(err error) (string, string) {
+	switch {
+	case errors.Is(err, errMissingDigest):
+		return problem.CodeMissingDigest, "missing chunk digest"
+	case errors.Is(err, digest.ErrUnsupportedAlgorithm):
+		return problem.CodeUnsupportedAlgorithm, "unsupported digest algorithm"
+	default:
+		return problem.CodeInvalidDigest, "invalid chunk digest"
+	}
+}
+
+// chunkLayoutProblem returns the problem code of a chunk that does not fit
+// the session layout.
+func chunkLayoutProblem(err error) string {
+	if errors.Is(err, store.ErrChunkOutOfRange) {
+		return problem.CodeChunkIndexOutOfRange
+	}
+	return problem.CodeChunkSizeMismatch
+}
+
+// setStoredDigest describes a stored chunk with X-Chunk-Hash and its RFC
+// 9530 Repr-Digest. Chunks stored before algorithms were recorded are SHA256.
+func setStoredDigest(header http.Header, info *store.ChunkInfo) {
+	if info.Hash == "" {
+		return
+	}
+
+	algorithm := info.HashAlgorithm
+	if algorithm == "" {
+		algorithm = digest.Default
+	}
+	header.Set("X-Chunk-Hash", info.Hash)
+	header.Set("X-Chunk-Hash-Algorithm", algorithm)
+
+	alg, err := digest.Lookup(algorithm)
+	if err != nil {
+		return
+	}
+	if d, err := digest.Decode(alg, info.Hash); err == nil {
+		header.Set("Repr-Digest", digest.FormatHeader(d))
+	}
+}
@@ -0,0 +1,86 @@
+package uploads
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/compression"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+)
+
+// readChunkData reads a chunk body into memory, decoding it when it was sent
+// with a Content-Encoding. The encoded body is bounded by bodyLimit, the
+// decoded data by limit and the compression ratio limit. A content digest is
+// checked against the body as sent. It answers the request and reports false
+// when the body is not a valid chunk.
+func (h *UploadsHandler) readChunkData(c *gin.Context, session *store.UploadSession, chunkId uint32, encoding string, limit int64, bodyLimit int64, content *digest.Digest) ([]byte, bool) {
+	var body io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, bodyLimit)
+	var sum hash.Hash
+	if content != nil {
+		sum = content.Algorithm.New()
+		body = io.TeeReader(body, sum)
+	}
+	data, err := compression.Decode(body, encoding, compression.Limits{MaxSize: limit, MaxRatio: h.maxRatio})
+	if err == nil && sum != nil {
+		// the content digest covers any bytes after the encoded data too
+		_, err = io.Copy(io.Discard, body)
+	}
+	if err != nil {
+		if h.respondBodyTooLarge(c, session.UploadID, err) {
+			return nil, false
+		}
+
+		h.logger.Warn("upload chunk failed",
+			"upload_id", session.UploadID,
+			"chunk_id", chunkId,
+			"encoding", encoding,
+			"reason", "invalid_chunk_body",
+			"error", err,
+		)
+		switch {
+		case errors.Is(err, compression.ErrTooLarge):
+			problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeChunkTooLarge, chunkTooLargeMessage(limit))
+		case errors.Is(err, compression.ErrRatio):
+			problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeCompressionRatio, fmt.Sprintf("chunk exceeds the maximum compression ratio of %d", h.maxRatio))
+		case errors.Is(err, compression.ErrCorrupt):
+			problem.Write(c, http.StatusBadRequest, problem.CodeInvalidEncodedBody, fmt.Sprintf("invalid %s body", encoding))
+		default:
+			problem.BadRequest(c, "failed to read chunk body")
+		}
+		return nil, false
+	}
+
+	if sum != nil && !content.Matches(sum.Sum(nil)) {
+		h.logger.Warn("upload chunk failed",
+			"upload_id", session.UploadID,
+			"chunk_id", chunkId,
+			"encoding", encoding,
+			"reason", "integrity_error",
+			"algorithm", content.Algorithm.Name,
+		)
+		problem.Write(c, http.StatusBadRequest, problem.CodeIntegrityMismatch, "chunk body does not match its content digest")
+		return nil, false
+	}
+
+	if len(data) == 0 {
+		problem.Write(c, http.StatusBadRequest, problem.CodeEmptyChunk, "no chunk binary data")
+		return nil, false
+	}
+	if err := session.ValidateChunk(chunkId, int64(len(data))); err != nil {
+		h.logger.Warn("upload chunk failed",
+			"upload_id", session.UploadID,
+			"chunk_id", chunkId,
+			"chunk_size", len(data),
+			"reason", "invalid_chunk_layout",
+		)
+		problem.Write(c, http.StatusBadRequest, chunkLayoutProblem(err), err.Error())
+		return nil, false
+	}
+	return data, true
+}
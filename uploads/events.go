@@ -0,0 +1,180 @@
+package uploads
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	apperror "github.com/Yulian302/lfusys-services-commons/errors"
+	"github.com/Yulian302/lfusys-services-uploads/events"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// upgrader accepts WebSocket connections from any origin. Requests carry a
+// bearer token rather than cookies, so a foreign page cannot connect with the
+// credentials of a browser session.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Events godoc
+//
+//	@Summary		Watch upload progress
+//	@Description	Stream the progress of an upload as Server-Sent Events, or as WebSocket text messages when the request asks for a WebSocket upgrade. The first event is the current state of the upload, chunk_received and progress events follow as chunks arrive and the stream ends after a finalized, failed or aborted event. Idle streams get a keep alive comment, or a ping, at every heartbeat.
+//	@Tags			uploads
+//	@Produce		text/event-stream
+//	@Param			uploadId	path		string			true	"Upload session ID"
+//	@Success		200			{object}	events.Event	"Stream of upload events"
+//	@Success		101			"Switched to a WebSocket"
+//	@Failure		400			{object}	problem.Problem	"Invalid request"
+//	@Failure		401			{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		403			{object}	problem.Problem	"Upload belongs to another user"
+//	@Failure		404			{object}	problem.Problem	"Session not found"
+//	@Failure		500			{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId}/events [get]
+func (h *UploadsHandler) Events(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+	if uploadId == "" {
+		problem.BadRequest(c, "invalid fields")
+		return
+	}
+
+	// subscribe before reading the session so no event in between is lost
+	stream, unsubscribe := h.events.Subscribe(uploadId)
+	defer unsubscribe()
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if errors.Is(err, apperror.ErrSessionNotFound) {
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+			return
+		}
+		h.logger.Error("watch upload failed",
+			"upload_id", uploadId,
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+		return
+	}
+
+	current := events.Current(session, time.Now())
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		h.streamWebSocket(c, current, stream)
+	} else {
+		h.streamSSE(c, current, stream)
+	}
+}
+
+func (h *UploadsHandler) streamSSE(c *gin.Context, current events.Event, stream <-chan events.Event) {
+	c.Header("Cache-Control", "no-cache")
+	// keeps proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent(current.Type, current)
+	c.Writer.Flush()
+	if current.Terminal() {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			c.SSEvent(event.Type, event)
+			c.Writer.Flush()
+			if event.Terminal() {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func (h *UploadsHandler) streamWebSocket(c *gin.Context, current events.Event, stream <-chan events.Event) {
+	uploadId := current.UploadID
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has answered the request
+		h.logger.Warn("watch upload failed",
+			"upload_id", uploadId,
+			"reason", "websocket_upgrade",
+			"error", err,
+		)
+		return
+	}
+	defer conn.Close()
+
+	// clients do not send messages, reading only handles their pongs and
+	// notices when they go away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event events.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(h.heartbeat))
+		return conn.WriteJSON(event)
+	}
+	closeWith := func(code int) {
+		message := websocket.FormatCloseMessage(code, "")
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	}
+
+	if err := send(current); err != nil {
+		return
+	}
+	if current.Terminal() {
+		closeWith(websocket.CloseNormalClosure)
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case event, ok := <-stream:
+			if !ok {
+				// dropped as too slow or shutting down, the client reconnects
+				closeWith(websocket.CloseGoingAway)
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			if event.Terminal() {
+				closeWith(websocket.CloseNormalClosure)
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.heartbeat)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,64 +1,173 @@
 package uploads
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	error "errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
-	logger "github.com/Yulian302/lfusys-services-commons/logging"
 	"github.com/Yulian302/lfusys-services-commons/errors"
+	logger "github.com/Yulian302/lfusys-services-commons/logging"
+	"github.com/Yulian302/lfusys-services-uploads/compression"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/events"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
 	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
 	"github.com/gin-gonic/gin"
 )
 
 type UploadsHandler struct {
 	uploadService  services.UploadService
 	sessionService services.SessionService
+	streamService  services.StreamService
+	maxChunkSize   int64
+	maxRatio       int64
+	events         events.Subscriber
+	heartbeat      time.Duration
 
 	logger logger.Logger
 }
 
-func NewUploadsHandler(uploadService services.UploadService, sesionService services.SessionService, l logger.Logger) *UploadsHandler {
+func NewUploadsHandler(uploadService services.UploadService, sesionService services.SessionService, streamService services.StreamService, maxChunkSize int64, maxCompressionRatio int64, subscriber events.Subscriber, heartbeat time.Duration, l logger.Logger) *UploadsHandler {
 	return &UploadsHandler{
 		uploadService:  uploadService,
 		sessionService: sesionService,
+		streamService:  streamService,
+		maxChunkSize:   maxChunkSize,
+		maxRatio:       maxCompressionRatio,
+		events:         subscriber,
+		heartbeat:      heartbeat,
 		logger:         l,
 	}
 }
 
-type HTTPError struct {
-	Error string `json:"error" example:"error message"`
+// Create godoc
+//
+//	@Summary		Create upload session
+//	@Description	Start a new chunked upload for a file of the given size. An optional file hash or Merkle root over the chunk hashes is verified before the upload completes.
+//	@Tags			uploads
+//	@Accept			json
+//	@Produce		json
+//	@Param			request					body		CreateUploadRequest		true	"File description"
+//	@Param			X-SSE-Customer-Key		header		string					false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header		string					false	"Base64 MD5 of the SSE-C key"
+//	@Success		201						{object}	CreateUploadResponse	"Upload session created"
+//	@Failure		400						{object}	problem.Problem			"Invalid request or encryption key"
+//	@Failure		401						{object}	problem.Problem			"Missing or invalid token"
+//	@Failure		413						{object}	problem.Problem			"Chunk size above the maximum or file larger than the open session byte quota"
+//	@Failure		429						{object}	problem.Problem			"Open session or byte quota exceeded"
+//	@Failure		500						{object}	problem.Problem			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload [post]
+func (h *UploadsHandler) Create(c *gin.Context) {
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("create upload failed",
+			"reason", "invalid_body",
+			"error", err,
+		)
+		problem.BadRequest(c, "invalid fields")
+		return
+	}
+
+	key, err := store.DefaultCustomerKeyHeaders.CustomerKey(c.Request.Header)
+	if err != nil {
+		h.respondEncryptionError(c, "", err)
+		return
+	}
+
+	session, err := h.sessionService.CreateSession(c.Request.Context(), services.SessionParams{
+		FileName:          req.FileName,
+		FileSize:          req.TotalSize,
+		ChunkSize:         req.ChunkSize,
+		MaxChunkSize:      req.MaxChunkSize,
+		FileHash:          req.FileHash,
+		FileHashAlgorithm: req.FileHashAlgorithm,
+		MerkleRoot:        req.MerkleRoot,
+		HashAlgorithm:     req.HashAlgorithm,
+		StorageEncoding:   req.StorageEncoding,
+		CustomerKey:       key,
+	})
+	if err != nil {
+		if error.Is(err, services.ErrInvalidSession) {
+			problem.BadRequest(c, "invalid file size, chunk size, hashes or storage encoding")
+			return
+		}
+		if error.Is(err, services.ErrChunkTooLarge) {
+			problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeChunkTooLarge, err.Error())
+			return
+		}
+		if h.respondQuotaExceeded(c, "", err) || h.respondEncryptionError(c, "", err) {
+			return
+		}
+		h.logger.Error("create upload failed",
+			"file_name", req.FileName,
+			"error", err,
+		)
+		problem.Internal(c, "could not create upload session")
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateUploadResponse{
+		UploadId:        session.UploadID,
+		Status:          session.Status,
+		TotalChunks:     session.TotalChunks,
+		ChunkSize:       session.ChunkSize,
+		MaxChunkSize:    session.MaxChunkSize,
+		HashAlgorithm:   session.ChunkHashAlgorithm(),
+		StorageEncoding: session.StorageEncoding,
+		Encryption:      session.Encryption,
+		KMSKeyID:        session.KMSKeyID,
+		ExpiresAt:       session.ExpiresAt,
+	})
 }
 
 // Upload godoc
 //
 //	@Summary		Upload file chunk
-//	@Description	Upload a file chunk with integrity verification
+//	@Description	Upload a file chunk with integrity verification. Every chunk but the last must be exactly the session chunk size, the last one holds the remainder. The digest is read from Content-Digest, Repr-Digest, Content-MD5 or X-Chunk-Hash, in that order, and one of them is required. Chunks may be sent gzip or zstd encoded, sizes then apply to the decoded data, as do all digests but Content-Digest, which covers the encoded body.
 //	@Tags			uploads
 //	@Accept			octet-stream
 //	@Produce		json
-//	@Param			uploadId		path		string			true	"Upload session ID"
-//	@Param			chunkId			path		int				true	"Chunk number"
-//	@Param			X-Chunk-Hash	header		string			true	"SHA256 hash of chunk data"
-//	@Success		200				{object}	UploadResponse	"Chunk uploaded successfully"
-//	@Failure		400				{object}	HTTPError		"Invalid request or integrity error"
-//	@Failure		500				{object}	HTTPError		"S3 upload failed"
+//	@Param			uploadId				path		string			true	"Upload session ID"
+//	@Param			chunkId					path		int				true	"Chunk number"
+//	@Param			Content-Digest			header		string			false	"RFC 9530 digest of the body as sent, e.g. crc32c=:base64:"
+//	@Param			Repr-Digest				header		string			false	"RFC 9530 digest of chunk data"
+//	@Param			Content-MD5				header		string			false	"Base64 MD5 of chunk data"
+//	@Param			X-Chunk-Hash			header		string			false	"Hex or base64 hash of chunk data in the session algorithm"
+//	@Param			X-Chunk-Overwrite		header		bool			false	"Replace a chunk already uploaded with different content"
+//	@Param			Content-Encoding		header		string			false	"gzip or zstd when the chunk is sent compressed"
+//	@Param			X-SSE-Customer-Key		header		string			false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header		string			false	"Base64 MD5 of the SSE-C key"
+//	@Success		200						{object}	UploadResponse	"Chunk uploaded, or already uploaded with the same content"
+//	@Failure		400						{object}	problem.Problem	"Invalid request, chunk index out of range, wrong chunk size, integrity error or missing encryption key"
+//	@Failure		401						{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		404						{object}	problem.Problem	"Session not found"
+//	@Failure		403						{object}	problem.Problem	"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		409						{object}	problem.Problem	"Upload completed, failed verification or chunk already uploaded with different content"
+//	@Failure		410						{object}	problem.Problem	"Upload aborted or session expired"
+//	@Failure		411						{object}	problem.Problem	"Content length required"
+//	@Failure		413						{object}	problem.Problem	"Chunk larger than its expected or maximum size, decoded chunk past the compression ratio limit, or chunk larger than the daily byte quota"
+//	@Failure		415						{object}	problem.Problem	"Unsupported content encoding"
+//	@Failure		422						{object}	problem.Problem	"Assembled file failed verification"
+//	@Failure		429						{object}	problem.Problem	"Daily byte quota exceeded"
+//	@Failure		500						{object}	problem.Problem	"S3 upload failed"
+//	@Security		BearerAuth
 //	@Router			/upload/{uploadId}/chunk/{chunkId} [put]
 func (h *UploadsHandler) Upload(c *gin.Context) {
 	uploadId := c.Param("uploadId")
 	chunkIdStr := c.Param("chunkId")
-	expectedHash := c.GetHeader("X-Chunk-Hash")
 
-	if uploadId == "" || chunkIdStr == "" || expectedHash == "" {
+	if uploadId == "" || chunkIdStr == "" {
 		h.logger.Warn("upload chunk failed",
 			"upload_id", uploadId,
 			"chunk_id", chunkIdStr,
 			"reason", "missing_fields",
 		)
-		errors.BadRequestResponse(c, "invalid fields")
+		problem.BadRequest(c, "invalid fields")
 		return
 	}
 
@@ -69,90 +178,246 @@ func (h *UploadsHandler) Upload(c *gin.Context) {
 			"chunk_id", chunkIdStr,
 			"reason", "invalid_chunk_id",
 		)
-		errors.BadRequestResponse(c, "invalid chunk ID")
+		problem.Write(c, http.StatusBadRequest, problem.CodeInvalidChunkID, "invalid chunk ID")
+		return
+	}
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if error.Is(err, errors.ErrSessionNotFound) {
+			h.logger.Warn("upload chunk failed",
+				"upload_id", uploadId,
+				"chunk_id", chunkId,
+				"reason", "session_not_found",
+			)
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+			return
+		}
+		h.logger.Error("upload chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+		return
+	}
+
+	// completed sessions still answer identical retries below
+	if err := session.CheckWritable(time.Now()); err != nil && !error.Is(err, store.ErrSessionCompleted) {
+		h.respondClosedSession(c, uploadId, err)
+		return
+	}
+	if !h.applyEncryption(c, session) {
+		return
+	}
+
+	encoding, err := compression.Parse(c.GetHeader("Content-Encoding"))
+	if err != nil {
+		h.logger.Warn("upload chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "unsupported_encoding",
+			"encoding", c.GetHeader("Content-Encoding"),
+		)
+		c.Header("Accept-Encoding", compression.Accepted)
+		problem.Write(c, http.StatusUnsupportedMediaType, problem.CodeUnsupportedEncoding, "unsupported content encoding")
 		return
 	}
 
-	chunkData, err := io.ReadAll(c.Request.Body)
+	var expected, content *digest.Digest
+	if encoding == compression.Identity {
+		expected, err = chunkDigest(c.Request.Header, session)
+	} else {
+		expected, content, err = encodedChunkDigests(c.Request.Header, session)
+	}
 	if err != nil {
 		h.logger.Warn("upload chunk failed",
 			"upload_id", uploadId,
 			"chunk_id", chunkId,
-			"reason", "failed_to_read_body",
+			"reason", "invalid_digest",
+			"error", err,
+		)
+		c.Header("Want-Content-Digest", digest.WantHeader(session.ChunkHashAlgorithm()))
+		code, message := digestProblem(err)
+		problem.Write(c, http.StatusBadRequest, code, message)
+		return
+	}
+
+	chunkSize := c.Request.ContentLength
+	if chunkSize < 0 {
+		h.logger.Warn("upload chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "unknown_content_length",
 		)
-		errors.BadRequestResponse(c, "failed to read chunk data")
+		problem.Write(c, http.StatusLengthRequired, problem.CodeLengthRequired, "content length required")
 		return
 	}
 
-	if len(chunkData) == 0 {
+	if chunkSize == 0 {
 		h.logger.Warn("upload chunk failed",
 			"upload_id", uploadId,
 			"chunk_id", chunkId,
 			"reason", "empty_chunk_data",
 		)
-		errors.BadRequestResponse(c, "no chunk binary data")
+		problem.Write(c, http.StatusBadRequest, problem.CodeEmptyChunk, "no chunk binary data")
 		return
 	}
 
-	// hash integrity check
-	hash := sha256.New()
-	hash.Write(chunkData)
-	calculatedHash := hex.EncodeToString(hash.Sum(nil))
-	if expectedHash != calculatedHash {
+	// encoded bodies are checked against the limit once decoded
+	limit := session.ChunkLimit(uint32(chunkId), h.maxChunkSize)
+	bodyLimit := limit
+	if encoding != compression.Identity {
+		bodyLimit = compression.Bound(limit)
+	}
+	if chunkSize > bodyLimit {
 		h.logger.Warn("upload chunk failed",
 			"upload_id", uploadId,
 			"chunk_id", chunkId,
-			"expected_hash", expectedHash,
-			"calculated_hash", calculatedHash,
-			"reason", "integrity_error",
+			"chunk_size", chunkSize,
+			"limit", limit,
+			"reason", "chunk_too_large",
 		)
-		errors.BadRequestResponse(c, "integrity error")
+		problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeChunkTooLarge, chunkTooLargeMessage(limit))
 		return
 	}
 
-	err = h.uploadService.Upload(c.Request.Context(), uploadId, uint32(chunkId), chunkData)
+	// encoded chunks are decoded up front, their digest may only be known
+	// from the decoded data
+	var data []byte
+	if encoding == compression.Identity {
+		if err := session.ValidateChunk(uint32(chunkId), chunkSize); err != nil {
+			h.logger.Warn("upload chunk failed",
+				"upload_id", uploadId,
+				"chunk_id", chunkId,
+				"chunk_size", chunkSize,
+				"reason", "invalid_chunk_layout",
+			)
+			problem.Write(c, http.StatusBadRequest, chunkLayoutProblem(err), err.Error())
+			return
+		}
+	} else {
+		var ok bool
+		if data, ok = h.readChunkData(c, session, uint32(chunkId), encoding, limit, bodyLimit, content); !ok {
+			return
+		}
+		if expected == nil {
+			if expected, err = dataDigest(data, session); err != nil {
+				h.logger.Error("upload chunk failed",
+					"upload_id", uploadId,
+					"chunk_id", chunkId,
+					"error", err,
+				)
+				problem.Internal(c, "internal server error")
+				return
+			}
+		}
+	}
+
+	match, err := h.matchChunk(c.Request.Context(), session, uint32(chunkId), expected)
 	if err != nil {
 		h.logger.Error("upload chunk failed",
 			"upload_id", uploadId,
 			"chunk_id", chunkId,
-			"chunk_size", len(chunkData),
+			"reason", "chunk_compare_failed",
 			"error", err,
 		)
-		errors.InternalServerErrorResponse(c, err.Error())
+		problem.Internal(c, "internal server error")
 		return
 	}
 
-	err = h.sessionService.MarkChunkComplete(c.Request.Context(), uploadId, uint32(chunkId))
-	if err != nil {
-		if error.Is(err, errors.ErrSessionNotFound) {
-			h.logger.Warn("mark chunk complete failed",
+	switch match {
+	case chunkSame:
+		h.logger.Info("chunk already uploaded",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+		)
+		// a retry after a lost finalization completes the upload again
+		if session.Status != store.SessionStatusCompleted && uint32(len(session.ReceivedChunks())) == session.TotalChunks {
+			if err := h.sessionService.MarkChunkComplete(c.Request.Context(), uploadId, store.NewChunkHash(uint32(chunkId), expected)); err != nil {
+				h.respondMarkChunkError(c, uploadId, uint32(chunkId), err)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, UploadResponse{
+			UploadId:  uploadId,
+			ChunkId:   uint32(chunkId),
+			Duplicate: true,
+		})
+		return
+	case chunkDifferent:
+		if !overwriteRequested(c.Request.Header) {
+			h.logger.Warn("upload chunk failed",
 				"upload_id", uploadId,
 				"chunk_id", chunkId,
-				"reason", "session_not_found",
+				"reason", "chunk_conflict",
 			)
-			errors.UnauthorizedResponse(c, "session not found")
-		} else if error.Is(err, errors.ErrSessionUpdateDetails) {
-			h.logger.Error("mark chunk complete failed",
+			problem.Write(c, http.StatusConflict, problem.CodeChunkConflict, "chunk already uploaded with different content")
+			return
+		}
+		h.logger.Info("overwriting chunk",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+		)
+	}
+
+	if session.Status == store.SessionStatusCompleted {
+		h.respondClosedSession(c, uploadId, store.ErrSessionCompleted)
+		return
+	}
+
+	var computed *digest.Digest
+	if encoding == compression.Identity && session.StorageEncoding == "" {
+		// hash integrity is checked while the body is streamed to storage
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		computed, err = h.uploadService.Upload(c.Request.Context(), uploadId, uint32(chunkId), body, chunkSize, expected)
+	} else {
+		if data == nil {
+			var ok bool
+			if data, ok = h.readChunkData(c, session, uint32(chunkId), encoding, limit, bodyLimit, nil); !ok {
+				return
+			}
+		}
+		chunkSize = int64(len(data))
+		computed, err = h.uploadService.UploadData(c.Request.Context(), uploadId, uint32(chunkId), data, session.StorageEncoding, expected)
+	}
+	if err != nil {
+		if h.respondQuotaExceeded(c, uploadId, err) || h.respondBodyTooLarge(c, uploadId, err) {
+			return
+		}
+		if error.Is(err, services.ErrIntegrity) {
+			h.logger.Warn("upload chunk failed",
 				"upload_id", uploadId,
 				"chunk_id", chunkId,
-				"reason", "session_update_error",
+				"reason", "integrity_error",
+				"algorithm", expected.Algorithm.Name,
 			)
-			errors.InternalServerErrorResponse(c, "could not update session details")
-		} else {
-			h.logger.Error("mark chunk complete failed",
-				"upload_id", uploadId,
-				"chunk_id", chunkId,
-				"error", err,
-			)
-			errors.InternalServerErrorResponse(c, "internal server error")
+			problem.Write(c, http.StatusBadRequest, problem.CodeIntegrityMismatch, "chunk does not match its digest")
+			return
 		}
+		h.logger.Error("upload chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"chunk_size", chunkSize,
+			"error", err,
+		)
+		problem.Internal(c, "could not store chunk")
+		return
+	}
+
+	err = h.sessionService.MarkChunkComplete(c.Request.Context(), uploadId, store.NewChunkHash(uint32(chunkId), computed))
+	if err != nil {
+		h.respondMarkChunkError(c, uploadId, uint32(chunkId), err)
 		return
 	}
 
 	h.logger.Info("chunk uploaded successfully",
 		"upload_id", uploadId,
 		"chunk_id", chunkId,
-		"chunk_size", len(chunkData),
+		"chunk_size", chunkSize,
 	)
 
 	c.JSON(http.StatusOK, UploadResponse{
@@ -160,3 +425,332 @@ func (h *UploadsHandler) Upload(c *gin.Context) {
 		ChunkId:  uint32(chunkId),
 	})
 }
+
+// Status godoc
+//
+//	@Summary		Get upload status
+//	@Description	Report which chunks of an upload are stored and which are still missing
+//	@Tags			uploads
+//	@Produce		json
+//	@Param			uploadId	path		string					true	"Upload session ID"
+//	@Success		200			{object}	UploadStatusResponse	"Upload status"
+//	@Failure		400			{object}	problem.Problem			"Invalid request"
+//	@Failure		401			{object}	problem.Problem			"Missing or invalid token"
+//	@Failure		403			{object}	problem.Problem			"Upload belongs to another user"
+//	@Failure		404			{object}	problem.Problem			"Session not found"
+//	@Failure		500			{object}	problem.Problem			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId} [get]
+func (h *UploadsHandler) Status(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+	if uploadId == "" {
+		problem.BadRequest(c, "invalid fields")
+		return
+	}
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if error.Is(err, errors.ErrSessionNotFound) {
+			h.logger.Warn("get upload status failed",
+				"upload_id", uploadId,
+				"reason", "session_not_found",
+			)
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+			return
+		}
+		h.logger.Error("get upload status failed",
+			"upload_id", uploadId,
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, newUploadStatusResponse(uploadId, session))
+}
+
+// HeadChunk godoc
+//
+//	@Summary		Probe uploaded chunk
+//	@Description	Check whether a chunk is already persisted, returning its hash and size in headers
+//	@Tags			uploads
+//	@Param			uploadId				path	string	true	"Upload session ID"
+//	@Param			chunkId					path	int		true	"Chunk number"
+//	@Param			X-SSE-Customer-Key		header	string	false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header	string	false	"Base64 MD5 of the SSE-C key"
+//	@Success		200						"Chunk is stored"
+//	@Header			200						{string}	X-Chunk-Hash			"Hex hash of chunk data"
+//	@Header			200						{string}	X-Chunk-Hash-Algorithm	"Algorithm of X-Chunk-Hash"
+//	@Header			200						{string}	Repr-Digest				"RFC 9530 digest of chunk data"
+//	@Header			200						{integer}	X-Chunk-Size			"Chunk size in bytes"
+//	@Failure		400						"Invalid request"
+//	@Failure		401						"Missing or invalid token"
+//	@Failure		403						"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		404						"Chunk or session not found"
+//	@Failure		500						"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId}/chunk/{chunkId} [head]
+func (h *UploadsHandler) HeadChunk(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+	chunkId, err := strconv.ParseUint(c.Param("chunkId"), 10, 32)
+	if uploadId == "" || err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if error.Is(err, errors.ErrSessionNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !session.HasChunk(uint32(chunkId)) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if !h.applyEncryption(c, session) {
+		return
+	}
+
+	info, err := h.uploadService.GetChunk(c.Request.Context(), uploadId, uint32(chunkId))
+	if err != nil {
+		if error.Is(err, store.ErrChunkNotFound) {
+			h.logger.Warn("chunk recorded but not stored",
+				"upload_id", uploadId,
+				"chunk_id", chunkId,
+			)
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	setStoredDigest(c.Writer.Header(), info)
+	c.Header("X-Chunk-Size", strconv.FormatInt(info.Size, 10))
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(http.StatusOK)
+}
+
+// Abort godoc
+//
+//	@Summary		Abort upload
+//	@Description	Abort an upload session and delete all of its stored chunks
+//	@Tags			uploads
+//	@Produce		json
+//	@Param			uploadId	path		string			true	"Upload session ID"
+//	@Success		200			{object}	AbortResponse	"Upload aborted"
+//	@Failure		400			{object}	problem.Problem	"Invalid request"
+//	@Failure		401			{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		403			{object}	problem.Problem	"Upload belongs to another user"
+//	@Failure		404			{object}	problem.Problem	"Session not found"
+//	@Failure		409			{object}	problem.Problem	"Upload already completed or failed verification"
+//	@Failure		500			{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId} [delete]
+func (h *UploadsHandler) Abort(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+	if uploadId == "" {
+		problem.BadRequest(c, "invalid fields")
+		return
+	}
+
+	err := h.sessionService.AbortUpload(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if error.Is(err, errors.ErrSessionNotFound) {
+			h.logger.Warn("abort upload failed",
+				"upload_id", uploadId,
+				"reason", "session_not_found",
+			)
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+		} else if !h.respondClosedSession(c, uploadId, err) {
+			h.logger.Error("abort upload failed",
+				"upload_id", uploadId,
+				"error", err,
+			)
+			problem.Internal(c, "internal server error")
+		}
+		return
+	}
+
+	deleted, err := h.uploadService.DeleteUpload(c.Request.Context(), uploadId)
+	if err != nil {
+		h.logger.Error("abort upload failed",
+			"upload_id", uploadId,
+			"reason", "chunk_purge_failed",
+			"error", err,
+		)
+		problem.Internal(c, "could not delete upload chunks")
+		return
+	}
+
+	h.logger.Info("upload aborted",
+		"upload_id", uploadId,
+		"deleted_chunks", deleted,
+	)
+
+	c.JSON(http.StatusOK, AbortResponse{
+		UploadId:      uploadId,
+		Status:        store.SessionStatusAborted,
+		DeletedChunks: deleted,
+	})
+}
+
+// Resume godoc
+//
+//	@Summary		Resumable byte range upload
+//	@Description	Upload a byte range of the file with Content-Range "bytes first-last/total", or query the committed range with "bytes */total" and an empty body. Incomplete uploads answer 308 with the committed bytes in the Range header, completed uploads answer with their status.
+//	@Tags			uploads
+//	@Accept			octet-stream
+//	@Produce		json
+//	@Param			uploadId				path		string					true	"Upload session ID"
+//	@Param			Content-Range			header		string					true	"Byte range of the body"
+//	@Param			X-SSE-Customer-Key		header		string					false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header		string					false	"Base64 MD5 of the SSE-C key"
+//	@Success		200						{object}	UploadStatusResponse	"Upload complete"
+//	@Success		308						"Upload incomplete"
+//	@Header			308						{string}	Range			"Committed bytes, e.g. bytes=0-1048575"
+//	@Failure		400						{object}	problem.Problem	"Invalid request"
+//	@Failure		401						{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		403						{object}	problem.Problem	"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		404						{object}	problem.Problem	"Session not found"
+//	@Failure		409						{object}	problem.Problem	"Upload completed or failed verification"
+//	@Failure		410						{object}	problem.Problem	"Upload aborted or session expired"
+//	@Failure		413						{object}	problem.Problem	"Range exceeds file size or daily byte quota"
+//	@Failure		422						{object}	problem.Problem	"Assembled file failed verification"
+//	@Failure		429						{object}	problem.Problem	"Daily byte quota exceeded"
+//	@Failure		500						{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId} [put]
+func (h *UploadsHandler) Resume(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+
+	contentRange, ok := parseContentRange(c.GetHeader("Content-Range"))
+	if uploadId == "" || !ok {
+		problem.Write(c, http.StatusBadRequest, problem.CodeInvalidContentRange, "invalid Content-Range")
+		return
+	}
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return
+		}
+		if error.Is(err, errors.ErrSessionNotFound) {
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+			return
+		}
+		h.logger.Error("resumable upload failed",
+			"upload_id", uploadId,
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+		return
+	}
+
+	// every byte of a completed upload is stored, so any range is answered with its status
+	if session.Status == store.SessionStatusCompleted {
+		c.JSON(http.StatusOK, newUploadStatusResponse(uploadId, session))
+		return
+	}
+	if h.respondClosedSession(c, uploadId, session.CheckWritable(time.Now())) {
+		return
+	}
+	if contentRange.total >= 0 && contentRange.total != session.FileSize {
+		problem.Write(c, http.StatusBadRequest, problem.CodeInvalidContentRange, "Content-Range total does not match file size")
+		return
+	}
+	if !h.applyEncryption(c, session) {
+		return
+	}
+
+	if contentRange.isQuery() {
+		h.respondRange(c, session, session.Offset)
+		return
+	}
+
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != contentRange.length() {
+		problem.Write(c, http.StatusBadRequest, problem.CodeInvalidContentRange, "Content-Range does not match Content-Length")
+		return
+	}
+	if contentRange.first > session.Offset {
+		// a gap cannot be filled, the client resends from the committed offset
+		h.respondRange(c, session, session.Offset)
+		return
+	}
+
+	body := io.LimitReader(c.Request.Body, contentRange.length())
+	if skip := session.Offset - contentRange.first; skip > 0 {
+		if _, err := io.CopyN(io.Discard, body, min(skip, contentRange.length())); err != nil {
+			problem.BadRequest(c, "failed to read range data")
+			return
+		}
+	}
+
+	offset, err := h.streamService.Write(c.Request.Context(), uploadId, session.Offset, body, nil)
+	if err != nil {
+		if h.respondClosedSession(c, uploadId, err) || h.respondQuotaExceeded(c, uploadId, err) {
+			return
+		}
+		switch {
+		case error.Is(err, services.ErrOffsetMismatch), error.Is(err, store.ErrOffsetConflict):
+			h.respondRange(c, session, offset)
+		case error.Is(err, services.ErrFileIntegrity):
+			problem.Write(c, http.StatusUnprocessableEntity, problem.CodeFileIntegrityMismatch, err.Error())
+		case error.Is(err, services.ErrUploadTooLarge):
+			problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeRangeExceedsFileSize, "range exceeds file size")
+		default:
+			h.logger.Error("resumable upload failed",
+				"upload_id", uploadId,
+				"range_first", contentRange.first,
+				"error", err,
+			)
+			problem.Internal(c, "internal server error")
+		}
+		return
+	}
+
+	h.logger.Debug("byte range uploaded",
+		"upload_id", uploadId,
+		"offset", offset,
+	)
+
+	if offset < session.FileSize {
+		h.respondRange(c, session, offset)
+		return
+	}
+
+	session, err = h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		problem.Internal(c, "internal server error")
+		return
+	}
+	c.JSON(http.StatusOK, newUploadStatusResponse(uploadId, session))
+}
+
+// respondRange reports the committed bytes of a resumable upload, 308 while
+// bytes are still missing and the upload status once everything arrived.
+func (h *UploadsHandler) respondRange(c *gin.Context, session *store.UploadSession, offset int64) {
+	if offset >= session.FileSize {
+		c.JSON(http.StatusOK, newUploadStatusResponse(session.UploadID, session))
+		return
+	}
+
+	if offset > 0 {
+		c.Header("Range", fmt.Sprintf("bytes=0-%d", offset-1))
+	}
+	c.Status(http.StatusPermanentRedirect)
+}
@@ -0,0 +1,32 @@
+package uploads
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/gin-gonic/gin"
+)
+
+func chunkTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("chunk exceeds the maximum size of %d bytes", limit)
+}
+
+// respondBodyTooLarge answers a request whose body ran past the limit of its
+// reader. It reports false when err is not about the body size.
+func (h *UploadsHandler) respondBodyTooLarge(c *gin.Context, uploadId string, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+
+	h.logger.Warn("request body too large",
+		"upload_id", uploadId,
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"limit", maxBytesErr.Limit,
+	)
+	problem.Write(c, http.StatusRequestEntityTooLarge, problem.CodeChunkTooLarge, chunkTooLargeMessage(maxBytesErr.Limit))
+	return true
+}
@@ -0,0 +1,306 @@
+package uploads
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	apperror "github.com/Yulian302/lfusys-services-commons/errors"
+	"github.com/Yulian302/lfusys-services-uploads/digest"
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+)
+
+// PresignChunk godoc
+//
+//	@Summary		Presign chunk upload
+//	@Description	Issue a presigned S3 PUT URL so the client uploads a chunk straight to the bucket. The SHA256 checksum is signed into the URL, the PUT has to carry every returned header and the chunk is recorded once it is confirmed. Uploads whose chunks the service encrypts itself cannot be presigned.
+//	@Tags			uploads
+//	@Accept			json
+//	@Produce		json
+//	@Param			uploadId				path		string					true	"Upload session ID"
+//	@Param			chunkId					path		int						true	"Chunk number"
+//	@Param			request					body		PresignChunkRequest		true	"Chunk checksum and size"
+//	@Param			X-SSE-Customer-Key		header		string					false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header		string					false	"Base64 MD5 of the SSE-C key"
+//	@Param			X-Chunk-Overwrite		header		bool					false	"Replace a chunk already uploaded with different content"
+//	@Success		200						{object}	PresignChunkResponse	"Presigned request"
+//	@Failure		400						{object}	problem.Problem			"Invalid request"
+//	@Failure		401						{object}	problem.Problem			"Missing or invalid token"
+//	@Failure		403						{object}	problem.Problem			"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		404						{object}	problem.Problem			"Session not found"
+//	@Failure		409						{object}	problem.Problem			"Upload completed, failed verification or is encrypted by the service, or chunk already uploaded with different content"
+//	@Failure		410						{object}	problem.Problem			"Upload aborted or session expired"
+//	@Failure		500						{object}	problem.Problem			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId}/chunk/{chunkId}/presign [post]
+func (h *UploadsHandler) PresignChunk(c *gin.Context) {
+	var req PresignChunkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BadRequest(c, "invalid fields")
+		return
+	}
+
+	uploadId, chunkId, session, ok := h.chunkSession(c)
+	if !ok {
+		return
+	}
+
+	sum, err := digest.Decode(digest.SHA256, req.ChecksumSHA256)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, problem.CodeInvalidDigest, "invalid sha256 checksum")
+		return
+	}
+
+	size := req.Size
+	if session.TotalChunks > 0 {
+		if size == 0 {
+			size = session.ChunkLength(chunkId)
+		}
+		if err := session.ValidateChunk(chunkId, size); err != nil {
+			problem.Write(c, http.StatusBadRequest, chunkLayoutProblem(err), err.Error())
+			return
+		}
+	} else if size <= 0 || size > session.EffectiveChunkSize() {
+		problem.Write(c, http.StatusBadRequest, problem.CodeChunkSizeMismatch, "size is required and must not exceed chunk size")
+		return
+	}
+
+	// the presigned PUT goes straight onto the chunk key, so a conflicting
+	// chunk is refused before the URL is issued
+	match, err := h.matchChunk(c.Request.Context(), session, chunkId, sum)
+	if err != nil {
+		h.logger.Error("presign chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "chunk_compare_failed",
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+		return
+	}
+	if match == chunkDifferent && !overwriteRequested(c.Request.Header) {
+		h.logger.Warn("presign chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "chunk_conflict",
+		)
+		problem.Write(c, http.StatusConflict, problem.CodeChunkConflict, "chunk already uploaded with different content")
+		return
+	}
+
+	presigned, err := h.uploadService.PresignChunk(c.Request.Context(), uploadId, chunkId, size, sum)
+	if err != nil {
+		if errors.Is(err, store.ErrPresignEncrypted) {
+			problem.Write(c, http.StatusConflict, problem.CodePresignNotAvailable, err.Error())
+			return
+		}
+		h.logger.Error("presign chunk failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"error", err,
+		)
+		problem.Internal(c, "could not presign chunk upload")
+		return
+	}
+
+	// the host is part of the URL and cannot be set by browser clients
+	headers := make(map[string]string, len(presigned.Headers))
+	for name := range presigned.Headers {
+		if name != "Host" {
+			headers[name] = presigned.Headers.Get(name)
+		}
+	}
+
+	c.JSON(http.StatusOK, PresignChunkResponse{
+		UploadId:  uploadId,
+		ChunkId:   chunkId,
+		URL:       presigned.URL,
+		Method:    presigned.Method,
+		Headers:   headers,
+		Size:      size,
+		ExpiresAt: presigned.ExpiresAt.Unix(),
+	})
+}
+
+// ConfirmChunk godoc
+//
+//	@Summary		Confirm presigned chunk upload
+//	@Description	Check a chunk uploaded through a presigned URL and record it on the session. Objects without the signed checksum or with the wrong size are deleted. Confirming a chunk again is answered as a duplicate and not charged twice.
+//	@Tags			uploads
+//	@Produce		json
+//	@Param			uploadId				path		string			true	"Upload session ID"
+//	@Param			chunkId					path		int				true	"Chunk number"
+//	@Param			X-SSE-Customer-Key		header		string			false	"Base64 AES-256 key of an SSE-C upload"
+//	@Param			X-SSE-Customer-Key-MD5	header		string			false	"Base64 MD5 of the SSE-C key"
+//	@Success		200						{object}	UploadResponse	"Chunk recorded"
+//	@Failure		400						{object}	problem.Problem	"Invalid request or integrity error"
+//	@Failure		401						{object}	problem.Problem	"Missing or invalid token"
+//	@Failure		403						{object}	problem.Problem	"Upload belongs to another user, or encryption key does not match it"
+//	@Failure		404						{object}	problem.Problem	"Session or chunk not found"
+//	@Failure		409						{object}	problem.Problem	"Upload completed or failed verification"
+//	@Failure		410						{object}	problem.Problem	"Upload aborted or session expired"
+//	@Failure		413						{object}	problem.Problem	"Chunk larger than the daily byte quota"
+//	@Failure		422						{object}	problem.Problem	"Assembled file failed verification"
+//	@Failure		429						{object}	problem.Problem	"Daily byte quota exceeded"
+//	@Failure		500						{object}	problem.Problem	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/upload/{uploadId}/chunk/{chunkId}/confirm [post]
+func (h *UploadsHandler) ConfirmChunk(c *gin.Context) {
+	uploadId, chunkId, session, ok := h.chunkSession(c)
+	if !ok {
+		return
+	}
+
+	var size int64
+	if session.TotalChunks > 0 {
+		size = session.ChunkLength(chunkId)
+	}
+
+	stored, duplicate, err := h.uploadService.ConfirmChunk(c.Request.Context(), uploadId, chunkId, size, session.RecordedHashes(chunkId))
+	if err != nil {
+		if h.respondQuotaExceeded(c, uploadId, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, store.ErrChunkNotFound):
+			problem.Write(c, http.StatusNotFound, problem.CodeChunkNotFound, "chunk not uploaded")
+		case errors.Is(err, services.ErrIntegrity):
+			h.logger.Warn("confirm chunk failed",
+				"upload_id", uploadId,
+				"chunk_id", chunkId,
+				"reason", "integrity_error",
+				"error", err,
+			)
+			problem.Write(c, http.StatusBadRequest, problem.CodeIntegrityMismatch, "chunk does not match its checksum")
+		default:
+			h.logger.Error("confirm chunk failed",
+				"upload_id", uploadId,
+				"chunk_id", chunkId,
+				"error", err,
+			)
+			problem.Internal(c, "internal server error")
+		}
+		return
+	}
+
+	if duplicate {
+		h.logger.Info("chunk already confirmed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+		)
+		// a retry after a lost finalization completes the upload again
+		if session.Status != store.SessionStatusCompleted && uint32(len(session.ReceivedChunks())) == session.TotalChunks {
+			if err := h.sessionService.MarkChunkComplete(c.Request.Context(), uploadId, stored); err != nil {
+				h.respondMarkChunkError(c, uploadId, chunkId, err)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, UploadResponse{
+			UploadId:  uploadId,
+			ChunkId:   chunkId,
+			S3Key:     store.ChunkKey(uploadId, chunkId),
+			Duplicate: true,
+		})
+		return
+	}
+
+	if err := h.sessionService.MarkChunkComplete(c.Request.Context(), uploadId, stored); err != nil {
+		h.respondMarkChunkError(c, uploadId, chunkId, err)
+		return
+	}
+
+	h.logger.Info("presigned chunk confirmed",
+		"upload_id", uploadId,
+		"chunk_id", chunkId,
+	)
+
+	c.JSON(http.StatusOK, UploadResponse{
+		UploadId: uploadId,
+		ChunkId:  chunkId,
+		S3Key:    store.ChunkKey(uploadId, chunkId),
+	})
+}
+
+// chunkSession loads the open session a chunk request targets and checks the
+// chunk index against it.
+func (h *UploadsHandler) chunkSession(c *gin.Context) (string, uint32, *store.UploadSession, bool) {
+	uploadId := c.Param("uploadId")
+	chunkId, err := strconv.ParseUint(c.Param("chunkId"), 10, 32)
+	if uploadId == "" || err != nil {
+		problem.Write(c, http.StatusBadRequest, problem.CodeInvalidChunkID, "invalid chunk ID")
+		return "", 0, nil, false
+	}
+
+	session, err := h.sessionService.GetSession(c.Request.Context(), uploadId)
+	if err != nil {
+		if h.respondForbidden(c, uploadId, err) {
+			return "", 0, nil, false
+		}
+		if errors.Is(err, apperror.ErrSessionNotFound) {
+			problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+			return "", 0, nil, false
+		}
+		problem.Internal(c, "internal server error")
+		return "", 0, nil, false
+	}
+
+	if h.respondClosedSession(c, uploadId, session.CheckWritable(time.Now())) {
+		return "", 0, nil, false
+	}
+	if !h.applyEncryption(c, session) {
+		return "", 0, nil, false
+	}
+
+	if err := session.ValidateChunkIndex(uint32(chunkId)); err != nil {
+		problem.Write(c, http.StatusBadRequest, problem.CodeChunkIndexOutOfRange, err.Error())
+		return "", 0, nil, false
+	}
+	return uploadId, uint32(chunkId), session, true
+}
+
+// respondMarkChunkError answers a request whose stored chunk could not be
+// recorded on the session.
+func (h *UploadsHandler) respondMarkChunkError(c *gin.Context, uploadId string, chunkId uint32, err error) {
+	if errors.Is(err, apperror.ErrSessionNotFound) {
+		h.logger.Warn("mark chunk complete failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "session_not_found",
+		)
+		problem.Write(c, http.StatusNotFound, problem.CodeSessionNotFound, "session not found")
+	} else if errors.Is(err, store.ErrChunkOutOfRange) {
+		h.logger.Warn("mark chunk complete failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "chunk_out_of_range",
+		)
+		problem.Write(c, http.StatusBadRequest, problem.CodeChunkIndexOutOfRange, err.Error())
+	} else if h.respondClosedSession(c, uploadId, err) {
+		return
+	} else if errors.Is(err, services.ErrFileIntegrity) {
+		h.logger.Warn("mark chunk complete failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "file_integrity_error",
+		)
+		problem.Write(c, http.StatusUnprocessableEntity, problem.CodeFileIntegrityMismatch, err.Error())
+	} else if errors.Is(err, apperror.ErrSessionUpdateDetails) {
+		h.logger.Error("mark chunk complete failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"reason", "session_update_error",
+		)
+		problem.Internal(c, "could not update session details")
+	} else {
+		h.logger.Error("mark chunk complete failed",
+			"upload_id", uploadId,
+			"chunk_id", chunkId,
+			"error", err,
+		)
+		problem.Internal(c, "internal server error")
+	}
+}
@@ -0,0 +1,31 @@
+package uploads
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/gin-gonic/gin"
+)
+
+// respondQuotaExceeded answers a request that would exceed a quota of the
+// caller. It reports false when err is not a quota error.
+func (h *UploadsHandler) respondQuotaExceeded(c *gin.Context, uploadId string, err error) bool {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	h.logger.Warn("upload quota exceeded",
+		"upload_id", uploadId,
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"quota", quotaErr.Quota,
+	)
+	if seconds := quotaErr.RetryAfterSeconds(); seconds > 0 {
+		c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	problem.Write(c, quotaErr.Status(), problem.CodeQuotaExceeded, quotaErr.Error())
+	return true
+}
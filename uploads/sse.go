@@ -0,0 +1,47 @@
+package uploads
+
+import (
+	"github.com/Yulian302/lfusys-services-uploads/problem"
+	"github.com/Yulian302/lfusys-services-uploads/services"
+	"github.com/Yulian302/lfusys-services-uploads/store"
+	"github.com/gin-gonic/gin"
+)
+
+// applyEncryption makes the chunk reads and writes of the request use the
+// encryption of the session. It answers the request and reports false when
+// the session needs a customer key the request did not send, or another one.
+func (h *UploadsHandler) applyEncryption(c *gin.Context, session *store.UploadSession) bool {
+	key, err := store.DefaultCustomerKeyHeaders.CustomerKey(c.Request.Header)
+	if err != nil {
+		h.respondEncryptionError(c, session.UploadID, err)
+		return false
+	}
+	encryption, err := h.sessionService.ChunkEncryption(c.Request.Context(), session, key)
+	if err != nil {
+		if !h.respondEncryptionError(c, session.UploadID, err) {
+			problem.Internal(c, "could not load upload encryption key")
+		}
+		return false
+	}
+
+	c.Request = c.Request.WithContext(store.WithEncryption(c.Request.Context(), encryption))
+	return true
+}
+
+// respondEncryptionError answers a request with a missing, invalid or wrong
+// customer key. It reports false when err is not about the key.
+func (h *UploadsHandler) respondEncryptionError(c *gin.Context, uploadId string, err error) bool {
+	status, code, ok := services.CustomerKeyProblem(err)
+	if !ok {
+		return false
+	}
+
+	h.logger.Warn("encryption key rejected",
+		"upload_id", uploadId,
+		"method", c.Request.Method,
+		"path", c.FullPath(),
+		"error", err,
+	)
+	problem.Write(c, status, code, err.Error())
+	return true
+}
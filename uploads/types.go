@@ -1,7 +1,117 @@
 package uploads
 
+import (
+	"time"
+
+	"github.com/Yulian302/lfusys-services-uploads/store"
+)
+
+type CreateUploadRequest struct {
+	FileName          string `json:"file_name" binding:"required" example:"video.mp4"`
+	TotalSize         int64  `json:"total_size" binding:"required,gt=0" example:"26214400"`
+	ChunkSize         int64  `json:"chunk_size" binding:"omitempty,gt=0" example:"5242880"`
+	MaxChunkSize      int64  `json:"max_chunk_size,omitempty" binding:"omitempty,gt=0" example:"8388608"`
+	FileHash          string `json:"file_hash,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	FileHashAlgorithm string `json:"file_hash_algorithm,omitempty" enums:"sha-256,sha-1,md5,crc32c,blake3" example:"sha-256"`
+	MerkleRoot        string `json:"merkle_root,omitempty" example:"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"`
+	HashAlgorithm     string `json:"hash_algorithm,omitempty" enums:"sha-256,sha-1,md5,crc32c,blake3" example:"crc32c"`
+	StorageEncoding   string `json:"storage_encoding,omitempty" enums:"identity,gzip,zstd" example:"zstd"`
+}
+
+type CreateUploadResponse struct {
+	UploadId        string `json:"upload_id" example:"abc123"`
+	Status          string `json:"status" example:"pending"`
+	TotalChunks     uint32 `json:"total_chunks" example:"5"`
+	ChunkSize       int64  `json:"chunk_size" example:"5242880"`
+	MaxChunkSize    int64  `json:"max_chunk_size" example:"67108864"`
+	HashAlgorithm   string `json:"hash_algorithm" example:"sha-256"`
+	StorageEncoding string `json:"storage_encoding,omitempty" example:"zstd"`
+	Encryption      string `json:"encryption,omitempty" enums:"AES256,aws:kms,SSE-C" example:"aws:kms"`
+	KMSKeyID        string `json:"kms_key_id,omitempty" example:"arn:aws:kms:eu-central-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"`
+	ExpiresAt       int64  `json:"expires_at,omitempty" example:"1735689600"`
+}
+
 type UploadResponse struct {
-	UploadId string `json:"upload_id" example:"abc123"`
-	ChunkId  uint32 `json:"chunk_id" example:"1"`
-	S3Key    string `json:"s3_key" example:"uploads/abc123/chunk_1"`
+	UploadId  string `json:"upload_id" example:"abc123"`
+	ChunkId   uint32 `json:"chunk_id" example:"1"`
+	S3Key     string `json:"s3_key" example:"uploads/abc123/chunk_1"`
+	Duplicate bool   `json:"duplicate,omitempty" example:"false"`
+}
+
+type ChunkRange struct {
+	Start uint32 `json:"start" example:"2"`
+	End   uint32 `json:"end" example:"4"`
+}
+
+type UploadStatusResponse struct {
+	UploadId       string       `json:"upload_id" example:"abc123"`
+	Status         string       `json:"status" enums:"pending,in_progress,completed,aborted,failed,expired" example:"in_progress"`
+	TotalChunks    uint32       `json:"total_chunks" example:"5"`
+	ReceivedChunks []uint32     `json:"received_chunks" example:"0,1"`
+	MissingRanges  []ChunkRange `json:"missing_ranges"`
+	ReceivedBytes  int64        `json:"received_bytes" example:"10485760"`
+	TotalBytes     int64        `json:"total_bytes" example:"26214400"`
+	Progress       float64      `json:"progress" example:"0.4"`
+	FailureReason  string       `json:"failure_reason,omitempty" example:"assembled file does not match file hash"`
+	ExpiresAt      int64        `json:"expires_at,omitempty" example:"1735689600"`
+}
+
+type AbortResponse struct {
+	UploadId      string `json:"upload_id" example:"abc123"`
+	Status        string `json:"status" example:"aborted"`
+	DeletedChunks int    `json:"deleted_chunks" example:"3"`
+}
+
+type BatchChunkResult struct {
+	ChunkId uint32 `json:"chunk_id" example:"3"`
+	Status  string `json:"status" example:"stored"`
+	Code    string `json:"code,omitempty" example:"integrity_mismatch"`
+	Error   string `json:"error,omitempty" example:"chunk does not match its digest"`
+}
+
+type BatchUploadResponse struct {
+	UploadId  string             `json:"upload_id" example:"abc123"`
+	Stored    int                `json:"stored" example:"7"`
+	Unchanged int                `json:"unchanged" example:"0"`
+	Failed    int                `json:"failed" example:"1"`
+	Results   []BatchChunkResult `json:"results"`
+}
+
+func newUploadStatusResponse(uploadId string, session *store.UploadSession) UploadStatusResponse {
+	missing := session.MissingRanges()
+	ranges := make([]ChunkRange, 0, len(missing))
+	for _, r := range missing {
+		ranges = append(ranges, ChunkRange{Start: r.Start, End: r.End})
+	}
+
+	resp := UploadStatusResponse{
+		UploadId:       uploadId,
+		Status:         session.CurrentStatus(time.Now()),
+		TotalChunks:    session.TotalChunks,
+		ReceivedChunks: session.ReceivedChunks(),
+		MissingRanges:  ranges,
+		ReceivedBytes:  session.ReceivedBytes(),
+		TotalBytes:     session.TotalBytes(),
+		FailureReason:  session.FailureReason,
+		ExpiresAt:      session.ExpiresAt,
+	}
+	if resp.TotalBytes > 0 {
+		resp.Progress = float64(resp.ReceivedBytes) / float64(resp.TotalBytes)
+	}
+	return resp
+}
+
+type PresignChunkRequest struct {
+	ChecksumSHA256 string `json:"checksum_sha256" binding:"required" example:"LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="`
+	Size           int64  `json:"size,omitempty" binding:"omitempty,gt=0" example:"5242880"`
+}
+
+type PresignChunkResponse struct {
+	UploadId  string            `json:"upload_id" example:"abc123"`
+	ChunkId   uint32            `json:"chunk_id" example:"1"`
+	URL       string            `json:"url" example:"https://bucket.s3.amazonaws.com/uploads/abc123/chunk_1?X-Amz-Signature=..."`
+	Method    string            `json:"method" example:"PUT"`
+	Headers   map[string]string `json:"headers"`
+	Size      int64             `json:"size" example:"5242880"`
+	ExpiresAt int64             `json:"expires_at" example:"1735689600"`
 }